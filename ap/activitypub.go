@@ -1,63 +1,52 @@
 package ap
 
 import (
-	"bytes"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"net"
+	"log/slog"
 	"net/http"
 	"net/url"
-	"os"
 	"strconv"
+	"strings"
 
 	// For knife.Version
+	"knife/config"
 	"knife/db"
 	"knife/etc"
 
-	"crypto/x509"
-	"encoding/pem"
 	"time"
 
 	"github.com/go-ap/activitypub"
-	"github.com/go-fed/httpsig"
 )
 
-type ActivityPubAPI struct {
-	noteModel     *db.NoteModel
-	profileModel  *db.ProfileModel
-	followerModel *db.FollowerModel
-	httpsigModel  *db.HTTPSigModel
-}
-
-func NewActivityPubAPI(noteModel *db.NoteModel, profileModel *db.ProfileModel, followerModel *db.FollowerModel, httpsigModel *db.HTTPSigModel) *ActivityPubAPI {
-	return &ActivityPubAPI{noteModel: noteModel, profileModel: profileModel, followerModel: followerModel, httpsigModel: httpsigModel}
-}
-
-func (a *ActivityPubAPI) getProtocol() string {
-	if proto := os.Getenv("KNIFE_PROTOCOL"); proto != "" {
-		return proto
-	}
-	return "https"
-}
+// maxInboxBodySize is the largest activity the inbox reads. Activities are
+// small JSON documents; anything bigger is refused before it is verified.
+const maxInboxBodySize = 1 << 20
 
-func (a *ActivityPubAPI) getHost(r *http.Request) string {
-	if host := os.Getenv("KNIFE_HOST"); host != "" {
-		return host
-	}
-	return r.Host
+type ActivityPubAPI struct {
+	cfg            *config.Config
+	fetcher        *Fetcher
+	dispatcher     *ActivityDispatcher
+	noteModel      *db.NoteModel
+	profileModel   *db.ProfileModel
+	followerModel  *db.FollowerModel
+	followingModel *db.FollowingModel
+	httpsigModel   *db.HTTPSigModel
+	keyCache       *actorKeyCache
 }
 
-func (a *ActivityPubAPI) getBaseURL(r *http.Request) string {
-	return fmt.Sprintf("%s://%s", a.getProtocol(), a.getHost(r))
+func NewActivityPubAPI(cfg *config.Config, fetcher *Fetcher, dispatcher *ActivityDispatcher, noteModel *db.NoteModel, profileModel *db.ProfileModel, followerModel *db.FollowerModel, followingModel *db.FollowingModel, httpsigModel *db.HTTPSigModel) *ActivityPubAPI {
+	return &ActivityPubAPI{cfg: cfg, fetcher: fetcher, dispatcher: dispatcher, noteModel: noteModel, profileModel: profileModel, followerModel: followerModel, followingModel: followingModel, httpsigModel: httpsigModel, keyCache: newActorKeyCache(fetcher)}
 }
 
 // Webfinger handles /.well-known/webfinger requests
 func (a *ActivityPubAPI) Webfinger(w http.ResponseWriter, r *http.Request) {
 	resource := r.URL.Query().Get("resource")
-	log.Printf("Webfinger request for resource: %s", resource)
+	slog.Debug("webfinger request", "resource", resource)
 
 	if resource == "" {
 		http.Error(w, "missing resource", http.StatusBadRequest)
@@ -71,9 +60,9 @@ func (a *ActivityPubAPI) Webfinger(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	host := a.getHost(r)
+	host := a.cfg.Host()
 	canonicalSubject := fmt.Sprintf("acct:%s@%s", profile.Finger, host)
-	id := a.getBaseURL(r) + "/profile"
+	id := a.cfg.BaseURL + "/profile"
 
 	jrd := map[string]interface{}{
 		"subject": canonicalSubject,
@@ -107,7 +96,7 @@ func (a *ActivityPubAPI) Actor(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id := a.getBaseURL(r) + "/profile"
+	id := a.cfg.BaseURL + "/profile"
 
 	sig, err := a.httpsigModel.GetByActor(id)
 	if err != nil {
@@ -133,10 +122,12 @@ func (a *ActivityPubAPI) Actor(w http.ResponseWriter, r *http.Request) {
 		"preferredUsername": profile.Finger,
 		"name":              profile.DisplayName,
 		"summary":           profile.Bio,
-		"inbox":             a.getBaseURL(r) + "/inbox",
-		"outbox":            a.getBaseURL(r) + "/outbox",
+		"inbox":             a.cfg.BaseURL + "/inbox",
+		"outbox":            a.cfg.BaseURL + "/outbox",
+		"followers":         a.cfg.BaseURL + "/followers",
+		"following":         a.cfg.BaseURL + "/following",
 		"endpoints": map[string]interface{}{
-			"sharedInbox": a.getBaseURL(r) + "/inbox", // Single user, so shared inbox is same as inbox
+			"sharedInbox": a.cfg.BaseURL + "/inbox", // Single user, so shared inbox is same as inbox
 		},
 		"icon": map[string]interface{}{
 			"type":      "Image",
@@ -189,8 +180,9 @@ func (a *ActivityPubAPI) NodeInfoHandler(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(nodeInfo)
 }
 
+// Note serves a note, or its replies collection at /notes/{id}/replies.
 func (a *ActivityPubAPI) Note(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Path[len("/notes/"):]
+	idStr, collection, _ := strings.Cut(r.URL.Path[len("/notes/"):], "/")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
 		http.Error(w, "Invalid note ID", http.StatusBadRequest)
@@ -206,77 +198,69 @@ func (a *ActivityPubAPI) Note(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	// Only non-public notes need the signature checked.
+	if !note.VisibleTo(db.NoteViewer{}) && !note.VisibleTo(a.noteViewer(r)) {
+		http.Error(w, "Note not found", http.StatusNotFound)
+		return
+	}
 
-	apNote := GenerateAPNote(note, a.getBaseURL(r))
-	// Ensure the ID in the JSON matches the canonical URL
-	apNote["id"] = a.getBaseURL(r) + "/notes/" + idStr
+	switch collection {
+	case "":
+	case "replies":
+		a.replies(w, r, note)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if note.BoostOf != 0 {
+		writeActivityJSON(w, GenerateAnnounceActivity(note, a.cfg.BaseURL))
+		return
+	}
+
+	apNote := GenerateAPNote(note, a.cfg.BaseURL)
 
 	w.Header().Set("Content-Type", "application/activity+json; charset=utf-8")
 	json.NewEncoder(w).Encode(apNote)
 }
 
-func (a *ActivityPubAPI) sendActivity(inbox string, actorIRI string, activity interface{}) error {
-	activityJSON, err := json.Marshal(activity)
-	if err != nil {
-		return fmt.Errorf("failed to marshal activity: %w", err)
+// localNoteURI maps the ActivityPub ID of one of our notes to the URI it is
+// stored under. Other IRIs are returned unchanged.
+func (a *ActivityPubAPI) localNoteURI(iri string) string {
+	idStr, ok := strings.CutPrefix(iri, a.cfg.BaseURL+"/notes/")
+	if !ok {
+		return iri
 	}
-
-	req, err := http.NewRequest("POST", inbox, bytes.NewBuffer(activityJSON))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/activity+json")
-	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
-	inboxURL, err := url.Parse(inbox)
-	if err != nil {
-		return fmt.Errorf("failed to parse inbox url: %w", err)
-	}
-	req.Header.Set("Host", inboxURL.Host)
-
-	sig, err := a.httpsigModel.GetByActor(actorIRI)
+	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		return fmt.Errorf("failed to get httpsig for %s: %w", actorIRI, err)
-	}
-
-	block, _ := pem.Decode([]byte(sig.PrivateKey))
-	if block == nil {
-		return fmt.Errorf("failed to decode private key")
+		return iri
 	}
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	note, err := a.noteModel.Get(id)
 	if err != nil {
-		return fmt.Errorf("failed to parse private key: %w", err)
+		return iri
 	}
+	return note.URI
+}
 
-	// Sign the request
-	keyID := actorIRI + "#main-key"
-	prefs := []httpsig.Algorithm{httpsig.RSA_SHA256}
-	digestAlgo := httpsig.DigestSha256
-	headersToSign := []string{httpsig.RequestTarget, "host", "date", "digest"}
-	signer, _, err := httpsig.NewSigner(prefs, digestAlgo, headersToSign, httpsig.Signature, 65535)
+// noteViewer identifies who a fetch of a note comes from. Fetches signed
+// by one of our followers may see followers-only notes, and fetches signed
+// by a mentioned actor the notes mentioning it.
+func (a *ActivityPubAPI) noteViewer(r *http.Request) db.NoteViewer {
+	signer, err := a.verifyRequest(r, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create signer: %w", err)
-	}
-	if err := signer.SignRequest(privateKey, keyID, req, activityJSON); err != nil {
-		return fmt.Errorf("failed to sign request: %w", err)
+		if err != errNoSignature {
+			log.Printf("Note: ignoring signature: %v", err)
+		}
+		return db.NoteViewer{}
 	}
 
-	log.Printf("Sending activity to %s. Headers: Digest=%s, Signature=%s", inbox, req.Header.Get("Digest"), req.Header.Get("Signature"))
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	follower, err := a.followerModel.IsFollower(signer)
 	if err != nil {
-		return fmt.Errorf("failed to send activity: %w", err)
+		log.Printf("Note: could not check follower %s: %v", signer, err)
+		return db.NoteViewer{Actor: signer}
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(resp.Body)
-		log.Printf("inbox %s returned status %d: %s", inbox, resp.StatusCode, string(body))
-		return fmt.Errorf("activity send failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
-	log.Printf("Successfully sent activity to %s", inbox)
-	return nil
+	return db.NoteViewer{Follower: follower, Actor: signer}
 }
 
 // Inbox handles incoming ActivityPub POST requests.
@@ -286,13 +270,24 @@ func (a *ActivityPubAPI) Inbox(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := io.ReadAll(r.Body)
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxInboxBodySize))
 	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
 		log.Printf("Inbox: failed to read request body: %v", err)
 		http.Error(w, "failed to read request body", http.StatusInternalServerError)
 		return
 	}
-	log.Printf("Inbox: received body: %s", data)
+
+	signer, err := a.verifyRequest(r, data)
+	if err != nil {
+		log.Printf("Inbox: rejecting request: %v", err)
+		http.Error(w, "invalid or missing signature", http.StatusUnauthorized)
+		return
+	}
 
 	item, err := activitypub.UnmarshalJSON(data)
 	if err != nil {
@@ -301,19 +296,37 @@ func (a *ActivityPubAPI) Inbox(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The signing key must belong to the actor the activity claims to be from.
+	var actorIRI string
+	activitypub.OnActivity(item, func(act *activitypub.Activity) error {
+		if act.Actor != nil {
+			actorIRI = act.Actor.GetLink().String()
+		}
+		return nil
+	})
+	if actorIRI == "" || actorIRI != signer {
+		log.Printf("Inbox: activity actor %q does not match signer %q", actorIRI, signer)
+		http.Error(w, "signature does not match activity actor", http.StatusUnauthorized)
+		return
+	}
+
 	err = activitypub.OnActivity(item, func(act *activitypub.Activity) error {
-		log.Printf("Inbox: processing activity of type %s", act.GetType())
+		log.Printf("Inbox: processing %s activity %s from %s", act.GetType(), act.GetID(), signer)
 		switch act.GetType() {
 		case activitypub.FollowType:
-			return a.handleFollowActivity(act, r.Host)
+			return a.handleFollowActivity(act)
+		case activitypub.AcceptType:
+			return a.handleAcceptActivity(act)
+		case activitypub.RejectType:
+			return a.handleRejectActivity(act)
 		case activitypub.UndoType:
 			return a.handleUndoActivity(act)
 		case activitypub.CreateType:
-			return a.handleCreateActivity(act)
+			return a.handleCreateActivity(act, signer)
 		case activitypub.UpdateType:
-			return a.handleUpdateActivity(act)
+			return a.handleUpdateActivity(act, signer)
 		case activitypub.DeleteType:
-			return a.handleDeleteActivity(act)
+			return a.handleDeleteActivity(act, signer)
 		case activitypub.LikeType:
 			return a.handleLikeActivity(act)
 		case activitypub.AnnounceType:
@@ -332,20 +345,20 @@ func (a *ActivityPubAPI) Inbox(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleFollowActivity processes Follow activities.
-func (a *ActivityPubAPI) handleFollowActivity(act *activitypub.Activity, host string) error {
+func (a *ActivityPubAPI) handleFollowActivity(act *activitypub.Activity) error {
 	actor, inboxURI, err := a.resolveActorAndInbox(act.Actor)
 	if err != nil {
 		return fmt.Errorf("handleFollowActivity: %w", err)
 	}
 
 	log.Printf("Inbox: Adding follower %s", actor.GetID())
-	err = a.followerModel.AddFollower(actor.GetID().String(), inboxURI)
+	err = a.followerModel.AddFollower(actor.GetID().String(), inboxURI, sharedInboxOf(actor, inboxURI))
 	if err != nil {
 		return err
 	}
 
-	myActorIRI := "https://" + host + "/profile"
-	acceptID := fmt.Sprintf("https://%s/activities/accept-%d", host, time.Now().UnixNano())
+	myActorIRI := a.cfg.BaseURL + "/profile"
+	acceptID := fmt.Sprintf("%s/activities/accept-%d", a.cfg.BaseURL, time.Now().UnixNano())
 	accept := activitypub.Accept{
 		ID:     activitypub.IRI(acceptID),
 		Type:   activitypub.AcceptType,
@@ -354,16 +367,69 @@ func (a *ActivityPubAPI) handleFollowActivity(act *activitypub.Activity, host st
 		To:     []activitypub.Item{activitypub.IRI(inboxURI)},
 	}
 
-	go func() {
-		log.Printf("Sending Accept for Follow to %s", inboxURI)
-		if err := a.sendActivity(inboxURI, myActorIRI, accept); err != nil {
-			log.Printf("Error sending Accept activity: %v", err)
-		}
-	}()
+	acceptBytes, err := json.Marshal(accept)
+	if err != nil {
+		return fmt.Errorf("handleFollowActivity: failed to marshal accept: %w", err)
+	}
+
+	log.Printf("Sending Accept for Follow to %s", inboxURI)
+	a.dispatcher.deliver(inboxURI, acceptBytes, myActorIRI)
 
 	return nil
 }
 
+// handleAcceptActivity processes Accept activities answering our Follows.
+func (a *ActivityPubAPI) handleAcceptActivity(act *activitypub.Activity) error {
+	following, err := a.findFollowing(act)
+	if err != nil {
+		return fmt.Errorf("handleAcceptActivity: %w", err)
+	}
+
+	log.Printf("Inbox: Follow of %s accepted", following.ActorURI)
+	return a.followingModel.SetState(following.ActorURI, db.FollowingStateAccepted)
+}
+
+// handleRejectActivity processes Reject activities answering our Follows.
+func (a *ActivityPubAPI) handleRejectActivity(act *activitypub.Activity) error {
+	following, err := a.findFollowing(act)
+	if err != nil {
+		return fmt.Errorf("handleRejectActivity: %w", err)
+	}
+
+	log.Printf("Inbox: Follow of %s rejected", following.ActorURI)
+	return a.followingModel.RemoveFollowing(following.ActorURI)
+}
+
+// findFollowing finds the Follow an Accept or Reject refers to. The object
+// may be the IRI of our Follow or the embedded Follow itself, and only the
+// followed actor may answer it.
+func (a *ActivityPubAPI) findFollowing(act *activitypub.Activity) (*db.Following, error) {
+	if act.Object == nil || act.Actor == nil {
+		return nil, fmt.Errorf("missing actor or object")
+	}
+	actorIRI := act.Actor.GetLink().String()
+
+	var following *db.Following
+	var err error
+	if act.Object.IsLink() {
+		following, err = a.followingModel.GetByFollowID(act.Object.GetLink().String())
+	} else {
+		following, err = a.followingModel.GetByFollowID(act.Object.GetID().String())
+		if err == sql.ErrNoRows {
+			// Some servers do not echo our Follow ID back.
+			following, err = a.followingModel.Get(actorIRI)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("no pending follow for %s: %w", actorIRI, err)
+	}
+
+	if following.ActorURI != actorIRI {
+		return nil, fmt.Errorf("follow of %s answered by %s", following.ActorURI, actorIRI)
+	}
+	return following, nil
+}
+
 // handleUndoActivity processes Undo activities.
 func (a *ActivityPubAPI) handleUndoActivity(act *activitypub.Activity) error {
 	// The object of an Undo activity is the Activity being undone.
@@ -445,8 +511,9 @@ func (a *ActivityPubAPI) handleUndoAnnounce(innerAct *activitypub.Activity) erro
 	return a.noteModel.DecrementShares(note.ID)
 }
 
-// handleCreateActivity processes Create activities.
-func (a *ActivityPubAPI) handleCreateActivity(act *activitypub.Activity) error {
+// handleCreateActivity processes Create activities. Only notes attributed
+// to signer and hosted on its server are accepted.
+func (a *ActivityPubAPI) handleCreateActivity(act *activitypub.Activity, signer string) error {
 	actor, err := a.resolveActor(act.Actor)
 	if err != nil {
 		return fmt.Errorf("handleCreateActivity: %w", err)
@@ -460,6 +527,12 @@ func (a *ActivityPubAPI) handleCreateActivity(act *activitypub.Activity) error {
 		if obj.GetType() != activitypub.NoteType {
 			return nil
 		}
+		if obj.AttributedTo == nil || obj.AttributedTo.GetLink().String() != signer {
+			return fmt.Errorf("handleCreateActivity: note %s is not attributed to %s", obj.GetID(), signer)
+		}
+		if host := a.extractHost(obj.GetID().String()); host == "" || host != a.extractHost(signer) {
+			return fmt.Errorf("handleCreateActivity: note %s is not hosted by %s", obj.GetID(), signer)
+		}
 
 		// Determine the visibility of the note
 		var to []string
@@ -470,7 +543,11 @@ func (a *ActivityPubAPI) handleCreateActivity(act *activitypub.Activity) error {
 		for _, item := range obj.CC {
 			cc = append(cc, item.GetLink().String())
 		}
-		publicRange := DeterminePublicRange(to, cc)
+		var followers string
+		if actor.Followers != nil {
+			followers = actor.Followers.GetLink().String()
+		}
+		publicRange := DeterminePublicRange(to, cc, followers)
 
 		log.Printf("Inbox: Creating federated note from %s", obj.GetID())
 		note := &db.Note{
@@ -479,29 +556,42 @@ func (a *ActivityPubAPI) handleCreateActivity(act *activitypub.Activity) error {
 			AuthorFinger: authorFinger,
 			Host:         authorHost,
 			AuthorName:   authorName,
+			AuthorURI:    actor.GetID().String(),
 			PublicRange:  publicRange,
 		}
-		return a.noteModel.CreateFederatedNote(note)
+		if obj.InReplyTo != nil {
+			note.InReplyTo = a.localNoteURI(obj.InReplyTo.GetLink().String())
+		}
+		if err := a.noteModel.CreateFederatedNote(note); err != nil {
+			return err
+		}
+		return a.noteModel.SetTags(note.ID, objectTags(obj))
 	})
 }
 
-// handleUpdateActivity processes Update activities.
-func (a *ActivityPubAPI) handleUpdateActivity(act *activitypub.Activity) error {
+// handleUpdateActivity processes Update activities. Only remote notes
+// written by signer are updated.
+func (a *ActivityPubAPI) handleUpdateActivity(act *activitypub.Activity, signer string) error {
 	return activitypub.OnObject(act.Object, func(obj *activitypub.Object) error {
 		if obj.GetType() != activitypub.NoteType {
 			return nil
 		}
+		note, err := a.signerNote(obj.GetID().String(), signer)
+		if err != nil || note == nil {
+			return err
+		}
 		log.Printf("Inbox: Updating federated note %s", obj.GetID())
-		note := &db.Note{
-			URI:     obj.GetID().String(),
-			Content: StripHTML(obj.Content.First().String()),
+		note.Content = StripHTML(obj.Content.First().String())
+		if err := a.noteModel.UpdateFederatedNote(note); err != nil {
+			return err
 		}
-		return a.noteModel.UpdateFederatedNote(note)
+		return a.noteModel.SetTags(note.ID, objectTags(obj))
 	})
 }
 
-// handleDeleteActivity processes Delete activities.
-func (a *ActivityPubAPI) handleDeleteActivity(act *activitypub.Activity) error {
+// handleDeleteActivity processes Delete activities. Only remote notes
+// written by signer are deleted.
+func (a *ActivityPubAPI) handleDeleteActivity(act *activitypub.Activity, signer string) error {
 	var uri string
 	if act.Object.IsLink() {
 		uri = act.Object.GetLink().String()
@@ -515,11 +605,31 @@ func (a *ActivityPubAPI) handleDeleteActivity(act *activitypub.Activity) error {
 		}
 	}
 
-	if uri != "" {
-		log.Printf("Inbox: Deleting federated object %s", uri)
-		return a.noteModel.DeleteByURI(uri)
+	if uri == "" {
+		return nil
 	}
-	return nil
+	note, err := a.signerNote(uri, signer)
+	if err != nil || note == nil {
+		return err
+	}
+	log.Printf("Inbox: Deleting federated object %s", uri)
+	return a.noteModel.Delete(note.ID)
+}
+
+// signerNote returns the note with uri so that signer may change it. It
+// returns nil when there is no such note, and an error when the note is
+// ours or another actor's.
+func (a *ActivityPubAPI) signerNote(uri, signer string) (*db.Note, error) {
+	note, err := a.noteModel.GetByURI(uri)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if note.IsLocal() || note.AuthorURI != signer {
+		return nil, fmt.Errorf("%s may not change note %s", signer, uri)
+	}
+	return note, nil
 }
 
 // resolveActorAndInbox resolves an actor and their inbox URI.
@@ -537,6 +647,25 @@ func (a *ActivityPubAPI) resolveActorAndInbox(actorRef activitypub.Item) (*activ
 	return actor, inboxURI, nil
 }
 
+// sharedInboxOf returns the actor's endpoints.sharedInbox, or "" when it
+// has none. A shared inbox on a different host than the actor's own inbox
+// is ignored.
+func sharedInboxOf(actor *activitypub.Actor, inboxURI string) string {
+	if actor.Endpoints == nil || actor.Endpoints.SharedInbox == nil {
+		return ""
+	}
+	sharedInbox := actor.Endpoints.SharedInbox.GetLink().String()
+	shared, err := url.Parse(sharedInbox)
+	if err != nil || (shared.Scheme != "https" && shared.Scheme != "http") {
+		return ""
+	}
+	inbox, err := url.Parse(inboxURI)
+	if err != nil || inbox.Host != shared.Host {
+		return ""
+	}
+	return sharedInbox
+}
+
 // resolveActor resolves an actor from an ActivityPub item.
 func (a *ActivityPubAPI) resolveActor(actorRef activitypub.Item) (*activitypub.Actor, error) {
 	actor, err := activitypub.ToActor(actorRef)
@@ -545,8 +674,8 @@ func (a *ActivityPubAPI) resolveActor(actorRef activitypub.Item) (*activitypub.A
 	}
 
 	if iri := actorRef.GetLink(); iri != "" {
-		log.Printf("Fetching actor from IRI %s", iri)
-		return fetchActor(iri.String())
+		slog.Debug("fetching actor", "iri", iri)
+		return a.fetcher.fetchActor(iri.String())
 	}
 
 	return nil, fmt.Errorf("could not resolve actor")
@@ -561,81 +690,6 @@ func (a *ActivityPubAPI) extractHost(urlStr string) string {
 	return parsedURL.Host
 }
 
-// fetchActor fetches an ActivityPub Actor from the given IRI.
-func fetchActor(iri string) (*activitypub.Actor, error) {
-	if err := validateIRI(iri); err != nil {
-		return nil, fmt.Errorf("fetchActor: invalid IRI: %w", err)
-	}
-
-	// Create a GET request to fetch the actor
-	req, err := http.NewRequest("GET", iri, nil)
-	if err != nil {
-		return nil, fmt.Errorf("fetchActor: failed to create request: %w", err)
-	}
-	req.Header.Set("Accept", "application/activity+json")
-
-	// Send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("fetchActor: failed to fetch actor: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Check for non-2xx status codes
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("fetchActor: unexpected status code %d: %s", resp.StatusCode, string(body))
-	}
-
-	// Read and parse the response body
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("fetchActor: failed to read response body: %w", err)
-	}
-
-	item, err := activitypub.UnmarshalJSON(data)
-	if err != nil {
-		return nil, fmt.Errorf("fetchActor: failed to unmarshal JSON: %w", err)
-	}
-
-	actor, err := activitypub.ToActor(item)
-	if err != nil {
-		return nil, fmt.Errorf("fetchActor: item is not an actor: %w", err)
-	}
-
-	return actor, nil
-}
-
-func validateIRI(iri string) error {
-	u, err := url.Parse(iri)
-	if err != nil {
-		return err
-	}
-
-	if u.Scheme != "http" && u.Scheme != "https" {
-		return fmt.Errorf("unsupported scheme: %s", u.Scheme)
-	}
-
-	if os.Getenv("KNIFE_DEV_MODE") == "true" {
-		return nil
-	}
-
-	hostname := u.Hostname()
-	ips, err := net.LookupIP(hostname)
-	if err != nil {
-		return err
-	}
-
-	for _, ip := range ips {
-		if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() {
-			return fmt.Errorf("resolves to private/loopback IP: %s", ip.String())
-		}
-	}
-
-	return nil
-}
-
 func (a *ActivityPubAPI) handleLikeActivity(act *activitypub.Activity) error {
 	var uri string
 	if act.Object.IsLink() {
@@ -0,0 +1,216 @@
+package ap
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"knife/config"
+	"knife/db"
+
+	"github.com/go-ap/activitypub"
+)
+
+const (
+	testAuthor = "https://remote.example/users/bob"
+	testOther  = "https://evil.example/users/mallory"
+)
+
+// newTestAPI returns an ActivityPubAPI on a fresh database holding a local
+// note and a remote note by testAuthor.
+func newTestAPI(t *testing.T) (*ActivityPubAPI, *db.Note, *db.Note) {
+	t.Helper()
+	dbconn, err := db.InitDB(filepath.Join(t.TempDir(), "knife.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { dbconn.Close() })
+
+	cfg := config.Default()
+	cfg.BaseURL = "https://knife.example"
+	noteModel := db.NewNoteModel(dbconn)
+	profileModel := db.NewProfileModel(dbconn)
+	if err := profileModel.Create(&db.Profile{Finger: "alice", DisplayName: "Alice"}); err != nil {
+		t.Fatalf("Create profile: %v", err)
+	}
+	a := &ActivityPubAPI{cfg: cfg, noteModel: noteModel, profileModel: profileModel}
+
+	local := &db.Note{Content: "local", Host: "knife.example", AuthorFinger: "alice", PublicRange: db.NotePublicRangePrivate}
+	if err := noteModel.CreateLocalNote(local, cfg.BaseURL); err != nil {
+		t.Fatalf("CreateLocalNote: %v", err)
+	}
+	remote := &db.Note{URI: "https://remote.example/notes/1", Content: "remote", Host: "remote.example", AuthorFinger: "bob@remote.example", AuthorURI: testAuthor}
+	if err := noteModel.CreateFederatedNote(remote); err != nil {
+		t.Fatalf("CreateFederatedNote: %v", err)
+	}
+	return a, local, remote
+}
+
+func parseActivity(t *testing.T, data string) *activitypub.Activity {
+	t.Helper()
+	item, err := activitypub.UnmarshalJSON([]byte(data))
+	if err != nil {
+		t.Fatalf("UnmarshalJSON: %v", err)
+	}
+	act, err := activitypub.ToActivity(item)
+	if err != nil {
+		t.Fatalf("ToActivity: %v", err)
+	}
+	return act
+}
+
+func TestUpdateActivityOwnership(t *testing.T) {
+	tests := []struct {
+		name    string
+		signer  string
+		note    func(local, remote *db.Note) *db.Note
+		wantErr bool
+	}{
+		{"author updates own note", testAuthor, func(_, remote *db.Note) *db.Note { return remote }, false},
+		{"other actor updates remote note", testOther, func(_, remote *db.Note) *db.Note { return remote }, true},
+		{"remote actor updates local note", testAuthor, func(local, _ *db.Note) *db.Note { return local }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, local, remote := newTestAPI(t)
+			target := tt.note(local, remote)
+			for _, note := range []*db.Note{local, remote} {
+				if err := a.noteModel.SetTags(note.ID, []string{"original"}); err != nil {
+					t.Fatalf("SetTags: %v", err)
+				}
+			}
+			act := parseActivity(t, `{
+				"type": "Update",
+				"actor": "`+tt.signer+`",
+				"object": {"id": "`+target.URI+`", "type": "Note", "attributedTo": "`+tt.signer+`", "content": "changed",
+					"tag": [{"type": "Hashtag", "name": "#changed"}]}
+			}`)
+
+			err := a.handleUpdateActivity(act, tt.signer)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("handleUpdateActivity error = %v, want error %v", err, tt.wantErr)
+			}
+
+			got, err := a.noteModel.Get(target.ID)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if changed := got.Content == "changed"; changed == tt.wantErr {
+				t.Errorf("content = %q, changed %v, want changed %v", got.Content, changed, !tt.wantErr)
+			}
+			if retagged := slices.Equal(got.Tags, []string{"changed"}); retagged == tt.wantErr {
+				t.Errorf("tags = %v, replaced %v, want replaced %v", got.Tags, retagged, !tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDeleteActivityOwnership(t *testing.T) {
+	tests := []struct {
+		name    string
+		signer  string
+		note    func(local, remote *db.Note) *db.Note
+		wantErr bool
+	}{
+		{"author deletes own note", testAuthor, func(_, remote *db.Note) *db.Note { return remote }, false},
+		{"other actor deletes remote note", testOther, func(_, remote *db.Note) *db.Note { return remote }, true},
+		{"remote actor deletes local note", testAuthor, func(local, _ *db.Note) *db.Note { return local }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, local, remote := newTestAPI(t)
+			target := tt.note(local, remote)
+			act := parseActivity(t, `{
+				"type": "Delete",
+				"actor": "`+tt.signer+`",
+				"object": "`+target.URI+`"
+			}`)
+
+			err := a.handleDeleteActivity(act, tt.signer)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("handleDeleteActivity error = %v, want error %v", err, tt.wantErr)
+			}
+
+			_, err = a.noteModel.Get(target.ID)
+			if deleted := err == sql.ErrNoRows; deleted == tt.wantErr {
+				t.Errorf("note deleted = %v, want %v", deleted, !tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDeleteActivityUnknownNote(t *testing.T) {
+	a, _, _ := newTestAPI(t)
+	act := parseActivity(t, `{"type": "Delete", "actor": "`+testAuthor+`", "object": "https://remote.example/notes/404"}`)
+	if err := a.handleDeleteActivity(act, testAuthor); err != nil {
+		t.Errorf("handleDeleteActivity = %v, want nil", err)
+	}
+}
+
+func TestCreateActivityAttribution(t *testing.T) {
+	tests := []struct {
+		name         string
+		id           string
+		attributedTo string
+		wantErr      bool
+	}{
+		{"own note", "https://remote.example/notes/2", testAuthor, false},
+		{"attributed to someone else", "https://remote.example/notes/2", testOther, true},
+		{"not attributed", "https://remote.example/notes/2", "", true},
+		{"hosted elsewhere", "https://evil.example/notes/2", testAuthor, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, _ := newTestAPI(t)
+			attributedTo := ""
+			if tt.attributedTo != "" {
+				attributedTo = `"attributedTo": "` + tt.attributedTo + `",`
+			}
+			act := parseActivity(t, `{
+				"type": "Create",
+				"actor": {"id": "`+testAuthor+`", "type": "Person", "preferredUsername": "bob", "url": "`+testAuthor+`"},
+				"object": {"id": "`+tt.id+`", "type": "Note", `+attributedTo+` "content": "hello",
+					"to": ["https://www.w3.org/ns/activitystreams#Public"]}
+			}`)
+
+			err := a.handleCreateActivity(act, testAuthor)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("handleCreateActivity error = %v, want error %v", err, tt.wantErr)
+			}
+
+			note, err := a.noteModel.GetByURI(tt.id)
+			if created := err == nil; created == tt.wantErr {
+				t.Fatalf("note created = %v, want %v", created, !tt.wantErr)
+			}
+			if err == nil && (note.AuthorURI != testAuthor || !strings.Contains(note.Content, "hello")) {
+				t.Errorf("created note = %+v", note)
+			}
+		})
+	}
+}
+
+func TestInboxBodyLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       int
+		wantStatus int
+	}{
+		// Bodies within the limit reach the signature check.
+		{"within limit", maxInboxBodySize, http.StatusUnauthorized},
+		{"too large", maxInboxBodySize + 1, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := strings.NewReader(strings.Repeat(" ", tt.size))
+			rec := httptest.NewRecorder()
+			newSignatureTestAPI().Inbox(rec, httptest.NewRequest(http.MethodPost, "/inbox", body))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package ap
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"knife/db"
+)
+
+// collectionPageSize is the number of items served per OrderedCollectionPage.
+const collectionPageSize = 20
+
+// parsePageParam returns the requested page number, or 0 when the request
+// asks for the collection itself rather than one of its pages.
+func parsePageParam(r *http.Request) (int, error) {
+	pageStr := r.URL.Query().Get("page")
+	if pageStr == "" {
+		return 0, nil
+	}
+	page, err := strconv.Atoi(pageStr)
+	if err != nil || page < 1 {
+		return 0, fmt.Errorf("invalid page %q", pageStr)
+	}
+	return page, nil
+}
+
+// orderedCollection builds the top-level OrderedCollection that links to its first page.
+func orderedCollection(id string, totalItems int) map[string]interface{} {
+	collection := map[string]interface{}{
+		"@context":   "https://www.w3.org/ns/activitystreams",
+		"id":         id,
+		"type":       "OrderedCollection",
+		"totalItems": totalItems,
+		"first":      fmt.Sprintf("%s?page=1", id),
+	}
+	if totalItems > 0 {
+		lastPage := (totalItems + collectionPageSize - 1) / collectionPageSize
+		collection["last"] = fmt.Sprintf("%s?page=%d", id, lastPage)
+	}
+	return collection
+}
+
+// orderedCollectionPage builds one page of the collection identified by id.
+func orderedCollectionPage(id string, page int, totalItems int, items []interface{}) map[string]interface{} {
+	collectionPage := map[string]interface{}{
+		"@context":     "https://www.w3.org/ns/activitystreams",
+		"id":           fmt.Sprintf("%s?page=%d", id, page),
+		"type":         "OrderedCollectionPage",
+		"partOf":       id,
+		"totalItems":   totalItems,
+		"orderedItems": items,
+	}
+	if page*collectionPageSize < totalItems {
+		collectionPage["next"] = fmt.Sprintf("%s?page=%d", id, page+1)
+	}
+	if page > 1 {
+		collectionPage["prev"] = fmt.Sprintf("%s?page=%d", id, page-1)
+	}
+	return collectionPage
+}
+
+func writeActivityJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/activity+json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to encode activity json: %v", err)
+	}
+}
+
+// Outbox serves the local public and unlisted notes as Create activities,
+// and our boosts as Announce activities.
+func (a *ActivityPubAPI) Outbox(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePageParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	baseURL := a.cfg.BaseURL
+	id := baseURL + "/outbox"
+
+	total, err := a.noteModel.CountMyPublic()
+	if err != nil {
+		log.Printf("Outbox: failed to count notes: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if page == 0 {
+		writeActivityJSON(w, orderedCollection(id, total))
+		return
+	}
+
+	notes, err := a.noteModel.ListMyPublic(collectionPageSize, (page-1)*collectionPageSize)
+	if err != nil {
+		log.Printf("Outbox: failed to list notes: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]interface{}, 0, len(notes))
+	for i := range notes {
+		if notes[i].BoostOf != 0 {
+			activity := GenerateAnnounceActivity(&notes[i], baseURL)
+			delete(activity, "@context")
+			items = append(items, activity)
+			continue
+		}
+		activity := GenerateCreateActivity(&notes[i], baseURL)
+		delete(activity, "@context")
+		items = append(items, activity)
+	}
+
+	writeActivityJSON(w, orderedCollectionPage(id, page, total, items))
+}
+
+// Followers serves the actors following us. When the owner hides their
+// network, only totalItems is published.
+func (a *ActivityPubAPI) Followers(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePageParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	profile, err := a.profileModel.Get()
+	if err != nil {
+		http.Error(w, "profile not found", http.StatusNotFound)
+		return
+	}
+
+	id := a.cfg.BaseURL + "/followers"
+	total, err := a.followerModel.CountFollowers()
+	if err != nil {
+		log.Printf("Followers: failed to count followers: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if profile.HideNetwork {
+		writeActivityJSON(w, map[string]interface{}{
+			"@context":   "https://www.w3.org/ns/activitystreams",
+			"id":         id,
+			"type":       "OrderedCollection",
+			"totalItems": total,
+		})
+		return
+	}
+
+	if page == 0 {
+		writeActivityJSON(w, orderedCollection(id, total))
+		return
+	}
+
+	followers, err := a.followerModel.ListFollowersPage(collectionPageSize, (page-1)*collectionPageSize)
+	if err != nil {
+		log.Printf("Followers: failed to list followers: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]interface{}, 0, len(followers))
+	for _, follower := range followers {
+		items = append(items, follower.ActorURI)
+	}
+
+	writeActivityJSON(w, orderedCollectionPage(id, page, total, items))
+}
+
+// Following serves the accepted follows of the owner. When the owner hides
+// their network, only totalItems is published.
+func (a *ActivityPubAPI) Following(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePageParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	profile, err := a.profileModel.Get()
+	if err != nil {
+		http.Error(w, "profile not found", http.StatusNotFound)
+		return
+	}
+
+	id := a.cfg.BaseURL + "/following"
+	total, err := a.followingModel.CountAccepted()
+	if err != nil {
+		log.Printf("Following: failed to count following: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if profile.HideNetwork {
+		writeActivityJSON(w, map[string]interface{}{
+			"@context":   "https://www.w3.org/ns/activitystreams",
+			"id":         id,
+			"type":       "OrderedCollection",
+			"totalItems": total,
+		})
+		return
+	}
+
+	if page == 0 {
+		writeActivityJSON(w, orderedCollection(id, total))
+		return
+	}
+
+	following, err := a.followingModel.ListAcceptedPage(collectionPageSize, (page-1)*collectionPageSize)
+	if err != nil {
+		log.Printf("Following: failed to list following: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]interface{}, 0, len(following))
+	for _, f := range following {
+		items = append(items, f.ActorURI)
+	}
+
+	writeActivityJSON(w, orderedCollectionPage(id, page, total, items))
+}
+
+// Tag serves the local public notes carrying a hashtag.
+func (a *ActivityPubAPI) Tag(w http.ResponseWriter, r *http.Request) {
+	name := NormalizeTag(strings.TrimPrefix(r.URL.Path, "/tags/"))
+	if name == "" || strings.Contains(name, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	page, err := parsePageParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	baseURL := a.cfg.BaseURL
+	id := TagURL(baseURL, name)
+
+	total, err := a.noteModel.CountMyPublicByTag(name)
+	if err != nil {
+		log.Printf("Tag: failed to count notes: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if page == 0 {
+		writeActivityJSON(w, orderedCollection(id, total))
+		return
+	}
+
+	notes, err := a.noteModel.ListMyPublicByTag(name, collectionPageSize, (page-1)*collectionPageSize)
+	if err != nil {
+		log.Printf("Tag: failed to list notes: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]interface{}, 0, len(notes))
+	for i := range notes {
+		items = append(items, fmt.Sprintf("%s/notes/%d", baseURL, notes[i].ID))
+	}
+
+	writeActivityJSON(w, orderedCollectionPage(id, page, total, items))
+}
+
+// replies serves the public and unlisted replies to note.
+func (a *ActivityPubAPI) replies(w http.ResponseWriter, r *http.Request, note *db.Note) {
+	page, err := parsePageParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	baseURL := a.cfg.BaseURL
+	id := fmt.Sprintf("%s/notes/%d/replies", baseURL, note.ID)
+
+	total, err := a.noteModel.CountReplies(note.URI, db.NoteViewer{})
+	if err != nil {
+		log.Printf("Replies: failed to count replies: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if page == 0 {
+		writeActivityJSON(w, orderedCollection(id, total))
+		return
+	}
+
+	replies, err := a.noteModel.ListReplies(note.URI, db.NoteViewer{}, collectionPageSize, (page-1)*collectionPageSize)
+	if err != nil {
+		log.Printf("Replies: failed to list replies: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]interface{}, 0, len(replies))
+	for i := range replies {
+		items = append(items, NoteIRI(&replies[i], baseURL))
+	}
+
+	writeActivityJSON(w, orderedCollectionPage(id, page, total, items))
+}
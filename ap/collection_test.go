@@ -0,0 +1,64 @@
+package ap
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"knife/db"
+)
+
+func TestOutboxCreateActivities(t *testing.T) {
+	a, _, _ := newTestAPI(t)
+
+	// Stored under an older base URL than the configured one.
+	for _, publicRange := range []db.NotePublicRange{db.NotePublicRangePublic, db.NotePublicRangeUnlisted} {
+		note := &db.Note{Content: "hello", Host: "knife.example", AuthorFinger: "alice", PublicRange: publicRange}
+		if err := a.noteModel.CreateLocalNote(note, "http://knife.example"); err != nil {
+			t.Fatalf("CreateLocalNote: %v", err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	a.Outbox(rec, httptest.NewRequest(http.MethodGet, "/outbox?page=1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+
+	var page struct {
+		OrderedItems []struct {
+			ID     string          `json:"id"`
+			Type   string          `json:"type"`
+			To     json.RawMessage `json:"to"`
+			Cc     json.RawMessage `json:"cc"`
+			Object struct {
+				ID string          `json:"id"`
+				To json.RawMessage `json:"to"`
+				Cc json.RawMessage `json:"cc"`
+			} `json:"object"`
+		} `json:"orderedItems"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.OrderedItems) != 2 {
+		t.Fatalf("got %d items, want 2: %s", len(page.OrderedItems), rec.Body)
+	}
+
+	for _, item := range page.OrderedItems {
+		var id int64
+		if _, err := fmt.Sscanf(item.Object.ID, a.cfg.BaseURL+"/notes/%d", &id); err != nil {
+			t.Errorf("object id %q is not under %s", item.Object.ID, a.cfg.BaseURL)
+		}
+		if item.ID != item.Object.ID+"#create" {
+			t.Errorf("Create id = %q, want %q", item.ID, item.Object.ID+"#create")
+		}
+		for name, value := range map[string]json.RawMessage{"to": item.To, "cc": item.Cc, "object.to": item.Object.To, "object.cc": item.Object.Cc} {
+			if len(value) == 0 || value[0] != '[' {
+				t.Errorf("%s = %s, want an array", name, value)
+			}
+		}
+	}
+}
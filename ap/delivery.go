@@ -0,0 +1,226 @@
+package ap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"knife/db"
+)
+
+const (
+	// deliveryPollInterval is how often the delivery table is checked for
+	// work when nothing new has been queued.
+	deliveryPollInterval = 15 * time.Second
+	// deliveryLease is how long a claimed delivery is hidden from other
+	// claims while it is being sent.
+	deliveryLease = 10 * time.Minute
+	// deliveryBatchSize is the number of deliveries claimed per poll.
+	deliveryBatchSize = 50
+	// deliveryBaseBackoff is the delay after the first failed attempt. It
+	// doubles with every attempt up to deliveryMaxBackoff.
+	deliveryBaseBackoff = time.Minute
+	deliveryMaxBackoff  = 12 * time.Hour
+	// maxDeliveryAttempts spreads retries over roughly three days before a
+	// delivery is given up and its inbox is marked dead.
+	maxDeliveryAttempts = 15
+)
+
+// permanentError marks a delivery failure that retrying will not fix, such
+// as the remote server rejecting the activity with a 4xx status.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// deliveryBackoff returns the delay before the next attempt once a delivery
+// has failed attempts times.
+func deliveryBackoff(attempts int) time.Duration {
+	delay := deliveryBaseBackoff
+	for i := 1; i < attempts && delay < deliveryMaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, deliveryMaxBackoff)
+}
+
+// deliver stores an activity for delivery to inboxURI, signed as actorURI.
+// It is sent by the delivery loop, which retries it until it succeeds.
+func (d *ActivityDispatcher) deliver(inboxURI string, activityBytes []byte, actorURI string) {
+	delivery := &db.Delivery{
+		InboxURI: inboxURI,
+		ActorURI: actorURI,
+		Payload:  string(activityBytes),
+	}
+	if err := d.deliveryModel.Create(delivery); err != nil {
+		log.Printf("failed to queue delivery to %s: %v", inboxURI, err)
+		return
+	}
+	d.wakeDeliveries()
+}
+
+// RetryDelivery puts a failed delivery back in the queue and sends it on
+// the next pass of the delivery loop.
+func (d *ActivityDispatcher) RetryDelivery(id int64) (*db.Delivery, error) {
+	delivery, err := d.deliveryModel.Retry(id)
+	if err != nil {
+		return nil, err
+	}
+	d.wakeDeliveries()
+	return delivery, nil
+}
+
+// wakeDeliveries wakes the delivery loop without blocking when it is
+// already awake.
+func (d *ActivityDispatcher) wakeDeliveries() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// StartDeliveries starts the loop that sends queued deliveries. Deliveries
+// left over from a previous run are picked up as well.
+func (d *ActivityDispatcher) StartDeliveries() {
+	go func() {
+		defer close(d.loopDone)
+		ticker := time.NewTicker(deliveryPollInterval)
+		defer ticker.Stop()
+		for {
+			d.dispatchDue()
+			select {
+			case <-ticker.C:
+			case <-d.wake:
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopDeliveries stops the delivery loop and the job queue. Deliveries
+// being sent are given until ctx is done to finish. The ones that were
+// claimed but not sent stay in the database and are due again on the next
+// start.
+func (d *ActivityDispatcher) StopDeliveries(ctx context.Context) error {
+	close(d.stop)
+	queueErr := d.jobQueue.Stop(ctx)
+
+	select {
+	case <-d.loopDone:
+	case <-ctx.Done():
+	}
+
+	d.claimedMu.Lock()
+	ids := make([]int64, 0, len(d.claimed))
+	for id := range d.claimed {
+		ids = append(ids, id)
+	}
+	d.claimedMu.Unlock()
+
+	if err := d.deliveryModel.Release(ids); err != nil {
+		return fmt.Errorf("failed to release deliveries: %w", err)
+	}
+	return queueErr
+}
+
+// dispatchDue hands every due delivery to the job queue, which limits how
+// many are sent to each host at once.
+func (d *ActivityDispatcher) dispatchDue() {
+	for {
+		select {
+		case <-d.stop:
+			return
+		default:
+		}
+
+		deliveries, err := d.deliveryModel.ClaimDue(deliveryLease, deliveryBatchSize)
+		if err != nil {
+			log.Printf("failed to claim deliveries: %v", err)
+			return
+		}
+
+		d.claimedMu.Lock()
+		for _, delivery := range deliveries {
+			d.claimed[delivery.ID] = struct{}{}
+		}
+		d.claimedMu.Unlock()
+
+		for _, delivery := range deliveries {
+			delivery := delivery // Create a new variable for the closure
+			d.jobQueue.Enqueue(inboxHost(delivery.InboxURI), func() {
+				d.attemptDelivery(&delivery)
+				d.claimedMu.Lock()
+				delete(d.claimed, delivery.ID)
+				d.claimedMu.Unlock()
+			})
+		}
+
+		if len(deliveries) < deliveryBatchSize {
+			return
+		}
+	}
+}
+
+// inboxHost returns the host deliveries to inboxURI are limited by.
+func inboxHost(inboxURI string) string {
+	u, err := url.Parse(inboxURI)
+	if err != nil {
+		return inboxURI
+	}
+	return u.Host
+}
+
+// attemptDelivery sends one delivery and records the outcome.
+func (d *ActivityDispatcher) attemptDelivery(delivery *db.Delivery) {
+	dead, err := d.deliveryModel.IsInboxDead(delivery.InboxURI)
+	if err != nil {
+		log.Printf("failed to check inbox %s: %v", delivery.InboxURI, err)
+		return
+	}
+	if dead {
+		if err := d.deliveryModel.MarkFailed(delivery.ID, delivery.Attempts, "inbox is marked dead"); err != nil {
+			log.Printf("failed to update delivery %d: %v", delivery.ID, err)
+		}
+		return
+	}
+
+	err = d.sendActivityToInbox(delivery.InboxURI, []byte(delivery.Payload), delivery.ActorURI)
+	if err == nil {
+		if err := d.deliveryModel.Delete(delivery.ID); err != nil {
+			log.Printf("failed to remove delivery %d: %v", delivery.ID, err)
+		}
+		return
+	}
+
+	attempts := delivery.Attempts + 1
+	log.Printf("delivery %d to %s failed (attempt %d): %v", delivery.ID, delivery.InboxURI, attempts, err)
+
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		err = d.deliveryModel.MarkFailed(delivery.ID, attempts, err.Error())
+	} else if attempts >= maxDeliveryAttempts {
+		err = d.giveUp(delivery, attempts, err)
+	} else {
+		err = d.deliveryModel.Reschedule(delivery.ID, attempts, time.Now().Add(deliveryBackoff(attempts)), err.Error())
+	}
+	if err != nil {
+		log.Printf("failed to update delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// giveUp fails a delivery that ran out of attempts and marks its inbox dead.
+func (d *ActivityDispatcher) giveUp(delivery *db.Delivery, attempts int, cause error) error {
+	log.Printf("giving up on delivery %d, marking inbox %s dead", delivery.ID, delivery.InboxURI)
+	if err := d.deliveryModel.MarkFailed(delivery.ID, attempts, cause.Error()); err != nil {
+		return err
+	}
+	if err := d.deliveryModel.MarkInboxDead(delivery.InboxURI, cause.Error()); err != nil {
+		return fmt.Errorf("failed to mark inbox dead: %w", err)
+	}
+	return nil
+}
@@ -10,66 +10,96 @@ import (
 	"log"
 	"net/http"
 	"net/url"
-	"os"
+	"sync"
 	"time"
 
 	"knife/base"
+	"knife/config"
 	"knife/db"
 
 	"github.com/go-fed/httpsig"
 )
 
 type ActivityDispatcher struct {
-	followerModel *db.FollowerModel
-	httpsigModel  *db.HTTPSigModel
-	jobQueue      *base.JobQueue
+	cfg            *config.Config
+	fetcher        *Fetcher
+	followerModel  *db.FollowerModel
+	followingModel *db.FollowingModel
+	httpsigModel   *db.HTTPSigModel
+	deliveryModel  *db.DeliveryModel
+	jobQueue       *base.JobQueue
+	wake           chan struct{}
+	stop           chan struct{}
+	loopDone       chan struct{}
+
+	// claimed holds the IDs of deliveries handed to the job queue that
+	// have not finished yet.
+	claimedMu sync.Mutex
+	claimed   map[int64]struct{}
 }
 
-func NewActivityDispatcher(followerModel *db.FollowerModel, httpsigModel *db.HTTPSigModel, jobQueue *base.JobQueue) *ActivityDispatcher {
+func NewActivityDispatcher(cfg *config.Config, fetcher *Fetcher, followerModel *db.FollowerModel, followingModel *db.FollowingModel, httpsigModel *db.HTTPSigModel, deliveryModel *db.DeliveryModel, jobQueue *base.JobQueue) *ActivityDispatcher {
 	return &ActivityDispatcher{
-		followerModel: followerModel,
-		httpsigModel:  httpsigModel,
-		jobQueue:      jobQueue,
+		cfg:            cfg,
+		fetcher:        fetcher,
+		followerModel:  followerModel,
+		followingModel: followingModel,
+		httpsigModel:   httpsigModel,
+		deliveryModel:  deliveryModel,
+		jobQueue:       jobQueue,
+		wake:           make(chan struct{}, 1),
+		stop:           make(chan struct{}),
+		loopDone:       make(chan struct{}),
+		claimed:        make(map[int64]struct{}),
 	}
 }
 
-func (d *ActivityDispatcher) getProtocol() string {
-	if proto := os.Getenv("KNIFE_PROTOCOL"); proto != "" {
-		return proto
+// SendCreateNote dispatches a Create activity for a Note to all followers
+// and mentioned actors. Recipients sharing an inbox receive it once.
+func (d *ActivityDispatcher) SendCreateNote(note *db.Note) error {
+	inboxes, err := d.noteInboxes(note)
+	if err != nil {
+		log.Printf("failed to list inboxes: %v", err)
+		return err
+	}
+
+	baseURL := d.cfg.BaseURL
+	actorURI := baseURL + "/profile"
+	activity := GenerateCreateActivity(note, baseURL)
+
+	activityBytes, err := json.Marshal(activity)
+	if err != nil {
+		log.Printf("failed to marshal activity: %v", err)
+		return err
 	}
-	return "https"
-}
 
-func (d *ActivityDispatcher) getHost(fallback string) string {
-	if host := os.Getenv("KNIFE_HOST"); host != "" {
-		return host
+	for _, inbox := range inboxes {
+		d.deliver(inbox, activityBytes, actorURI)
 	}
-	return fallback
-}
 
-func (d *ActivityDispatcher) getBaseURL(fallbackHost string) string {
-	return fmt.Sprintf("%s://%s", d.getProtocol(), d.getHost(fallbackHost))
+	return nil
 }
 
-// SendCreateNote dispatches a Create activity for a Note to all followers.
-func (d *ActivityDispatcher) SendCreateNote(note *db.Note) error {
-	followers, err := d.followerModel.ListFollowers()
+// SendUpdateNote dispatches an Update activity for an edited Note to its recipients.
+func (d *ActivityDispatcher) SendUpdateNote(note *db.Note) error {
+	inboxes, err := d.noteInboxes(note)
 	if err != nil {
-		log.Printf("failed to list followers: %v", err)
+		log.Printf("failed to list inboxes: %v", err)
 		return err
 	}
 
-	baseURL := d.getBaseURL(note.Host)
+	baseURL := d.cfg.BaseURL
 	actorURI := baseURL + "/profile"
 	apNote := GenerateAPNote(note, baseURL)
-	// Ensure the ID in the activity matches the canonical URL
-	apNote["id"] = baseURL + "/notes/" + fmt.Sprintf("%d", note.ID)
+	delete(apNote, "@context")
 
 	activity := map[string]interface{}{
 		"@context": "https://www.w3.org/ns/activitystreams",
-		"id":       note.URI,//fmt.Sprintf("%s/activities/create-%d", baseURL, note.ID),
-		"type":     "Create",
+		"id":       fmt.Sprintf("%s#update-%d", apNote["id"], note.UpdateTime.Unix()),
+		"type":     "Update",
 		"actor":    actorURI,
+		"to":       apNote["to"],
+		"cc":       apNote["cc"],
 		"object":   apNote,
 	}
 
@@ -79,84 +109,153 @@ func (d *ActivityDispatcher) SendCreateNote(note *db.Note) error {
 		return err
 	}
 
-	for _, follower := range followers {
-		follower := follower // Create a new variable for the closure
-		job := func() {
-			d.sendActivityToFollower(follower, activityBytes, actorURI)
-		}
-		d.jobQueue.Enqueue(job)
+	for _, inbox := range inboxes {
+		d.deliver(inbox, activityBytes, actorURI)
 	}
 
 	return nil
 }
 
-// SendDeleteNote dispatches a Delete activity for a Note to all followers.
+// SendDeleteNote dispatches a Delete activity for a Note to its recipients.
 func (d *ActivityDispatcher) SendDeleteNote(note *db.Note) error {
-	followers, err := d.followerModel.ListFollowers()
+	inboxes, err := d.noteInboxes(note)
 	if err != nil {
-		log.Printf("failed to list followers: %v", err)
+		log.Printf("failed to list inboxes: %v", err)
 		return err
 	}
 
-	baseURL := d.getBaseURL(note.Host)
+	baseURL := d.cfg.BaseURL
 	actorURI := baseURL + "/profile"
+	activity := GenerateDeleteActivity(note, baseURL)
+	activityBytes, err := json.Marshal(activity)
+	if err != nil {
+		log.Printf("failed to marshal activity: %v", err)
+		return err
+	}
+
+	for _, inbox := range inboxes {
+		d.deliver(inbox, activityBytes, actorURI)
+	}
+
+	return nil
+}
+
+// Follow resolves an account through WebFinger, records it as pending and
+// sends it a Follow activity.
+func (d *ActivityDispatcher) Follow(account string) (*db.Following, error) {
+	user, accountHost, err := ParseAccount(account)
+	if err != nil {
+		return nil, err
+	}
+
+	actorIRI, err := d.fetcher.resolveAccount(account)
+	if err != nil {
+		return nil, err
+	}
+	actor, err := d.fetcher.fetchActor(actorIRI)
+	if err != nil {
+		return nil, err
+	}
+	inboxURI := actor.Inbox.GetLink().String()
+	if inboxURI == "" {
+		return nil, fmt.Errorf("actor %s has no inbox URI", actor.GetID())
+	}
+
+	baseURL := d.cfg.BaseURL
+	actorURI := baseURL + "/profile"
+	following := &db.Following{
+		ActorURI: actor.GetID().String(),
+		InboxURI: inboxURI,
+		Acct:     user + "@" + accountHost,
+		FollowID: fmt.Sprintf("%s/activities/follow-%d", baseURL, time.Now().UnixNano()),
+		State:    db.FollowingStatePending,
+	}
+	if err := d.followingModel.AddFollowing(following); err != nil {
+		return nil, err
+	}
+
 	activity := map[string]interface{}{
 		"@context": "https://www.w3.org/ns/activitystreams",
-		"id":       note.URI,//fmt.Sprintf("%s/activities/delete-%d-%d", baseURL, note.ID, time.Now().Unix()),
-		"type":     "Delete",
+		"id":       following.FollowID,
+		"type":     "Follow",
 		"actor":    actorURI,
-		"object":   note.URI,
+		"object":   following.ActorURI,
 	}
 	activityBytes, err := json.Marshal(activity)
 	if err != nil {
-		log.Printf("failed to marshal activity: %v", err)
+		return nil, err
+	}
+
+	d.deliver(following.InboxURI, activityBytes, actorURI)
+
+	return following, nil
+}
+
+// Unfollow sends an Undo for our Follow of actorURI and forgets the follow.
+func (d *ActivityDispatcher) Unfollow(actorURI string) error {
+	following, err := d.followingModel.Get(actorURI)
+	if err != nil {
 		return err
 	}
 
-	for _, follower := range followers {
-		follower := follower // Create a new variable for the closure
-		job := func() {
-			d.sendActivityToFollower(follower, activityBytes, actorURI)
-		}
-		d.jobQueue.Enqueue(job)
+	baseURL := d.cfg.BaseURL
+	myActorURI := baseURL + "/profile"
+	activity := map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id":       following.FollowID + "/undo",
+		"type":     "Undo",
+		"actor":    myActorURI,
+		"object": map[string]interface{}{
+			"id":     following.FollowID,
+			"type":   "Follow",
+			"actor":  myActorURI,
+			"object": following.ActorURI,
+		},
+	}
+	activityBytes, err := json.Marshal(activity)
+	if err != nil {
+		return err
 	}
 
+	if err := d.followingModel.RemoveFollowing(actorURI); err != nil {
+		return err
+	}
+
+	d.deliver(following.InboxURI, activityBytes, myActorURI)
+
 	return nil
 }
 
-func (d *ActivityDispatcher) sendActivityToFollower(follower db.Follower, activityBytes []byte, actorURI string) {
-	req, err := http.NewRequest("POST", follower.InboxURI, bytes.NewBuffer(activityBytes))
+// sendActivityToInbox signs and POSTs an activity to an inbox. Rejections
+// with a 4xx status other than 408 and 429 are returned as permanentError.
+func (d *ActivityDispatcher) sendActivityToInbox(inboxURI string, activityBytes []byte, actorURI string) error {
+	req, err := http.NewRequest("POST", inboxURI, bytes.NewBuffer(activityBytes))
 	if err != nil {
-		log.Printf("failed to create request for follower %s: %v", follower.ActorURI, err)
-		return
+		return &permanentError{fmt.Errorf("failed to create request for inbox %s: %w", inboxURI, err)}
 	}
 	
 	req.Header.Set("Content-Type", "application/activity+json")
 	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
 	
-	inboxURL, err := url.Parse(follower.InboxURI)
+	inboxURL, err := url.Parse(inboxURI)
 	if err != nil {
-		log.Printf("failed to parse inbox url for follower %s: %v", follower.ActorURI, err)
-		return
+		return &permanentError{fmt.Errorf("failed to parse inbox url %s: %w", inboxURI, err)}
 	}
 	req.Header.Set("Host", inboxURL.Host)
 	req.Host = inboxURL.Host
 
 	sig, err := d.httpsigModel.GetByActor(actorURI)
 	if err != nil {
-		log.Printf("failed to get httpsig for %s: %v", actorURI, err)
-		return
+		return fmt.Errorf("failed to get httpsig for %s: %w", actorURI, err)
 	}
 
 	block, _ := pem.Decode([]byte(sig.PrivateKey))
 	if block == nil {
-		log.Printf("failed to decode private key for %s", actorURI)
-		return
+		return fmt.Errorf("failed to decode private key for %s", actorURI)
 	}
 	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
 	if err != nil {
-		log.Printf("failed to parse private key for %s: %v", actorURI, err)
-		return
+		return fmt.Errorf("failed to parse private key for %s: %w", actorURI, err)
 	}
 
 	// Sign the request
@@ -166,29 +265,30 @@ func (d *ActivityDispatcher) sendActivityToFollower(follower db.Follower, activi
 	headersToSign := []string{httpsig.RequestTarget, "host", "date", "digest"}
 	signer, _, err := httpsig.NewSigner(prefs, digestAlgo, headersToSign, httpsig.Signature, 65535)
 	if err != nil {
-		log.Printf("failed to create signer for %s: %v", actorURI, err)
-		return
+		return fmt.Errorf("failed to create signer for %s: %w", actorURI, err)
 	}
 	if err := signer.SignRequest(privateKey, keyID, req, activityBytes); err != nil {
-		log.Printf("failed to sign request for %s: %v", follower.ActorURI, err)
-		return
+		return fmt.Errorf("failed to sign request for %s: %w", inboxURI, err)
 	}
 
-	log.Printf("Sending activity to %s. Headers: Digest=%s, Signature=%s", follower.ActorURI, req.Header.Get("Digest"), req.Header.Get("Signature"))
+	log.Printf("Sending activity to %s", inboxURI)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := d.fetcher.client.Do(req)
 	if err != nil {
-		log.Printf("failed to send activity to follower %s: %v", follower.ActorURI, err)
-		return
+		return fmt.Errorf("failed to send activity to inbox %s: %w", inboxURI, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		// Read body for error details
-		b, _ := io.ReadAll(resp.Body)
-		log.Printf("follower %s returned status %d: %s", follower.ActorURI, resp.StatusCode, string(b))
-	} else {
-		log.Printf("Successfully sent activity to follower %s", follower.ActorURI)
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		err := fmt.Errorf("inbox %s returned status %d: %s", inboxURI, resp.StatusCode, string(b))
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return &permanentError{err}
+		}
+		return err
 	}
+
+	log.Printf("Successfully sent activity to inbox %s", inboxURI)
+	return nil
 }
@@ -0,0 +1,139 @@
+package ap
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"knife/config"
+
+	"github.com/go-ap/activitypub"
+)
+
+// Fetcher retrieves remote ActivityPub documents.
+type Fetcher struct {
+	devMode bool
+	client  *http.Client
+}
+
+func NewFetcher(cfg *config.Config) *Fetcher {
+	return &Fetcher{devMode: cfg.DevMode, client: newRemoteClient(cfg.DevMode)}
+}
+
+// newRemoteClient returns the client for requests to remote servers. Unless
+// devMode is on, it refuses to connect to loopback and private addresses.
+// The check is made on the address being dialled, so a host cannot pass
+// validateIRI and then resolve to a private address.
+func newRemoteClient(devMode bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !devMode {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isInternalIP(ip) {
+				return fmt.Errorf("refusing to connect to internal address %s", host)
+			}
+			return nil
+		}
+		// A proxy would be dialled instead of the remote server.
+		transport.Proxy = nil
+	}
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: 30 * time.Second, Transport: transport}
+}
+
+// isInternalIP reports whether ip is a loopback, private, link-local or
+// otherwise non-public address.
+func isInternalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast()
+}
+
+// fetchActor fetches an ActivityPub Actor from the given IRI. The fetched
+// document must have the IRI as its id.
+func (f *Fetcher) fetchActor(iri string) (*activitypub.Actor, error) {
+	if err := f.validateIRI(iri); err != nil {
+		return nil, fmt.Errorf("fetchActor: invalid IRI: %w", err)
+	}
+
+	// Create a GET request to fetch the actor
+	req, err := http.NewRequest("GET", iri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetchActor: failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/activity+json")
+
+	// Send the request
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetchActor: failed to fetch actor: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Check for non-2xx status codes
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("fetchActor: unexpected status code %d: %s", resp.StatusCode, string(body))
+	}
+
+	// Read and parse the response body
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("fetchActor: failed to read response body: %w", err)
+	}
+
+	item, err := activitypub.UnmarshalJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("fetchActor: failed to unmarshal JSON: %w", err)
+	}
+
+	actor, err := activitypub.ToActor(item)
+	if err != nil {
+		return nil, fmt.Errorf("fetchActor: item is not an actor: %w", err)
+	}
+
+	// A document may only speak for the actor at its own address.
+	if actor.GetID().String() != iri {
+		return nil, fmt.Errorf("fetchActor: document at %s claims to be actor %s", iri, actor.GetID())
+	}
+
+	return actor, nil
+}
+
+// validateIRI refuses IRIs that are not http(s) or that resolve to loopback
+// or private addresses, unless dev mode is on.
+func (f *Fetcher) validateIRI(iri string) error {
+	u, err := url.Parse(iri)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme: %s", u.Scheme)
+	}
+
+	if f.devMode {
+		return nil
+	}
+
+	hostname := u.Hostname()
+	ips, err := net.LookupIP(hostname)
+	if err != nil {
+		return err
+	}
+
+	for _, ip := range ips {
+		if isInternalIP(ip) {
+			return fmt.Errorf("resolves to private/loopback IP: %s", ip.String())
+		}
+	}
+
+	return nil
+}
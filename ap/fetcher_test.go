@@ -0,0 +1,95 @@
+package ap
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsInternalIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"fe80::1", true},
+		{"fd00::1", true},
+		{"0.0.0.0", true},
+		{"224.0.0.1", true},
+		{"93.184.216.34", false},
+		{"2606:2800:220:1:248:1893:25c8:1946", false},
+	}
+	for _, tt := range tests {
+		if got := isInternalIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isInternalIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestRemoteClientRefusesInternalAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		devMode bool
+		wantErr bool
+	}{
+		{"production", false, true},
+		{"dev mode", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := newRemoteClient(tt.devMode).Post(srv.URL+"/inbox", "application/activity+json", nil)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("POST to %s error = %v, want error %v", srv.URL, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFetchActorChecksID(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := srv.URL + r.URL.Path
+		if r.URL.Path == "/spoofed" {
+			id = "https://mastodon.social/users/alice"
+		}
+		w.Header().Set("Content-Type", "application/activity+json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"@context": "https://www.w3.org/ns/activitystreams",
+			"id":       id,
+			"type":     "Person",
+			"inbox":    id + "/inbox",
+		})
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{"/users/bob", false},
+		{"/spoofed", true},
+	}
+	f := &Fetcher{devMode: true, client: http.DefaultClient}
+	for _, tt := range tests {
+		actor, err := f.fetchActor(srv.URL + tt.path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("fetchActor(%s) error = %v, want error %v", tt.path, err, tt.wantErr)
+		}
+		if err == nil && actor.GetID().String() != srv.URL+tt.path {
+			t.Errorf("fetchActor(%s) id = %s", tt.path, actor.GetID())
+		}
+	}
+}
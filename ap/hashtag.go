@@ -0,0 +1,67 @@
+package ap
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/go-ap/activitypub"
+	"github.com/valyala/fastjson"
+)
+
+// HashtagType is the Mastodon extension type of hashtag tags.
+const HashtagType activitypub.ActivityVocabularyType = "Hashtag"
+
+func init() {
+	// go-ap does not know Hashtag and drops such tags while decoding, so
+	// they are registered and loaded as plain links.
+	activitypub.LinkTypes = append(activitypub.LinkTypes, HashtagType)
+	activitypub.ItemTyperFunc = func(typ activitypub.ActivityVocabularyType) (activitypub.Item, error) {
+		if typ == HashtagType {
+			return &activitypub.Link{Type: typ}, nil
+		}
+		return activitypub.GetItemByType(typ)
+	}
+	activitypub.JSONItemUnmarshal = func(typ activitypub.ActivityVocabularyType, val *fastjson.Value, item activitypub.Item) error {
+		return activitypub.OnLink(item, func(link *activitypub.Link) error {
+			loaded, err := activitypub.JSONLoadLink(val)
+			if err != nil {
+				return err
+			}
+			*link = *loaded.(*activitypub.Link)
+			return nil
+		})
+	}
+}
+
+// NormalizeTag returns the stored form of a hashtag name.
+func NormalizeTag(name string) string {
+	return strings.ToLower(strings.TrimPrefix(name, "#"))
+}
+
+// TagURL returns the address of the page of a tag.
+func TagURL(baseURL, tag string) string {
+	return baseURL + "/tags/" + url.PathEscape(tag)
+}
+
+// objectTags returns the normalized names of the hashtags of obj.
+func objectTags(obj *activitypub.Object) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, item := range obj.Tag {
+		if item == nil || item.GetType() != HashtagType {
+			continue
+		}
+		var name string
+		activitypub.OnLink(item, func(link *activitypub.Link) error {
+			name = link.Name.First().String()
+			return nil
+		})
+		tag := NormalizeTag(strings.TrimSpace(name))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
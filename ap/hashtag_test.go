@@ -0,0 +1,53 @@
+package ap
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/go-ap/activitypub"
+)
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"go", "go"},
+		{"#Go", "go"},
+		{"GoLang", "golang"},
+		{"한국어", "한국어"},
+		{"ÄÖÜ", "äöü"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeTag(tt.name); got != tt.want {
+			t.Errorf("NormalizeTag(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestObjectTags(t *testing.T) {
+	tests := []struct {
+		name string
+		tags string
+		want []string
+	}{
+		{"none", `[]`, nil},
+		{"hashtags", `[{"type":"Hashtag","name":"#Go","href":"https://remote.example/tags/go"},{"type":"Hashtag","name":"#rust"}]`, []string{"go", "rust"}},
+		{"mentions are skipped", `[{"type":"Mention","name":"@bob@remote.example","href":"https://remote.example/users/bob"},{"type":"Hashtag","name":"#go"}]`, []string{"go"}},
+		{"duplicates", `[{"type":"Hashtag","name":"#Go"},{"type":"Hashtag","name":"#go"}]`, []string{"go"}},
+		{"blank names", `[{"type":"Hashtag","name":" "},{"type":"Hashtag","name":"#"},{"type":"Hashtag"}]`, nil},
+		{"whitespace", `[{"type":"Hashtag","name":" #Go "}]`, []string{"go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item, err := activitypub.UnmarshalJSON([]byte(`{"id":"https://remote.example/notes/1","type":"Note","tag":` + tt.tags + `}`))
+			if err != nil {
+				t.Fatalf("UnmarshalJSON: %v", err)
+			}
+			obj, err := activitypub.ToObject(item)
+			if err != nil {
+				t.Fatalf("ToObject: %v", err)
+			}
+			if got := objectTags(obj); !slices.Equal(got, tt.want) {
+				t.Errorf("objectTags = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
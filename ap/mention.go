@@ -0,0 +1,83 @@
+package ap
+
+import (
+	"fmt"
+	"strings"
+
+	"knife/db"
+)
+
+// ResolveMention looks up a mentioned account through WebFinger and returns
+// the actor to address. Accounts of this instance cannot be mentioned.
+func (d *ActivityDispatcher) ResolveMention(account string) (*db.NoteMention, error) {
+	user, host, err := ParseAccount(account)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(host, d.cfg.Host()) {
+		return nil, fmt.Errorf("%s@%s is a local account", user, host)
+	}
+
+	actorIRI, err := d.fetcher.resolveAccount(account)
+	if err != nil {
+		return nil, err
+	}
+	return d.MentionActor(actorIRI, user+"@"+host)
+}
+
+// MentionActor fetches the actor at actorURI, known as acct, and returns it
+// as a mention.
+func (d *ActivityDispatcher) MentionActor(actorURI, acct string) (*db.NoteMention, error) {
+	actor, err := d.fetcher.fetchActor(actorURI)
+	if err != nil {
+		return nil, err
+	}
+	inboxURI := actor.Inbox.GetLink().String()
+	if inboxURI == "" {
+		return nil, fmt.Errorf("actor %s has no inbox URI", actor.GetID())
+	}
+
+	// Link to the profile page when the actor has one.
+	profileURL := actor.GetID().String()
+	if actor.URL != nil && actor.URL.GetLink() != "" {
+		profileURL = actor.URL.GetLink().String()
+	}
+
+	return &db.NoteMention{
+		ActorURI:    actor.GetID().String(),
+		Acct:        acct,
+		URL:         profileURL,
+		InboxURI:    inboxURI,
+		SharedInbox: sharedInboxOf(actor, inboxURI),
+	}, nil
+}
+
+// noteInboxes returns the inboxes a note is delivered to: those of our
+// followers and of the mentioned actors. Private notes are direct
+// messages and only go to the mentioned actors.
+func (d *ActivityDispatcher) noteInboxes(note *db.Note) ([]string, error) {
+	var inboxes []string
+	if note.PublicRange != db.NotePublicRangePrivate {
+		var err error
+		inboxes, err = d.followerModel.ListDeliveryInboxes()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	seen := make(map[string]bool, len(inboxes))
+	for _, inbox := range inboxes {
+		seen[inbox] = true
+	}
+	for _, mention := range note.Mentions {
+		inbox := mention.InboxURI
+		if mention.SharedInbox != "" && note.PublicRange != db.NotePublicRangePrivate {
+			inbox = mention.SharedInbox
+		}
+		if !seen[inbox] {
+			seen[inbox] = true
+			inboxes = append(inboxes, inbox)
+		}
+	}
+	return inboxes, nil
+}
@@ -1,8 +1,11 @@
 package ap
 
 import (
+	"fmt"
 	"knife/db"
+	"slices"
 	"strings"
+	"time"
 
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
@@ -14,7 +17,7 @@ func GenerateAPNote(note *db.Note, baseURL string) map[string]interface{} {
 
 	apNote := map[string]interface{}{
 		"@context":     "https://www.w3.org/ns/activitystreams",
-		"id":           note.URI,
+		"id":           NoteIRI(note, baseURL),
 		"type":         "Note",
 		"published":    note.CreateTime.Format("2006-01-02T15:04:05Z"),
 		"attributedTo": baseURL + "/profile",
@@ -23,6 +26,60 @@ func GenerateAPNote(note *db.Note, baseURL string) map[string]interface{} {
 		"cc":           cc,
 	}
 
+	if note.ID != 0 {
+		apNote["replies"] = fmt.Sprintf("%s/notes/%d/replies", baseURL, note.ID)
+	}
+
+	if note.InReplyTo != "" {
+		apNote["inReplyTo"] = note.InReplyTo
+	}
+
+	if note.UpdateTime != nil {
+		apNote["updated"] = note.UpdateTime.UTC().Format("2006-01-02T15:04:05Z")
+	}
+
+	if note.Source != "" {
+		apNote["source"] = map[string]interface{}{
+			"content":   note.Source,
+			"mediaType": "text/markdown",
+		}
+	}
+
+	if len(note.Attachments) > 0 {
+		attachments := make([]map[string]interface{}, 0, len(note.Attachments))
+		for _, media := range note.Attachments {
+			attachments = append(attachments, map[string]interface{}{
+				"type":      attachmentType(media.MimeType),
+				"mediaType": media.MimeType,
+				"url":       baseURL + "/media/" + media.FileName,
+				"name":      media.Description,
+				"blurhash":  media.Blurhash,
+				"width":     media.Width,
+				"height":    media.Height,
+			})
+		}
+		apNote["attachment"] = attachments
+	}
+
+	if len(note.Tags) > 0 || len(note.Mentions) > 0 {
+		tags := make([]map[string]interface{}, 0, len(note.Tags)+len(note.Mentions))
+		for _, mention := range note.Mentions {
+			tags = append(tags, map[string]interface{}{
+				"type": "Mention",
+				"name": "@" + mention.Acct,
+				"href": mention.ActorURI,
+			})
+		}
+		for _, tag := range note.Tags {
+			tags = append(tags, map[string]interface{}{
+				"type": HashtagType,
+				"name": "#" + tag,
+				"href": TagURL(baseURL, tag),
+			})
+		}
+		apNote["tag"] = tags
+	}
+
 	if note.Cw != "" {
 		apNote["sensitive"] = true
 		apNote["summary"] = note.Cw
@@ -31,50 +88,125 @@ func GenerateAPNote(note *db.Note, baseURL string) map[string]interface{} {
 	return apNote
 }
 
+// attachmentType returns the ActivityStreams type of an attachment:
+// Image for images and Document for any other file.
+func attachmentType(mimeType string) string {
+	if strings.HasPrefix(mimeType, "image/") {
+		return "Image"
+	}
+	return "Document"
+}
+
+// GenerateCreateActivity wraps a note in the Create activity that announces it.
+func GenerateCreateActivity(note *db.Note, baseURL string) map[string]interface{} {
+	apNote := GenerateAPNote(note, baseURL)
+	delete(apNote, "@context")
+
+	return map[string]interface{}{
+		"@context":  "https://www.w3.org/ns/activitystreams",
+		"id":        apNote["id"].(string) + "#create",
+		"type":      "Create",
+		"actor":     baseURL + "/profile",
+		"published": apNote["published"],
+		"to":        apNote["to"],
+		"cc":        apNote["cc"],
+		"object":    apNote,
+	}
+}
+
+// GenerateDeleteActivity builds the Delete activity of a note. It has an id
+// of its own, apart from that of the note it deletes.
+func GenerateDeleteActivity(note *db.Note, baseURL string) map[string]interface{} {
+	noteIRI := NoteIRI(note, baseURL)
+	return map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id":       fmt.Sprintf("%s#delete-%d", noteIRI, time.Now().Unix()),
+		"type":     "Delete",
+		"actor":    baseURL + "/profile",
+		"object":   noteIRI,
+	}
+}
+
+// GenerateAnnounceActivity builds the Announce activity of a boost. The
+// boosted note must be loaded.
+func GenerateAnnounceActivity(boost *db.Note, baseURL string) map[string]interface{} {
+	activity := map[string]interface{}{
+		"@context":  "https://www.w3.org/ns/activitystreams",
+		"id":        NoteIRI(boost, baseURL),
+		"type":      "Announce",
+		"actor":     baseURL + "/profile",
+		"published": boost.CreateTime.Format("2006-01-02T15:04:05Z"),
+		"to":        []string{"https://www.w3.org/ns/activitystreams#Public"},
+		"cc":        []string{baseURL + "/followers"},
+	}
+	if boost.Boost != nil {
+		activity["object"] = NoteIRI(boost.Boost, baseURL)
+		if !boost.Boost.IsLocal() {
+			activity["cc"] = []string{baseURL + "/followers", boost.Boost.AuthorURI}
+		}
+	}
+	return activity
+}
+
+// NoteIRI returns the ActivityPub ID of a note: the canonical URL for our
+// own notes, the URI it was received with for the others.
+func NoteIRI(note *db.Note, baseURL string) string {
+	if note.IsLocal() {
+		return fmt.Sprintf("%s/notes/%d", baseURL, note.ID)
+	}
+	return note.URI
+}
+
 // GetVisibilityTargets determines the "to" and "cc" fields based on the note's visibility.
+// Mentioned actors are added to "cc", or to "to" for private notes, which are
+// direct messages to them.
 func GetVisibilityTargets(note *db.Note, baseURL string) ([]string, []string) {
-	var to []string
-	var cc []string
+	to := []string{}
+	cc := []string{}
+
+	mentioned := make([]string, 0, len(note.Mentions))
+	for _, mention := range note.Mentions {
+		mentioned = append(mentioned, mention.ActorURI)
+	}
 
 	switch note.PublicRange {
 	case db.NotePublicRangePublic:
 		to = []string{"https://www.w3.org/ns/activitystreams#Public"}
 	case db.NotePublicRangeFollowers:
-		to = []string{}
 		cc = []string{baseURL + "/followers"}
 	case db.NotePublicRangeUnlisted:
-		to = []string{}
 		cc = []string{"https://www.w3.org/ns/activitystreams#Public"}
 	case db.NotePublicRangePrivate:
+		if len(mentioned) > 0 {
+			return mentioned, cc
+		}
 		to = []string{baseURL + "/profile"}
 	default:
 		// Default to private if the range is unknown
 		to = []string{baseURL + "/profile"}
 	}
 
-	return to, cc
+	return to, append(cc, mentioned...)
 }
 
-// DeterminePublicRange determines the public range of a note based on its "to" and "cc" fields.
-func DeterminePublicRange(to, cc []string) db.NotePublicRange {
-	// Check if the note is public
-	for _, item := range append(to, cc...) {
-		if item == "https://www.w3.org/ns/activitystreams#Public" {
-			return db.NotePublicRangePublic
-		}
-	}
+// publicAudience holds the forms in which the public collection appears in
+// "to" and "cc".
+var publicAudience = []string{"https://www.w3.org/ns/activitystreams#Public", "as:Public", "Public"}
 
-	// Unlisted check (usually in CC)
-	for _, item := range cc {
-		if item == "https://www.w3.org/ns/activitystreams#Public" {
-			return db.NotePublicRangeUnlisted
-		}
+// DeterminePublicRange determines the public range of a note based on its
+// "to" and "cc" fields. The public collection in "to" makes a note public
+// and in "cc" only unlisted. Otherwise a note addressed to followers, the
+// followers collection of its author, is followers-only.
+func DeterminePublicRange(to, cc []string, followers string) db.NotePublicRange {
+	isPublic := func(item string) bool { return slices.Contains(publicAudience, item) }
+	switch {
+	case slices.ContainsFunc(to, isPublic):
+		return db.NotePublicRangePublic
+	case slices.ContainsFunc(cc, isPublic):
+		return db.NotePublicRangeUnlisted
+	case followers != "" && (slices.Contains(to, followers) || slices.Contains(cc, followers)):
+		return db.NotePublicRangeFollowers
 	}
-
-	// Followers check - this is a bit simplified
-	// In a real implementation, you'd check if the followers URI is in 'to' or 'cc'
-
-	// Default to private
 	return db.NotePublicRangePrivate
 }
 
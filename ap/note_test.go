@@ -0,0 +1,128 @@
+package ap
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"knife/db"
+)
+
+func TestGenerateAPNoteAttachmentTypes(t *testing.T) {
+	tests := []struct {
+		mimeType string
+		want     string
+	}{
+		{"image/png", "Image"},
+		{"image/gif", "Image"},
+		{"video/mp4", "Document"},
+		{"application/pdf", "Document"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mimeType, func(t *testing.T) {
+			note := &db.Note{
+				ID:          1,
+				URI:         "https://knife.example/notes/1",
+				PublicRange: db.NotePublicRangePublic,
+				Attachments: []db.NoteAttachment{{Media: db.Media{FileName: "a", MimeType: tt.mimeType}}},
+			}
+			apNote := GenerateAPNote(note, "https://knife.example")
+			attachments, ok := apNote["attachment"].([]map[string]interface{})
+			if !ok || len(attachments) != 1 {
+				t.Fatalf("attachment = %#v", apNote["attachment"])
+			}
+			if got := attachments[0]["type"]; got != tt.want {
+				t.Errorf("attachment type = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetVisibilityTargets(t *testing.T) {
+	const baseURL = "https://knife.example"
+	const public = "https://www.w3.org/ns/activitystreams#Public"
+	bob := db.NoteMention{ActorURI: "https://remote.example/users/bob"}
+
+	tests := []struct {
+		name        string
+		publicRange db.NotePublicRange
+		mentions    []db.NoteMention
+		wantTo      []string
+		wantCc      []string
+	}{
+		{"public", db.NotePublicRangePublic, nil, []string{public}, []string{}},
+		{"public with mention", db.NotePublicRangePublic, []db.NoteMention{bob}, []string{public}, []string{bob.ActorURI}},
+		{"unlisted", db.NotePublicRangeUnlisted, nil, []string{}, []string{public}},
+		{"followers", db.NotePublicRangeFollowers, nil, []string{}, []string{baseURL + "/followers"}},
+		{"private", db.NotePublicRangePrivate, nil, []string{baseURL + "/profile"}, []string{}},
+		{"direct", db.NotePublicRangePrivate, []db.NoteMention{bob}, []string{bob.ActorURI}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			to, cc := GetVisibilityTargets(&db.Note{PublicRange: tt.publicRange, Mentions: tt.mentions}, baseURL)
+			if to == nil || cc == nil {
+				t.Fatalf("to = %#v, cc = %#v; want no nil slices", to, cc)
+			}
+			if !slices.Equal(to, tt.wantTo) || !slices.Equal(cc, tt.wantCc) {
+				t.Errorf("to, cc = %v, %v; want %v, %v", to, cc, tt.wantTo, tt.wantCc)
+			}
+		})
+	}
+}
+
+func TestDeterminePublicRange(t *testing.T) {
+	const (
+		public    = "https://www.w3.org/ns/activitystreams#Public"
+		followers = "https://remote.example/users/bob/followers"
+		alice     = "https://knife.example/profile"
+	)
+	tests := []struct {
+		name   string
+		to, cc []string
+		want   db.NotePublicRange
+	}{
+		{"public in to", []string{public}, []string{followers}, db.NotePublicRangePublic},
+		{"public in to and cc", []string{public}, []string{public}, db.NotePublicRangePublic},
+		{"compact public in to", []string{"as:Public"}, nil, db.NotePublicRangePublic},
+		{"public in cc", []string{followers}, []string{public}, db.NotePublicRangeUnlisted},
+		{"compact public in cc", nil, []string{"Public"}, db.NotePublicRangeUnlisted},
+		{"followers in to", []string{followers}, nil, db.NotePublicRangeFollowers},
+		{"followers in cc", []string{alice}, []string{followers}, db.NotePublicRangeFollowers},
+		{"someone else's followers", []string{"https://remote.example/users/carol/followers"}, nil, db.NotePublicRangePrivate},
+		{"direct", []string{alice}, nil, db.NotePublicRangePrivate},
+		{"nobody", nil, nil, db.NotePublicRangePrivate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DeterminePublicRange(tt.to, tt.cc, followers); got != tt.want {
+				t.Errorf("DeterminePublicRange(%v, %v) = %v, want %v", tt.to, tt.cc, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeterminePublicRangeReadsOwnTargets(t *testing.T) {
+	const baseURL = "https://knife.example"
+	for _, publicRange := range []db.NotePublicRange{db.NotePublicRangePublic, db.NotePublicRangeUnlisted, db.NotePublicRangeFollowers, db.NotePublicRangePrivate} {
+		to, cc := GetVisibilityTargets(&db.Note{PublicRange: publicRange}, baseURL)
+		if got := DeterminePublicRange(to, cc, baseURL+"/followers"); got != publicRange {
+			t.Errorf("public range %v is read back as %v", publicRange, got)
+		}
+	}
+}
+
+func TestGenerateDeleteActivity(t *testing.T) {
+	note := &db.Note{ID: 7, URI: "https://knife.example/notes/7"}
+	activity := GenerateDeleteActivity(note, "https://knife.example")
+
+	if activity["object"] != note.URI {
+		t.Errorf("object = %v, want %s", activity["object"], note.URI)
+	}
+	id, _ := activity["id"].(string)
+	if id == note.URI || !strings.HasPrefix(id, note.URI+"#delete-") {
+		t.Errorf("id = %q, want an id of its own under %s", id, note.URI)
+	}
+	if activity["actor"] != "https://knife.example/profile" {
+		t.Errorf("actor = %v", activity["actor"])
+	}
+}
@@ -0,0 +1,119 @@
+package ap
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+
+	"knife/db"
+)
+
+// SendLike sends a Like of a note to its author. Likes of our own notes
+// are not sent anywhere.
+func (d *ActivityDispatcher) SendLike(note *db.Note, like *db.NoteLike) error {
+	return d.sendToAuthor(note, d.likeActivity(note, like))
+}
+
+// SendUndoLike takes back a like sent with SendLike.
+func (d *ActivityDispatcher) SendUndoLike(note *db.Note, like *db.NoteLike) error {
+	return d.sendToAuthor(note, d.undoActivity(d.likeActivity(note, like)))
+}
+
+// SendAnnounce sends a boost to our followers and to the author of the
+// boosted note, which must be loaded.
+func (d *ActivityDispatcher) SendAnnounce(boost *db.Note) error {
+	return d.sendBoost(boost, GenerateAnnounceActivity(boost, d.cfg.BaseURL))
+}
+
+// SendUndoAnnounce takes back a boost sent with SendAnnounce.
+func (d *ActivityDispatcher) SendUndoAnnounce(boost *db.Note) error {
+	activity := GenerateAnnounceActivity(boost, d.cfg.BaseURL)
+	return d.sendBoost(boost, d.undoActivity(activity))
+}
+
+func (d *ActivityDispatcher) likeActivity(note *db.Note, like *db.NoteLike) map[string]interface{} {
+	return map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id":       like.ActivityID,
+		"type":     "Like",
+		"actor":    d.cfg.BaseURL + "/profile",
+		"object":   NoteIRI(note, d.cfg.BaseURL),
+	}
+}
+
+// undoActivity wraps activity in an Undo addressed like it.
+func (d *ActivityDispatcher) undoActivity(activity map[string]interface{}) map[string]interface{} {
+	inner := make(map[string]interface{}, len(activity))
+	for key, value := range activity {
+		inner[key] = value
+	}
+	delete(inner, "@context")
+
+	undo := map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id":       fmt.Sprintf("%s/undo", activity["id"]),
+		"type":     "Undo",
+		"actor":    d.cfg.BaseURL + "/profile",
+		"object":   inner,
+	}
+	if to, ok := activity["to"]; ok {
+		undo["to"] = to
+	}
+	if cc, ok := activity["cc"]; ok {
+		undo["cc"] = cc
+	}
+	return undo
+}
+
+// sendToAuthor delivers activity to the inbox of the author of a remote
+// note.
+func (d *ActivityDispatcher) sendToAuthor(note *db.Note, activity map[string]interface{}) error {
+	if note.IsLocal() {
+		return nil
+	}
+	mention, err := d.MentionActor(note.AuthorURI, note.AuthorFinger)
+	if err != nil {
+		return err
+	}
+
+	activityBytes, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+	d.deliver(mention.InboxURI, activityBytes, d.cfg.BaseURL+"/profile")
+	return nil
+}
+
+// sendBoost delivers activity to our followers and to the author of the
+// boosted note.
+func (d *ActivityDispatcher) sendBoost(boost *db.Note, activity map[string]interface{}) error {
+	inboxes, err := d.followerModel.ListDeliveryInboxes()
+	if err != nil {
+		return err
+	}
+	if boost.Boost != nil && !boost.Boost.IsLocal() {
+		// Followers still get the boost when the author cannot be reached.
+		mention, err := d.MentionActor(boost.Boost.AuthorURI, boost.Boost.AuthorFinger)
+		if err != nil {
+			log.Printf("failed to resolve the author of %s: %v", boost.Boost.URI, err)
+		} else {
+			inbox := mention.SharedInbox
+			if inbox == "" {
+				inbox = mention.InboxURI
+			}
+			if !slices.Contains(inboxes, inbox) {
+				inboxes = append(inboxes, inbox)
+			}
+		}
+	}
+
+	activityBytes, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+	for _, inbox := range inboxes {
+		d.deliver(inbox, activityBytes, d.cfg.BaseURL+"/profile")
+	}
+	return nil
+}
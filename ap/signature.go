@@ -0,0 +1,230 @@
+package ap
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-fed/httpsig"
+)
+
+const (
+	// maxDateSkew is how far the Date header of a signed request may drift
+	// from our clock before the request is refused.
+	maxDateSkew = time.Hour
+	// actorKeyTTL is how long a fetched actor key is trusted before it is
+	// fetched again.
+	actorKeyTTL = 24 * time.Hour
+	// actorKeyMinAge is how long a fetched actor key is kept before a failed
+	// verification may fetch it again, so that badly signed requests cannot
+	// make us fetch the same actor over and over.
+	actorKeyMinAge = time.Minute
+)
+
+var errNoSignature = errors.New("request is not signed")
+
+type cachedActorKey struct {
+	owner     string
+	key       crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// actorKeyCache keeps the public keys of remote actors so that every
+// incoming activity does not cost us a fetch of the sender's actor document.
+type actorKeyCache struct {
+	mu      sync.Mutex
+	keys    map[string]cachedActorKey
+	fetcher *Fetcher
+}
+
+func newActorKeyCache(fetcher *Fetcher) *actorKeyCache {
+	return &actorKeyCache{keys: make(map[string]cachedActorKey), fetcher: fetcher}
+}
+
+// get returns the owner and the public key for keyID. When refresh is true
+// the cached entry is fetched again unless it is younger than
+// actorKeyMinAge, which lets callers recover from remote key rotation.
+func (c *actorKeyCache) get(keyID string, refresh bool) (string, crypto.PublicKey, error) {
+	c.mu.Lock()
+	entry, ok := c.keys[keyID]
+	c.mu.Unlock()
+	maxAge := actorKeyTTL
+	if refresh {
+		maxAge = actorKeyMinAge
+	}
+	if ok && time.Since(entry.fetchedAt) < maxAge {
+		return entry.owner, entry.key, nil
+	}
+
+	// The key ID is usually the actor IRI with a fragment (e.g. #main-key).
+	actorIRI, _, _ := strings.Cut(keyID, "#")
+	actor, err := c.fetcher.fetchActor(actorIRI)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if actor.GetID().String() != actorIRI {
+		return "", nil, fmt.Errorf("key %s was fetched from %s, not from actor %s", keyID, actorIRI, actor.GetID())
+	}
+	if actor.PublicKey.PublicKeyPem == "" {
+		return "", nil, fmt.Errorf("actor %s has no public key", actor.GetID())
+	}
+	if actor.PublicKey.ID.String() != keyID {
+		return "", nil, fmt.Errorf("actor %s does not publish key %s", actor.GetID(), keyID)
+	}
+
+	owner := actor.PublicKey.Owner.String()
+	if owner == "" {
+		owner = actor.GetID().String()
+	}
+	if owner != actor.GetID().String() {
+		return "", nil, fmt.Errorf("key %s is owned by %s, not by %s", keyID, owner, actor.GetID())
+	}
+
+	key, err := parsePublicKeyPEM(actor.PublicKey.PublicKeyPem)
+	if err != nil {
+		return "", nil, err
+	}
+
+	c.mu.Lock()
+	c.keys[keyID] = cachedActorKey{owner: owner, key: key, fetchedAt: time.Now()}
+	c.mu.Unlock()
+
+	return owner, key, nil
+}
+
+// verifyRequest checks the HTTP Signature of r against the public key of the
+// signing actor and returns the IRI of the actor that owns the key. For
+// requests that carry a body, the Digest header is checked as well.
+func (a *ActivityPubAPI) verifyRequest(r *http.Request, body []byte) (string, error) {
+	if r.Header.Get("Signature") == "" && !strings.HasPrefix(r.Header.Get("Authorization"), "Signature ") {
+		return "", errNoSignature
+	}
+
+	verifier, err := httpsig.NewVerifier(r)
+	if err != nil {
+		return "", fmt.Errorf("malformed signature: %w", err)
+	}
+
+	signed := signedHeaders(r)
+	if !slices.Contains(signed, "date") {
+		return "", fmt.Errorf("date header is not signed")
+	}
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil {
+		return "", fmt.Errorf("invalid date header: %w", err)
+	}
+	if skew := time.Since(date); skew > maxDateSkew || skew < -maxDateSkew {
+		return "", fmt.Errorf("date header is outside of the allowed window")
+	}
+
+	if r.Method == http.MethodPost {
+		if !slices.Contains(signed, "digest") {
+			return "", fmt.Errorf("digest header is not signed")
+		}
+		if err := verifyDigest(r.Header.Get("Digest"), body); err != nil {
+			return "", err
+		}
+	}
+
+	keyID := verifier.KeyId()
+	owner, key, err := a.keyCache.get(keyID, false)
+	if err != nil {
+		return "", fmt.Errorf("could not get key %s: %w", keyID, err)
+	}
+
+	if err := verifier.Verify(key, httpsig.RSA_SHA256); err != nil {
+		// The actor may have rotated its key since we cached it.
+		owner, key, err = a.keyCache.get(keyID, true)
+		if err != nil {
+			return "", fmt.Errorf("could not refresh key %s: %w", keyID, err)
+		}
+		if err := verifier.Verify(key, httpsig.RSA_SHA256); err != nil {
+			return "", fmt.Errorf("signature verification failed: %w", err)
+		}
+	}
+
+	return owner, nil
+}
+
+// signedHeaders returns the lower-cased list of headers covered by the
+// signature of r.
+func signedHeaders(r *http.Request) []string {
+	value := r.Header.Get("Signature")
+	if value == "" {
+		value = strings.TrimPrefix(r.Header.Get("Authorization"), "Signature ")
+	}
+
+	for _, param := range strings.Split(value, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok || k != "headers" {
+			continue
+		}
+		return strings.Fields(strings.ToLower(strings.Trim(v, `"`)))
+	}
+
+	// Without a headers parameter only the Date header is signed.
+	return []string{"date"}
+}
+
+// verifyDigest checks a Digest header value against the request body.
+func verifyDigest(header string, body []byte) error {
+	if header == "" {
+		return fmt.Errorf("missing digest header")
+	}
+
+	for _, entry := range strings.Split(header, ",") {
+		algo, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+
+		var sum []byte
+		switch strings.ToUpper(algo) {
+		case "SHA-256":
+			s := sha256.Sum256(body)
+			sum = s[:]
+		case "SHA-512":
+			s := sha512.Sum512(body)
+			sum = s[:]
+		default:
+			continue
+		}
+
+		expected, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return fmt.Errorf("malformed digest header: %w", err)
+		}
+		if subtle.ConstantTimeCompare(sum, expected) != 1 {
+			return fmt.Errorf("digest does not match body")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("no supported digest algorithm in %q", header)
+}
+
+func parsePublicKeyPEM(data string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode public key")
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+}
@@ -0,0 +1,275 @@
+package ap
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-fed/httpsig"
+)
+
+// testActorServer serves a remote actor whose key is key. It returns the
+// key ID and a counter of actor fetches.
+func testActorServer(t *testing.T, key *rsa.PrivateKey) (string, *atomic.Int32) {
+	t.Helper()
+	var fetches atomic.Int32
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyPem := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		actor := srv.URL + "/users/bob"
+		w.Header().Set("Content-Type", "application/activity+json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"@context": "https://www.w3.org/ns/activitystreams",
+			"id":       actor,
+			"type":     "Person",
+			"inbox":    actor + "/inbox",
+			"publicKey": map[string]string{
+				"id":           actor + "#main-key",
+				"owner":        actor,
+				"publicKeyPem": publicKeyPem,
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/users/bob#main-key", &fetches
+}
+
+func newSignatureTestAPI() *ActivityPubAPI {
+	fetcher := &Fetcher{devMode: true, client: http.DefaultClient}
+	return &ActivityPubAPI{fetcher: fetcher, keyCache: newActorKeyCache(fetcher)}
+}
+
+func generateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+type signOptions struct {
+	headers []string
+	date    time.Time
+	body    []byte
+}
+
+// signedRequest returns a POST to the inbox signed with key.
+func signedRequest(t *testing.T, key *rsa.PrivateKey, keyID string, opts signOptions) *http.Request {
+	t.Helper()
+	body := opts.body
+	if body == nil {
+		body = []byte(`{"type":"Create"}`)
+	}
+	if opts.headers == nil {
+		opts.headers = []string{httpsig.RequestTarget, "host", "date", "digest"}
+	}
+	if opts.date.IsZero() {
+		opts.date = time.Now()
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "https://knife.example/inbox", bytes.NewReader(body))
+	req.Header.Set("Host", req.Host)
+	req.Header.Set("Date", opts.date.UTC().Format(http.TimeFormat))
+	sum := sha256.Sum256(body)
+	req.Header.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(sum[:]))
+
+	signer, _, err := httpsig.NewSigner([]httpsig.Algorithm{httpsig.RSA_SHA256}, httpsig.DigestSha256, opts.headers, httpsig.Signature, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signer.SignRequest(key, keyID, req, nil); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestVerifyRequest(t *testing.T) {
+	key := generateKey(t)
+	otherKey := generateKey(t)
+	keyID, _ := testActorServer(t, key)
+	body := []byte(`{"type":"Create"}`)
+
+	tests := []struct {
+		name    string
+		request func(t *testing.T) *http.Request
+		body    []byte
+		wantErr bool
+	}{
+		{
+			name:    "valid",
+			request: func(t *testing.T) *http.Request { return signedRequest(t, key, keyID, signOptions{}) },
+		},
+		{
+			name: "unsigned",
+			request: func(t *testing.T) *http.Request {
+				return httptest.NewRequest(http.MethodPost, "https://knife.example/inbox", nil)
+			},
+			wantErr: true,
+		},
+		{
+			name:    "wrong key",
+			request: func(t *testing.T) *http.Request { return signedRequest(t, otherKey, keyID, signOptions{}) },
+			wantErr: true,
+		},
+		{
+			name:    "body does not match digest",
+			request: func(t *testing.T) *http.Request { return signedRequest(t, key, keyID, signOptions{}) },
+			body:    []byte(`{"type":"Delete"}`),
+			wantErr: true,
+		},
+		{
+			name: "digest not signed",
+			request: func(t *testing.T) *http.Request {
+				return signedRequest(t, key, keyID, signOptions{headers: []string{httpsig.RequestTarget, "host", "date"}})
+			},
+			wantErr: true,
+		},
+		{
+			name: "date not signed",
+			request: func(t *testing.T) *http.Request {
+				return signedRequest(t, key, keyID, signOptions{headers: []string{httpsig.RequestTarget, "host", "digest"}})
+			},
+			wantErr: true,
+		},
+		{
+			name: "date too old",
+			request: func(t *testing.T) *http.Request {
+				return signedRequest(t, key, keyID, signOptions{date: time.Now().Add(-2 * maxDateSkew)})
+			},
+			wantErr: true,
+		},
+		{
+			name: "date too far ahead",
+			request: func(t *testing.T) *http.Request {
+				return signedRequest(t, key, keyID, signOptions{date: time.Now().Add(2 * maxDateSkew)})
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newSignatureTestAPI()
+			reqBody := body
+			if tt.body != nil {
+				reqBody = tt.body
+			}
+			signer, err := a.verifyRequest(tt.request(t), reqBody)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyRequest error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && signer+"#main-key" != keyID {
+				t.Errorf("signer = %q, want the owner of %q", signer, keyID)
+			}
+		})
+	}
+}
+
+func TestVerifyRequestThrottlesKeyRefresh(t *testing.T) {
+	key := generateKey(t)
+	otherKey := generateKey(t)
+	keyID, fetches := testActorServer(t, key)
+	body := []byte(`{"type":"Create"}`)
+	a := newSignatureTestAPI()
+
+	for i := 0; i < 3; i++ {
+		if _, err := a.verifyRequest(signedRequest(t, otherKey, keyID, signOptions{}), body); err == nil {
+			t.Fatal("verifyRequest accepted a request signed with the wrong key")
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("actor fetched %d times, want 1", n)
+	}
+
+	// Once the cached key is old enough, a failure fetches it again.
+	a.keyCache.mu.Lock()
+	entry := a.keyCache.keys[keyID]
+	entry.fetchedAt = time.Now().Add(-2 * actorKeyMinAge)
+	a.keyCache.keys[keyID] = entry
+	a.keyCache.mu.Unlock()
+
+	if _, err := a.verifyRequest(signedRequest(t, otherKey, keyID, signOptions{}), body); err == nil {
+		t.Fatal("verifyRequest accepted a request signed with the wrong key")
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("actor fetched %d times, want 2", n)
+	}
+}
+
+func TestVerifyRequestRejectsSpoofedActor(t *testing.T) {
+	key := generateKey(t)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const victim = "https://mastodon.social/users/alice"
+
+	// The document at /k claims to be someone else's actor and offers the
+	// attacker's key.
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/activity+json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"@context": "https://www.w3.org/ns/activitystreams",
+			"id":       victim,
+			"type":     "Person",
+			"inbox":    victim + "/inbox",
+			"publicKey": map[string]string{
+				"id":           srv.URL + "/k",
+				"owner":        victim,
+				"publicKeyPem": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+			},
+		})
+	}))
+	defer srv.Close()
+
+	a := newSignatureTestAPI()
+	signer, err := a.verifyRequest(signedRequest(t, key, srv.URL+"/k", signOptions{}), []byte(`{"type":"Create"}`))
+	if err == nil {
+		t.Fatalf("verifyRequest accepted a key from a spoofed actor document, signer = %q", signer)
+	}
+}
+
+func TestVerifyDigest(t *testing.T) {
+	body := []byte("hello")
+	sum := sha256.Sum256(body)
+	digest := base64.StdEncoding.EncodeToString(sum[:])
+
+	tests := []struct {
+		name    string
+		header  string
+		wantErr bool
+	}{
+		{"sha-256", "SHA-256=" + digest, false},
+		{"lower-case algorithm", "sha-256=" + digest, false},
+		{"unsupported then supported", "MD5=abc, SHA-256=" + digest, false},
+		{"missing", "", true},
+		{"mismatch", "SHA-256=" + base64.StdEncoding.EncodeToString(make([]byte, 32)), true},
+		{"malformed", "SHA-256=!!!", true},
+		{"unsupported only", "MD5=abc", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyDigest(tt.header, body); (err != nil) != tt.wantErr {
+				t.Errorf("verifyDigest(%q) = %v, want error %v", tt.header, err, tt.wantErr)
+			}
+		})
+	}
+}
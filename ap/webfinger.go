@@ -0,0 +1,79 @@
+package ap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type webfingerResponse struct {
+	Subject string `json:"subject"`
+	Links   []struct {
+		Rel  string `json:"rel"`
+		Type string `json:"type"`
+		Href string `json:"href"`
+	} `json:"links"`
+}
+
+// ParseAccount splits an account handle such as "@user@host", "user@host"
+// or "acct:user@host" into its user and host parts.
+func ParseAccount(account string) (string, string, error) {
+	account = strings.TrimPrefix(strings.TrimSpace(account), "acct:")
+	account = strings.TrimPrefix(account, "@")
+
+	user, host, ok := strings.Cut(account, "@")
+	if !ok || user == "" || host == "" || strings.ContainsAny(host, "@/?#") {
+		return "", "", fmt.Errorf("invalid account %q, expected @user@host", account)
+	}
+	return user, host, nil
+}
+
+// resolveAccount looks up the actor IRI of an account through WebFinger.
+func (f *Fetcher) resolveAccount(account string) (string, error) {
+	user, host, err := ParseAccount(account)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{"resource": {fmt.Sprintf("acct:%s@%s", user, host)}}
+	endpoint := fmt.Sprintf("https://%s/.well-known/webfinger?%s", host, query.Encode())
+	if err := f.validateIRI(endpoint); err != nil {
+		return "", fmt.Errorf("resolveAccount: invalid host: %w", err)
+	}
+
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return "", fmt.Errorf("resolveAccount: failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/jrd+json, application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("resolveAccount: failed to query webfinger: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("resolveAccount: unexpected status code %d: %s", resp.StatusCode, string(body))
+	}
+
+	var jrd webfingerResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&jrd); err != nil {
+		return "", fmt.Errorf("resolveAccount: failed to decode response: %w", err)
+	}
+
+	for _, link := range jrd.Links {
+		if link.Rel != "self" {
+			continue
+		}
+		if link.Type == "application/activity+json" || strings.HasPrefix(link.Type, "application/ld+json") {
+			return link.Href, nil
+		}
+	}
+
+	return "", fmt.Errorf("resolveAccount: no ActivityPub actor for %s@%s", user, host)
+}
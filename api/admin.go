@@ -0,0 +1,83 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"knife/ap"
+	"knife/base"
+	"knife/db"
+)
+
+type AdminAPI struct {
+	deliveryModel *db.DeliveryModel
+	dispatcher    *ap.ActivityDispatcher
+}
+
+func NewAdminAPI(deliveryModel *db.DeliveryModel, dispatcher *ap.ActivityDispatcher) *AdminAPI {
+	return &AdminAPI{deliveryModel: deliveryModel, dispatcher: dispatcher}
+}
+
+func (a *AdminAPI) RegisterHandlers(router *base.APIRouter) {
+	router.GET("admin/deliveries", a.listDeliveries, []string{"AuthMiddleware"})
+	router.POST("admin/deliveries/{id}/retry", a.retryDelivery, []string{"AuthMiddleware"})
+	router.GET("admin/dead-inboxes", a.listDeadInboxes, []string{"AuthMiddleware"})
+}
+
+// listDeliveries lists failed deliveries, or pending ones with
+// ?state=pending, paged with limit and offset.
+func (a *AdminAPI) listDeliveries(ctx base.APIContext) {
+	q := ctx.GetRequest().URL.Query()
+	state := q.Get("state")
+	if state == "" {
+		state = db.DeliveryStateFailed
+	}
+	if state != db.DeliveryStateFailed && state != db.DeliveryStatePending {
+		ctx.ReturnError("badrequest", "state must be failed or pending", http.StatusBadRequest)
+		return
+	}
+
+	page, err := ctx.GetOffsetPagination(defaultPageLimit, maxPageLimit)
+	if err != nil {
+		ctx.ReturnError("badrequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := a.deliveryModel.ListByState(state, page.Limit, page.Offset)
+	if err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx.SetOffsetPaginationLinks(page, len(deliveries))
+	ctx.ReturnJSON(deliveries)
+}
+
+func (a *AdminAPI) retryDelivery(ctx base.APIContext) {
+	idStr := ctx.GetPathParamValue("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		ctx.ReturnError("badrequest", "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+
+	delivery, err := a.dispatcher.RetryDelivery(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.ReturnError("notfound", "Delivery not found", http.StatusNotFound)
+		} else {
+			ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	ctx.ReturnJSON(delivery)
+}
+
+func (a *AdminAPI) listDeadInboxes(ctx base.APIContext) {
+	inboxes, err := a.deliveryModel.ListDeadInboxes()
+	if err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx.ReturnJSON(inboxes)
+}
@@ -2,33 +2,87 @@ package api
 
 import (
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"knife/base"
+	"knife/config"
 	"knife/db"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+// sessionLifetime is how long a session lasts without being used. Every
+// use pushes its expiry this far into the future again.
+const sessionLifetime = 30 * 24 * time.Hour
+
+// sessionTouchInterval limits how often the last use of a session is
+// written back to the database.
+const sessionTouchInterval = time.Minute
+
+// MinPasswordLength is the length a password must have at least.
+const MinPasswordLength = 8
+
+// ErrPasswordTooShort is returned by HashPassword for passwords shorter
+// than MinPasswordLength.
+var ErrPasswordTooShort = fmt.Errorf("password must be at least %d characters long", MinPasswordLength)
+
+// HashPassword returns the hash a password is stored as.
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", ErrPasswordTooShort
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
 type AuthAPI struct {
-	ProfileModel *db.ProfileModel
-	SecretKey    []byte // Secret key for HMAC
+	cfg               *config.Config
+	ProfileModel      *db.ProfileModel
+	SessionModel      *db.SessionModel
+	RecoveryCodeModel *db.RecoveryCodeModel
+	SecretKey         []byte // Secret key for HMAC
+	Proxies           base.TrustedProxies
+
+	lockout *loginLockout
 }
 
-func NewAuthAPI(profileModel *db.ProfileModel, secretKey string) *AuthAPI {
+func NewAuthAPI(cfg *config.Config, profileModel *db.ProfileModel, sessionModel *db.SessionModel, recoveryCodeModel *db.RecoveryCodeModel, secretKey string, proxies base.TrustedProxies) *AuthAPI {
 	return &AuthAPI{
-		ProfileModel: profileModel,
-		SecretKey:    []byte(secretKey),
+		cfg:               cfg,
+		ProfileModel:      profileModel,
+		SessionModel:      sessionModel,
+		RecoveryCodeModel: recoveryCodeModel,
+		SecretKey:         []byte(secretKey),
+		Proxies:           proxies,
+		lockout:           newLoginLockout(),
 	}
 }
 
 func (a *AuthAPI) RegisterHandlers(router *base.APIRouter) {
-	router.POST("login", a.loginHandler, nil)
+	router.POST("login", a.loginHandler, []string{"LoginRateLimit"})
+	router.POST("login/totp", a.loginTOTPHandler, []string{"LoginRateLimit"})
 	router.POST("logout", a.logoutHandler, nil)
 	router.GET("auth/status", a.statusHandler, nil)
+	router.PUT("auth/password", a.changePassword, []string{"AuthMiddleware", "LoginRateLimit"})
+	router.GET("auth/totp", a.totpStatus, []string{"AuthMiddleware"})
+	router.POST("auth/totp", a.setupTOTP, []string{"AuthMiddleware"})
+	router.POST("auth/totp/confirm", a.confirmTOTP, []string{"AuthMiddleware"})
+	router.DELETE("auth/totp", a.disableTOTP, []string{"AuthMiddleware", "LoginRateLimit"})
+	router.POST("auth/totp/recovery-codes", a.regenerateRecoveryCodes, []string{"AuthMiddleware", "LoginRateLimit"})
+	router.GET("sessions", a.listSessions, []string{"AuthMiddleware"})
+	router.DELETE("sessions/{id}", a.deleteSession, []string{"AuthMiddleware"})
 }
 
 func (a *AuthAPI) loginHandler(ctx base.APIContext) {
@@ -39,6 +93,10 @@ func (a *AuthAPI) loginHandler(ctx base.APIContext) {
 		ctx.ReturnError("invalid_request", "Invalid request payload", http.StatusBadRequest)
 		return
 	}
+	ip := a.Proxies.ClientIP(ctx.GetRequest())
+	if a.lockedOut(ctx, ip) {
+		return
+	}
 
 	// Fetch the stored password hash from the profile
 	profile, err := a.ProfileModel.Get()
@@ -49,49 +107,261 @@ func (a *AuthAPI) loginHandler(ctx base.APIContext) {
 
 	// Verify the password
 	if err := bcrypt.CompareHashAndPassword([]byte(profile.PasswordHash), []byte(req.Password)); err != nil {
-		fmt.Println("Stored hash:", profile.PasswordHash)
-		fmt.Println("Input password:", req.Password)
-		fmt.Println("Error:", err)
+		a.lockout.fail(ip)
 		ctx.ReturnError("unauthorized", "Invalid password", http.StatusUnauthorized)
 		return
 	}
 
-	// Generate an HMAC token based on the password hash
-	token := a.generateToken(profile.PasswordHash)
+	// With TOTP on, the session only counts once the code is given to
+	// login/totp.
+	if profile.TOTPEnabled {
+		token, err := a.createSession(ctx.GetRequest(), true)
+		if err != nil {
+			ctx.ReturnError("server_error", "Failed to create session", http.StatusInternalServerError)
+			return
+		}
+		ctx.SetCookie("auth_token", token, "/", int64(pendingSessionLifetime/time.Second), true)
+		ctx.ReturnJSON(map[string]any{"message": "Authentication code required", "totp_required": true})
+		return
+	}
+
+	a.lockout.reset(ip)
+	token, err := a.createSession(ctx.GetRequest(), false)
+	if err != nil {
+		ctx.ReturnError("server_error", "Failed to create session", http.StatusInternalServerError)
+		return
+	}
 
 	// Set the token in a secure cookie
-	ctx.SetCookie("auth_token", token, "/", 24*60*60, true)
+	ctx.SetCookie("auth_token", token, "/", int64(sessionLifetime/time.Second), true)
 	ctx.ReturnJSON(map[string]string{"message": "Login successful"})
 }
 
 func (a *AuthAPI) logoutHandler(ctx base.APIContext) {
+	if session := a.findSession(ctx.GetRequest()); session != nil {
+		if _, err := a.SessionModel.Delete(session.ID); err != nil {
+			ctx.ReturnError("server_error", "Failed to end session", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Clear the auth token cookie
 	ctx.SetCookie("auth_token", "", "/", -1, true)
 	ctx.ReturnJSON(map[string]string{"message": "Logout successful"})
 }
 
 func (a *AuthAPI) statusHandler(ctx base.APIContext) {
-	cookie, err := ctx.GetCookie("auth_token")
-	if err != nil || !a.validateToken(cookie.Value) {
-		ctx.ReturnJSON(map[string]bool{"logged_in": false})
-		return
+	ctx.ReturnJSON(map[string]bool{"logged_in": a.isLoggedIn(ctx)})
+}
+
+// lockedOut refuses the login with 429 while ip is locked out after too
+// many failed attempts.
+func (a *AuthAPI) lockedOut(ctx base.APIContext, ip string) bool {
+	wait := a.lockout.wait(ip)
+	if wait <= 0 {
+		return false
 	}
-	ctx.ReturnJSON(map[string]bool{"logged_in": true})
+	seconds := int(math.Ceil(wait.Seconds()))
+	ctx.SetHeader("Retry-After", strconv.Itoa(seconds))
+	ctx.ReturnError("locked", fmt.Sprintf("Too many failed login attempts. Try again in %d seconds", seconds), http.StatusTooManyRequests)
+	return true
 }
 
-func (a *AuthAPI) generateToken(passwordHash string) string {
-	h := hmac.New(sha256.New, a.SecretKey)
-	h.Write([]byte(passwordHash))
-	return hex.EncodeToString(h.Sum(nil))
+// verifyPassword checks password against the owner's for a logged-in
+// request that needs it again. Wrong passwords count towards the login
+// lockout, so a stolen session cannot be used to guess the password. It
+// writes the error response and returns false when the password is wrong
+// or the client is locked out.
+func (a *AuthAPI) verifyPassword(ctx base.APIContext, profile *db.Profile, password string) bool {
+	ip := a.Proxies.ClientIP(ctx.GetRequest())
+	if a.lockedOut(ctx, ip) {
+		return false
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(profile.PasswordHash), []byte(password)); err != nil {
+		a.lockout.fail(ip)
+		ctx.ReturnError("forbidden", "Password is incorrect", http.StatusForbidden)
+		return false
+	}
+	a.lockout.reset(ip)
+	return true
 }
 
-func (a *AuthAPI) validateToken(token string) bool {
+// changePassword sets a new password after checking the current one. All
+// sessions are revoked and the device making the change is logged in again.
+func (a *AuthAPI) changePassword(ctx base.APIContext) {
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.Unmarshal(ctx.RawBody(), &req); err != nil {
+		ctx.ReturnError("invalid_request", "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
 	profile, err := a.ProfileModel.Get()
 	if err != nil {
-		return false
+		ctx.ReturnError("server_error", "Failed to fetch profile", http.StatusInternalServerError)
+		return
 	}
-	expectedToken := a.generateToken(profile.PasswordHash)
-	return hmac.Equal([]byte(token), []byte(expectedToken))
+	if !a.verifyPassword(ctx, profile, req.CurrentPassword) {
+		return
+	}
+
+	hash, err := HashPassword(req.NewPassword)
+	if err == ErrPasswordTooShort {
+		ctx.ReturnError("badrequest", err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		ctx.ReturnError("server_error", "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+	if err := a.ProfileModel.UpdatePassword(profile.Finger, hash); err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := a.SessionModel.DeleteAll(); err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	token, err := a.createSession(ctx.GetRequest(), false)
+	if err != nil {
+		ctx.ReturnError("server_error", "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	ctx.SetCookie("auth_token", token, "/", int64(sessionLifetime/time.Second), true)
+	ctx.ReturnJSON(map[string]string{"message": "Password changed"})
+}
+
+// SessionResponse is a session as listed to the owner.
+type SessionResponse struct {
+	db.Session
+	// Current is set for the session the request was made with.
+	Current bool `json:"current"`
+}
+
+func (a *AuthAPI) listSessions(ctx base.APIContext) {
+	sessions, err := a.SessionModel.ListActive()
+	if err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	current, _ := a.authenticate(ctx.GetRequest())
+
+	responses := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		responses = append(responses, SessionResponse{
+			Session: session,
+			Current: current != nil && current.ID == session.ID,
+		})
+	}
+	ctx.ReturnJSON(responses)
+}
+
+func (a *AuthAPI) deleteSession(ctx base.APIContext) {
+	id, err := strconv.ParseInt(ctx.GetPathParamValue("id"), 10, 64)
+	if err != nil {
+		ctx.ReturnError("badrequest", "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+	current, _ := a.authenticate(ctx.GetRequest())
+
+	found, err := a.SessionModel.Delete(id)
+	if err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		ctx.ReturnError("notfound", "Session not found", http.StatusNotFound)
+		return
+	}
+
+	if current != nil && current.ID == id {
+		ctx.SetCookie("auth_token", "", "/", -1, true)
+	}
+	ctx.ReturnJSON(map[string]string{"message": "Session revoked"})
+}
+
+// isLoggedIn reports whether the request carries a valid auth token, for
+// handlers that are open to everyone but show more to the owner.
+func (a *AuthAPI) isLoggedIn(ctx base.APIContext) bool {
+	session, _ := a.authenticate(ctx.GetRequest())
+	return session != nil
+}
+
+// createSession starts a session for the device the request came from and
+// returns its token. A pending session waits for the second factor.
+func (a *AuthAPI) createSession(r *http.Request, pending bool) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	if err := a.SessionModel.DeleteExpired(); err != nil {
+		return "", err
+	}
+	session := &db.Session{
+		TokenHash: a.hashToken(token),
+		UserAgent: r.UserAgent(),
+		IP:        a.Proxies.ClientIP(r),
+		Pending:   pending,
+	}
+	lifetime := sessionLifetime
+	if pending {
+		lifetime = pendingSessionLifetime
+	}
+	if err := a.SessionModel.Create(session, lifetime); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// findSession returns the session the request's auth token belongs to,
+// logged in or pending, or nil when there is none.
+func (a *AuthAPI) findSession(r *http.Request) *db.Session {
+	cookie, err := r.Cookie("auth_token")
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+	session, err := a.SessionModel.GetByTokenHash(a.hashToken(cookie.Value))
+	if err != nil {
+		return nil
+	}
+	return session
+}
+
+// authenticate returns the logged-in session the request's auth token
+// belongs to, or nil when there is none. A session still waiting for its
+// second factor is not logged in. A session that has not been used for a
+// while is renewed, which is reported so that the cookie can be renewed as
+// well.
+func (a *AuthAPI) authenticate(r *http.Request) (*db.Session, bool) {
+	session := a.findSession(r)
+	if session == nil || session.Pending {
+		return nil, false
+	}
+
+	if time.Since(session.LastSeenAt) < sessionTouchInterval {
+		return session, false
+	}
+	if err := a.SessionModel.Touch(session, sessionLifetime); err != nil {
+		log.Printf("failed to renew session %d: %v", session.ID, err)
+		return session, false
+	}
+	return session, true
+}
+
+// hashToken returns the form a session token is stored in.
+func (a *AuthAPI) hashToken(token string) string {
+	h := hmac.New(sha256.New, a.SecretKey)
+	h.Write([]byte(token))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// viewer returns who the request is showing notes to.
+func (a *AuthAPI) viewer(ctx base.APIContext) db.NoteViewer {
+	return db.NoteViewer{Owner: a.isLoggedIn(ctx)}
 }
 
 // AuthMiddleware implements base.APIMiddleware
@@ -104,13 +374,24 @@ func NewAuthMiddleware(authAPI *AuthAPI) *AuthMiddleware {
 }
 
 func (m *AuthMiddleware) RunMiddleware(w http.ResponseWriter, r *http.Request) base.APIMiddlewareResult {
-	cookie, err := r.Cookie("auth_token")
-	if err != nil || !m.AuthAPI.validateToken(cookie.Value) {
+	session, renewed := m.AuthAPI.authenticate(r)
+	if session == nil {
 		return base.APIMiddlewareResult{
 			IsSuccess: false,
 			ApiError:  base.NewAPIError("unauthorized", "Unauthorized access", http.StatusUnauthorized),
 		}
 	}
+	if renewed {
+		cookie, _ := r.Cookie("auth_token")
+		http.SetCookie(w, &http.Cookie{
+			Name:     "auth_token",
+			Value:    cookie.Value,
+			Path:     "/",
+			MaxAge:   int(sessionLifetime / time.Second),
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
 	return base.APIMiddlewareResult{IsSuccess: true}
 }
 
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"knife/base"
+	"knife/config"
+	"knife/db"
+)
+
+const testPassword = "password123"
+
+// newTestAuthAPI returns an AuthAPI for https://knife.example on a fresh
+// database whose owner has testPassword, and a router serving its handlers
+// without middlewares.
+func newTestAuthAPI(t *testing.T) (*AuthAPI, *base.APIRouter) {
+	t.Helper()
+	dbconn, err := db.InitDB(filepath.Join(t.TempDir(), "knife.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { dbconn.Close() })
+
+	hash, err := HashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profileModel := db.NewProfileModel(dbconn)
+	if err := profileModel.Create(&db.Profile{Finger: "alice", DisplayName: "Alice", PasswordHash: hash}); err != nil {
+		t.Fatalf("Create profile: %v", err)
+	}
+
+	cfg := config.Default()
+	cfg.BaseURL = "https://knife.example"
+	a := NewAuthAPI(cfg, profileModel, db.NewSessionModel(dbconn), db.NewRecoveryCodeModel(dbconn), "secret", nil)
+	router := base.NewAPIRouter()
+	router.SetPrefix("api")
+	a.RegisterHandlers(&router)
+	return a, &router
+}
+
+// serve sends a JSON request to router and returns the response.
+func serve(router *base.APIRouter, method, path string, body any, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, strings.NewReader(string(data)))
+	req.Header.Set("Content-Type", "application/json")
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	router.GetMUX().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestChangePasswordLockout(t *testing.T) {
+	_, router := newTestAuthAPI(t)
+
+	type attempt struct {
+		current    string
+		wantStatus int
+	}
+	var attempts []attempt
+	for i := 0; i < lockoutFreeAttempts; i++ {
+		attempts = append(attempts, attempt{"wrong", http.StatusForbidden})
+	}
+	// Locked out now, even with the right password.
+	attempts = append(attempts, attempt{testPassword, http.StatusTooManyRequests})
+
+	for i, a := range attempts {
+		rec := serve(router, http.MethodPut, "/api/auth/password", map[string]string{
+			"current_password": a.current,
+			"new_password":     "new password",
+		})
+		if rec.Code != a.wantStatus {
+			t.Fatalf("attempt %d: status = %d, want %d", i+1, rec.Code, a.wantStatus)
+		}
+	}
+
+	// Logging in is locked out as well.
+	if rec := serve(router, http.MethodPost, "/api/login", map[string]string{"password": testPassword}); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("login status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestChangePasswordResetsLockout(t *testing.T) {
+	_, router := newTestAuthAPI(t)
+
+	for i := 0; i < lockoutFreeAttempts-1; i++ {
+		serve(router, http.MethodPut, "/api/auth/password", map[string]string{"current_password": "wrong", "new_password": "new password"})
+	}
+	rec := serve(router, http.MethodPut, "/api/auth/password", map[string]string{"current_password": testPassword, "new_password": "new password"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	// The earlier failures were forgotten.
+	if rec := serve(router, http.MethodPost, "/api/login", map[string]string{"password": "wrong"}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("login status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := serve(router, http.MethodPost, "/api/login", map[string]string{"password": "new password"}); rec.Code != http.StatusOK {
+		t.Errorf("login with the new password: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
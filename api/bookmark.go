@@ -77,18 +77,7 @@ func (a *BookmarkAPI) listBookmarks(ctx base.APIContext) {
 			ctx.ReturnError("server_error", "Failed to fetch note details", 500)
 			return
 		}
-		notes = append(notes, NoteResponse{
-			ID:           note.ID,
-			URI:          note.URI,
-			Cw:           note.Cw,
-			Content:      note.Content,
-			Host:         note.Host,
-			AuthorName:   note.AuthorName,
-			AuthorFinger: note.AuthorFinger,
-			PublicRange:  note.PublicRange,
-			CreateTime:   note.CreateTime,
-			Category:     note.Category,
-		})
+		notes = append(notes, newNoteResponse(note))
 	}
 
 	ctx.ReturnJSON(notes)
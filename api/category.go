@@ -9,11 +9,13 @@ import (
 
 type CategoryAPI struct {
 	NoteModel *db.NoteModel
+	AuthAPI   *AuthAPI
 }
 
-func NewCategoryAPI(noteModel *db.NoteModel) *CategoryAPI {
+func NewCategoryAPI(noteModel *db.NoteModel, authAPI *AuthAPI) *CategoryAPI {
 	return &CategoryAPI{
 		NoteModel: noteModel,
+		AuthAPI:   authAPI,
 	}
 }
 
@@ -23,7 +25,7 @@ func (a *CategoryAPI) RegisterHandlers(router *base.APIRouter) {
 }
 
 func (a *CategoryAPI) listCategory(ctx base.APIContext) {
-	categories, err := a.NoteModel.ListCategories()
+	categories, err := a.NoteModel.ListCategories(a.AuthAPI.viewer(ctx))
 	if err != nil {
 		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
 		return
@@ -39,27 +41,17 @@ func (a *CategoryAPI) getCategoryContentByName(ctx base.APIContext) {
 		return
 	}
 
-	notes, err := a.NoteModel.ListByCategory(categoryName)
+	page, err := ctx.GetPagination(defaultPageLimit, maxPageLimit)
 	if err != nil {
-		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		ctx.ReturnError("badrequest", err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	noteResponses := make([]NoteResponse, 0, len(notes))
-	for _, note := range notes {
-		noteResponses = append(noteResponses, NoteResponse{
-			ID:           note.ID,
-			URI:          note.URI,
-			Cw:           note.Cw,
-			Content:      note.Content,
-			Host:         note.Host,
-			AuthorName:   note.AuthorName,
-			AuthorFinger: note.AuthorFinger,
-			PublicRange:  note.PublicRange,
-			CreateTime:   note.CreateTime,
-			Category:     note.Category,
-		})
+	notes, err := a.NoteModel.ListByCategory(categoryName, a.AuthAPI.viewer(ctx), page.Limit, page.Before, page.After)
+	if err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	ctx.ReturnJSON(noteResponses)
+	returnNotePage(ctx, page, notes)
 }
\ No newline at end of file
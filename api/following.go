@@ -0,0 +1,86 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"knife/ap"
+	"knife/base"
+	"knife/db"
+)
+
+type FollowingAPI struct {
+	followingModel *db.FollowingModel
+	dispatcher     *ap.ActivityDispatcher
+}
+
+func NewFollowingAPI(followingModel *db.FollowingModel, dispatcher *ap.ActivityDispatcher) *FollowingAPI {
+	return &FollowingAPI{followingModel: followingModel, dispatcher: dispatcher}
+}
+
+func (a *FollowingAPI) RegisterHandlers(router *base.APIRouter) {
+	router.GET("following", a.listFollowing, []string{"AuthMiddleware"})
+	router.POST("following", a.follow, []string{"AuthMiddleware"})
+	router.DELETE("following", a.unfollow, []string{"AuthMiddleware"})
+}
+
+func (a *FollowingAPI) listFollowing(ctx base.APIContext) {
+	following, err := a.followingModel.ListFollowing()
+	if err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if following == nil {
+		following = []db.Following{}
+	}
+	ctx.ReturnJSON(following)
+}
+
+func (a *FollowingAPI) follow(ctx base.APIContext) {
+	var req struct {
+		Account string `json:"account"`
+	}
+	if err := ctx.GetContext(&req); err != nil {
+		ctx.ReturnError("badrequest", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if _, _, err := ap.ParseAccount(req.Account); err != nil {
+		ctx.ReturnError("badrequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	following, err := a.dispatcher.Follow(req.Account)
+	if err != nil {
+		log.Printf("failed to follow %s: %v", req.Account, err)
+		ctx.ReturnError("followerror", err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	ctx.ReturnJSON(following)
+}
+
+func (a *FollowingAPI) unfollow(ctx base.APIContext) {
+	var req struct {
+		Actor string `param:"actor"`
+	}
+	if err := ctx.GetContext(&req); err != nil {
+		ctx.ReturnError("badrequest", "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.Actor == "" {
+		ctx.ReturnError("badrequest", "actor is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := a.dispatcher.Unfollow(req.Actor); err != nil {
+		if err == sql.ErrNoRows {
+			ctx.ReturnError("notfound", "Not following this actor", http.StatusNotFound)
+		} else {
+			ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	ctx.RawRetrun([]byte(""), http.StatusNoContent)
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"html"
+	"regexp"
+
+	"knife/ap"
+)
+
+// maxHashtagLength is the longest hashtag that is linked and stored.
+const maxHashtagLength = 100
+
+// hashtagPattern matches #tag at the start of the text or after a character
+// that cannot be part of a word or URL. A tag needs at least one letter or
+// underscore so that "#1" stays plain text.
+var hashtagPattern = regexp.MustCompile(`(^|[^\p{L}\p{N}_&/#])#([\p{L}\p{N}_]*[\p{L}_][\p{L}\p{N}_]*)`)
+
+// linkHashtags turns the hashtags in rendered note HTML into links to the
+// tag pages under baseURL and returns the normalized tag names in order of
+// first use. Text inside links and code is left alone.
+func linkHashtags(content string, baseURL string) (string, []string) {
+	var tags []string
+	seen := make(map[string]bool)
+
+	linked := rewriteText(content, func(text string) string {
+		matches := hashtagPattern.FindAllStringSubmatchIndex(text, -1)
+		// m[3] is the end of the prefix, where the # is.
+		return replaceMatches(text, matches, 3, 5, func(m []int) (string, bool) {
+			display := text[m[4]:m[5]]
+			if len(display) > maxHashtagLength {
+				return "", false
+			}
+			tag := ap.NormalizeTag(display)
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+			return `<a href="` + html.EscapeString(ap.TagURL(baseURL, tag)) + `" class="mention hashtag" rel="tag">#<span>` + html.EscapeString(display) + `</span></a>`, true
+		})
+	})
+	return linked, tags
+}
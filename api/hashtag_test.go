@@ -0,0 +1,50 @@
+package api
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLinkHashtags(t *testing.T) {
+	const base = "https://knife.example"
+	link := func(display, tag string) string {
+		return `<a href="` + base + `/tags/` + tag + `" class="mention hashtag" rel="tag">#<span>` + display + `</span></a>`
+	}
+	long := strings.Repeat("a", maxHashtagLength+1)
+
+	tests := []struct {
+		name     string
+		content  string
+		want     string
+		wantTags []string
+	}{
+		{"none", "<p>no tags</p>", "<p>no tags</p>", nil},
+		{"start", "<p>#go is fun</p>", "<p>" + link("go", "go") + " is fun</p>", []string{"go"}},
+		{"after space", "<p>I like #Go</p>", "<p>I like " + link("Go", "go") + "</p>", []string{"go"}},
+		{"unicode", "<p>#한국어 글</p>", "<p>" + link("한국어", "%ED%95%9C%EA%B5%AD%EC%96%B4") + " 글</p>", []string{"한국어"}},
+		{"punctuation after", "<p>(#go)</p>", "<p>(" + link("go", "go") + ")</p>", []string{"go"}},
+		{"digits only", "<p>issue #1</p>", "<p>issue #1</p>", nil},
+		{"digits and letters", "<p>#2024年</p>", "<p>" + link("2024年", "2024%E5%B9%B4") + "</p>", []string{"2024年"}},
+		{"inside word", "<p>C#sharp</p>", "<p>C#sharp</p>", nil},
+		{"url fragment", "<p>example.com/#anchor</p>", "<p>example.com/#anchor</p>", nil},
+		{"entity", "<p>&#39;quoted&#39;</p>", "<p>&#39;quoted&#39;</p>", nil},
+		{"double hash", "<p>##go</p>", "<p>##go</p>", nil},
+		{"inside link", `<p><a href="/x">#go</a></p>`, `<p><a href="/x">#go</a></p>`, nil},
+		{"inside code", "<pre><code>#include</code></pre> #c", "<pre><code>#include</code></pre> " + link("c", "c"), []string{"c"}},
+		{"repeated", "<p>#Go #go #rust</p>", "<p>" + link("Go", "go") + " " + link("go", "go") + " " + link("rust", "rust") + "</p>", []string{"go", "rust"}},
+		{"too long", "<p>#" + long + "</p>", "<p>#" + long + "</p>", nil},
+		{"text is escaped", "<p>a &lt; b #go</p>", "<p>a &lt; b " + link("go", "go") + "</p>", []string{"go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, tags := linkHashtags(tt.content, base)
+			if got != tt.want {
+				t.Errorf("content = %s\nwant      %s", got, tt.want)
+			}
+			if !slices.Equal(tags, tt.wantTags) {
+				t.Errorf("tags = %q, want %q", tags, tt.wantTags)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// rewriteText passes the text of rendered note HTML through rewrite, which
+// returns the HTML to put in its place. Text inside links and code is left
+// alone. Malformed HTML is returned unchanged.
+func rewriteText(content string, rewrite func(text string) string) string {
+	var out bytes.Buffer
+	skipDepth := 0
+
+	z := xhtml.NewTokenizer(strings.NewReader(content))
+	for {
+		tt := z.Next()
+		switch tt {
+		case xhtml.ErrorToken:
+			if z.Err() == io.EOF {
+				return out.String()
+			}
+			return content
+
+		case xhtml.StartTagToken, xhtml.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "a", "code", "pre":
+				if tt == xhtml.StartTagToken {
+					skipDepth++
+				} else if skipDepth > 0 {
+					skipDepth--
+				}
+			}
+			out.Write(z.Raw())
+
+		case xhtml.TextToken:
+			if skipDepth > 0 {
+				out.Write(z.Raw())
+				continue
+			}
+			out.WriteString(rewrite(string(z.Text())))
+
+		default:
+			out.Write(z.Raw())
+		}
+	}
+}
+
+// replaceMatches escapes text, replacing the matches of a pattern with the
+// HTML returned by link. Each match is given as the submatch indexes found
+// by the pattern. start and end pick the part of the match that is
+// replaced; the rest is kept as text. When link returns false the match is
+// kept as text too.
+func replaceMatches(text string, matches [][]int, start, end int, link func(m []int) (string, bool)) string {
+	var out strings.Builder
+	last := 0
+	for _, m := range matches {
+		replacement, ok := link(m)
+		if !ok {
+			continue
+		}
+		out.WriteString(html.EscapeString(text[last:m[start]]))
+		out.WriteString(replacement)
+		last = m[end]
+	}
+	out.WriteString(html.EscapeString(text[last:]))
+	return out.String()
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"knife/base"
+)
+
+// Login lockout: after lockoutFreeAttempts failed logins from one client,
+// further attempts are refused for lockoutBase, doubling with every failure
+// up to lockoutMax. Clients are told apart by base.ClientKey, so an IPv6
+// client cannot escape by moving through its /64. As there is a single
+// account, accountFreeAttempts failures from all clients together lock
+// everyone out the same way, up to accountLockoutMax. Failures are
+// forgotten after lockoutForget without one, or on a successful login.
+const (
+	lockoutFreeAttempts = 5
+	lockoutBase         = 30 * time.Second
+	lockoutMax          = time.Hour
+	lockoutForget       = 24 * time.Hour
+	accountFreeAttempts = 20
+	accountLockoutMax   = 15 * time.Minute
+)
+
+// loginLockout counts failed logins per client and for the account.
+type loginLockout struct {
+	mu       sync.Mutex
+	failures map[string]*loginFailures
+	account  loginFailures
+}
+
+type loginFailures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// add counts a failure at now. Past free failures it locks for lockoutBase,
+// doubling with every further failure up to limit.
+func (f *loginFailures) add(now time.Time, free int, limit time.Duration) {
+	if now.Sub(f.last) > lockoutForget {
+		*f = loginFailures{}
+	}
+	f.count++
+	f.last = now
+	if over := f.count - free; over >= 0 {
+		lock := limit
+		if over < 8 {
+			lock = min(limit, lockoutBase<<over)
+		}
+		f.lockedUntil = now.Add(lock)
+	}
+}
+
+func newLoginLockout() *loginLockout {
+	return &loginLockout{failures: make(map[string]*loginFailures)}
+}
+
+// wait returns how long ip is still locked out, or zero.
+func (l *loginLockout) wait(ip string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	wait := time.Until(l.account.lockedUntil)
+	if f, ok := l.failures[base.ClientKey(ip)]; ok {
+		wait = max(wait, time.Until(f.lockedUntil))
+	}
+	return max(0, wait)
+}
+
+// fail records a failed login from ip.
+func (l *loginLockout) fail(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for key, f := range l.failures {
+		if now.Sub(f.last) > lockoutForget {
+			delete(l.failures, key)
+		}
+	}
+
+	key := base.ClientKey(ip)
+	f, ok := l.failures[key]
+	if !ok {
+		f = &loginFailures{}
+		l.failures[key] = f
+	}
+	f.add(now, lockoutFreeAttempts, lockoutMax)
+	l.account.add(now, accountFreeAttempts, accountLockoutMax)
+}
+
+// reset forgets the failed logins from ip and those counted for the
+// account, after the owner proved to know the password.
+func (l *loginLockout) reset(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, base.ClientKey(ip))
+	l.account = loginFailures{}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLoginLockout(t *testing.T) {
+	tests := []struct {
+		failures  int
+		wantLock  time.Duration
+		wantOther time.Duration // for another client
+	}{
+		{1, 0, 0},
+		{lockoutFreeAttempts - 1, 0, 0},
+		{lockoutFreeAttempts, lockoutBase, 0},
+		{lockoutFreeAttempts + 1, 2 * lockoutBase, 0},
+		{lockoutFreeAttempts + 3, 8 * lockoutBase, 0},
+		{lockoutFreeAttempts + 7, lockoutMax, 0},
+		{accountFreeAttempts, lockoutMax, lockoutBase},
+		{lockoutFreeAttempts + 100, lockoutMax, accountLockoutMax},
+	}
+	for _, tt := range tests {
+		l := newLoginLockout()
+		for range tt.failures {
+			l.fail("192.0.2.1")
+		}
+		if got := l.wait("192.0.2.1"); got > tt.wantLock || got < tt.wantLock-time.Second {
+			t.Errorf("after %d failures wait = %v, want %v", tt.failures, got, tt.wantLock)
+		}
+		if got := l.wait("192.0.2.2"); got > tt.wantOther || got < tt.wantOther-time.Second {
+			t.Errorf("after %d failures another address waits %v, want %v", tt.failures, got, tt.wantOther)
+		}
+	}
+}
+
+func TestLoginLockoutIPv6Network(t *testing.T) {
+	tests := []struct {
+		ip     string
+		locked bool
+	}{
+		{"2001:db8:1:2::ffff", true},
+		{"2001:db8:1:2:aaaa:bbbb:cccc:dddd", true},
+		{"2001:db8:1:3::1", false},
+		{"192.0.2.1", false},
+	}
+	l := newLoginLockout()
+	for i := range lockoutFreeAttempts {
+		l.fail(fmt.Sprintf("2001:db8:1:2::%x", i+1))
+	}
+	for _, tt := range tests {
+		if locked := l.wait(tt.ip) > 0; locked != tt.locked {
+			t.Errorf("%s locked = %v, want %v", tt.ip, locked, tt.locked)
+		}
+	}
+}
+
+func TestLoginLockoutAccount(t *testing.T) {
+	l := newLoginLockout()
+	// One failure from each of many clients stays under the limit per
+	// client but not under the one for the account.
+	for i := range accountFreeAttempts - 1 {
+		l.fail(fmt.Sprintf("198.51.100.%d", i+1))
+	}
+	if wait := l.wait("203.0.113.1"); wait != 0 {
+		t.Fatalf("wait before the account limit = %v, want 0", wait)
+	}
+	l.fail("198.51.100.200")
+	if wait := l.wait("203.0.113.1"); wait <= 0 || wait > lockoutBase {
+		t.Errorf("wait at the account limit = %v, want up to %v", wait, lockoutBase)
+	}
+
+	// A successful login clears the account count as well.
+	l.reset("203.0.113.1")
+	if wait := l.wait("203.0.113.1"); wait != 0 {
+		t.Errorf("wait after reset = %v, want 0", wait)
+	}
+	l.fail("198.51.100.201")
+	if wait := l.wait("203.0.113.1"); wait != 0 {
+		t.Errorf("wait after one more failure = %v, want 0", wait)
+	}
+}
+
+func TestLoginLockoutReset(t *testing.T) {
+	l := newLoginLockout()
+	for range lockoutFreeAttempts {
+		l.fail("192.0.2.1")
+	}
+	l.reset("192.0.2.1")
+	if wait := l.wait("192.0.2.1"); wait != 0 {
+		t.Errorf("wait after reset = %v, want 0", wait)
+	}
+
+	// The count starts over as well.
+	l.fail("192.0.2.1")
+	if wait := l.wait("192.0.2.1"); wait != 0 {
+		t.Errorf("wait after one more failure = %v, want 0", wait)
+	}
+}
+
+func TestLoginLockoutForget(t *testing.T) {
+	l := newLoginLockout()
+	for range lockoutFreeAttempts - 1 {
+		l.fail("192.0.2.1")
+	}
+	l.failures["192.0.2.1"].last = time.Now().Add(-lockoutForget - time.Minute)
+
+	// Failures from anywhere sweep out the stale ones.
+	l.fail("192.0.2.2")
+	if _, ok := l.failures["192.0.2.1"]; ok {
+		t.Fatal("stale failures were not forgotten")
+	}
+	l.fail("192.0.2.1")
+	if wait := l.wait("192.0.2.1"); wait != 0 {
+		t.Errorf("wait = %v, want 0 once earlier failures are forgotten", wait)
+	}
+}
@@ -0,0 +1,402 @@
+package api
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"knife/base"
+	"knife/config"
+	"knife/db"
+
+	"github.com/buckket/go-blurhash"
+	"golang.org/x/image/draw"
+)
+
+const (
+	// maxMediaSize is the largest file accepted by the upload endpoint.
+	maxMediaSize = 10 << 20
+	// maxMediaBodySize bounds the whole upload request, leaving room for
+	// the multipart headers around the file.
+	maxMediaBodySize = maxMediaSize + 64<<10
+	// maxMediaPixels bounds the decoded size of an image so that a small
+	// file cannot expand into an enormous bitmap.
+	maxMediaPixels = 50_000_000
+	// thumbnailSize is the longest side of a generated thumbnail.
+	thumbnailSize = 400
+	// maxAttachments is the number of media files a note may carry.
+	maxAttachments = 4
+)
+
+// mediaExtensions lists the accepted upload types and the extension the
+// stored file gets.
+var mediaExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+type MediaAPI struct {
+	cfg        *config.Config
+	mediaModel *db.MediaModel
+}
+
+func NewMediaAPI(cfg *config.Config, mediaModel *db.MediaModel) *MediaAPI {
+	return &MediaAPI{cfg: cfg, mediaModel: mediaModel}
+}
+
+type MediaResponse struct {
+	ID           int64  `json:"id"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	MimeType     string `json:"mime_type"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	Blurhash     string `json:"blurhash"`
+	Description  string `json:"description,omitempty"`
+}
+
+func newMediaResponse(media *db.Media) MediaResponse {
+	return MediaResponse{
+		ID:           media.ID,
+		URL:          "/media/" + media.FileName,
+		ThumbnailURL: "/media/" + media.ThumbnailName,
+		MimeType:     media.MimeType,
+		Width:        media.Width,
+		Height:       media.Height,
+		Blurhash:     media.Blurhash,
+	}
+}
+
+func newAttachmentResponses(attachments []db.NoteAttachment) []MediaResponse {
+	if len(attachments) == 0 {
+		return nil
+	}
+	responses := make([]MediaResponse, 0, len(attachments))
+	for i := range attachments {
+		response := newMediaResponse(&attachments[i].Media)
+		response.Description = attachments[i].Description
+		responses = append(responses, response)
+	}
+	return responses
+}
+
+// RegisterHandlers registers the API handlers for media uploads.
+func (a *MediaAPI) RegisterHandlers(router *base.APIRouter) {
+	router.SetBodyLimit("media", maxMediaBodySize)
+	router.POST("media", a.uploadMedia, []string{"AuthMiddleware"})
+}
+
+func (a *MediaAPI) uploadMedia(ctx base.APIContext) {
+	body := ctx.RawBody()
+	if len(body) > maxMediaSize {
+		ctx.ReturnError("toolarge", fmt.Sprintf("File is larger than %d bytes", maxMediaSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	mediaType, params, err := mime.ParseMediaType(ctx.GetRequest().Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		ctx.ReturnError("badrequest", "Expected a multipart/form-data body", http.StatusBadRequest)
+		return
+	}
+
+	form, err := multipart.NewReader(bytes.NewReader(body), params["boundary"]).ReadForm(maxMediaSize)
+	if err != nil {
+		ctx.ReturnError("badrequest", "Invalid multipart body", http.StatusBadRequest)
+		return
+	}
+	defer form.RemoveAll()
+
+	files := form.File["file"]
+	if len(files) != 1 {
+		ctx.ReturnError("badrequest", "Exactly one file is required", http.StatusBadRequest)
+		return
+	}
+
+	data, err := readFormFile(files[0])
+	if err != nil {
+		ctx.ReturnError("badrequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mimeType := http.DetectContentType(data)
+	ext, ok := mediaExtensions[mimeType]
+	if !ok {
+		ctx.ReturnError("unsupportedmedia", fmt.Sprintf("Unsupported media type %s", mimeType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	processed, err := processImage(data, mimeType)
+	if err != nil {
+		ctx.ReturnError("badrequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name, err := randomMediaName()
+	if err != nil {
+		ctx.ReturnError("servererror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	media := db.Media{
+		FileName:      name + ext,
+		ThumbnailName: name + "_thumb" + processed.thumbnailExt,
+		MimeType:      mimeType,
+		Width:         processed.width,
+		Height:        processed.height,
+		Blurhash:      processed.blurhash,
+		Size:          int64(len(processed.data)),
+	}
+
+	if err := a.writeMediaFile(media.FileName, processed.data); err != nil {
+		ctx.ReturnError("servererror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := a.writeMediaFile(media.ThumbnailName, processed.thumbnail); err != nil {
+		ctx.ReturnError("servererror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := a.mediaModel.Create(&media); err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctx.ReturnJSON(newMediaResponse(&media))
+}
+
+func (a *MediaAPI) writeMediaFile(name string, data []byte) error {
+	if err := os.WriteFile(filepath.Join(a.cfg.MediaDir, name), data, 0644); err != nil {
+		log.Printf("failed to write media file %s: %v", name, err)
+		return fmt.Errorf("failed to store media file")
+	}
+	return nil
+}
+
+func readFormFile(header *multipart.FileHeader) ([]byte, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read uploaded file")
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxMediaSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read uploaded file")
+	}
+	if len(data) > maxMediaSize {
+		return nil, fmt.Errorf("file is larger than %d bytes", maxMediaSize)
+	}
+	return data, nil
+}
+
+func randomMediaName() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// loadAttachments resolves the media referenced by a note request, keeping
+// the alt text sent by the client.
+func loadAttachments(mediaModel *db.MediaModel, attachments []db.NoteAttachment) ([]db.NoteAttachment, error) {
+	if len(attachments) > maxAttachments {
+		return nil, fmt.Errorf("a note can have at most %d attachments", maxAttachments)
+	}
+
+	resolved := make([]db.NoteAttachment, 0, len(attachments))
+	for _, attachment := range attachments {
+		media, err := mediaModel.Get(attachment.ID)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("media %d not found", attachment.ID)
+		} else if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, db.NoteAttachment{Media: *media, Description: attachment.Description})
+	}
+	return resolved, nil
+}
+
+type processedImage struct {
+	data         []byte
+	thumbnail    []byte
+	thumbnailExt string
+	width        int
+	height       int
+	blurhash     string
+}
+
+// processImage re-encodes an uploaded image, which drops EXIF and any other
+// metadata, and builds its thumbnail and blurhash. JPEG images are rotated
+// according to their EXIF orientation first, since that tag is lost.
+func processImage(data []byte, mimeType string) (*processedImage, error) {
+	imgConfig, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %v", err)
+	}
+	if imgConfig.Width*imgConfig.Height > maxMediaPixels {
+		return nil, fmt.Errorf("image dimensions %dx%d are too large", imgConfig.Width, imgConfig.Height)
+	}
+	if mimeType == "image/gif" {
+		// Every frame is decoded into a bitmap as large as the image.
+		frames, err := gifFrameCount(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image: %v", err)
+		}
+		if frames*imgConfig.Width*imgConfig.Height > maxMediaPixels {
+			return nil, fmt.Errorf("animation with %d frames of %dx%d is too large", frames, imgConfig.Width, imgConfig.Height)
+		}
+	}
+
+	var img image.Image
+	var out bytes.Buffer
+	thumbnailExt := ".png"
+
+	switch mimeType {
+	case "image/jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode image: %v", err)
+		}
+		img = applyOrientation(img, jpegOrientation(data))
+		err = jpeg.Encode(&out, img, &jpeg.Options{Quality: 90})
+		thumbnailExt = ".jpg"
+	case "image/png":
+		img, err = png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode image: %v", err)
+		}
+		err = png.Encode(&out, img)
+	case "image/gif":
+		var anim *gif.GIF
+		anim, err = gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode image: %v", err)
+		}
+		img = anim.Image[0]
+		err = gif.EncodeAll(&out, anim)
+	default:
+		return nil, fmt.Errorf("unsupported media type %s", mimeType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode image: %v", err)
+	}
+
+	thumb := thumbnail(img)
+	var thumbOut bytes.Buffer
+	if thumbnailExt == ".jpg" {
+		err = jpeg.Encode(&thumbOut, thumb, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&thumbOut, thumb)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %v", err)
+	}
+
+	hash, err := blurhash.Encode(4, 3, thumb)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute blurhash: %v", err)
+	}
+
+	bounds := img.Bounds()
+	return &processedImage{
+		data:         out.Bytes(),
+		thumbnail:    thumbOut.Bytes(),
+		thumbnailExt: thumbnailExt,
+		width:        bounds.Dx(),
+		height:       bounds.Dy(),
+		blurhash:     hash,
+	}, nil
+}
+
+// gifFrameCount counts the frames of a GIF by walking its blocks, without
+// decoding them.
+func gifFrameCount(data []byte) (int, error) {
+	errMalformed := errors.New("malformed GIF")
+	// Header and logical screen descriptor
+	if len(data) < 13 {
+		return 0, errMalformed
+	}
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << (flags&0x07 + 1)
+	}
+
+	skipSubBlocks := func() bool {
+		for pos < len(data) {
+			size := int(data[pos])
+			pos++
+			if size == 0 {
+				return true
+			}
+			pos += size
+		}
+		return false
+	}
+
+	frames := 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // Extension
+			pos += 2
+			if !skipSubBlocks() {
+				return 0, errMalformed
+			}
+		case 0x2C: // Image descriptor
+			if pos+10 > len(data) {
+				return 0, errMalformed
+			}
+			frames++
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			// LZW minimum code size, then the image data
+			pos++
+			if !skipSubBlocks() {
+				return 0, errMalformed
+			}
+		case 0x3B: // Trailer
+			return frames, nil
+		default:
+			return 0, errMalformed
+		}
+	}
+	if pos > len(data) {
+		return 0, errMalformed
+	}
+	return frames, nil
+}
+
+// thumbnail scales img down so that its longest side is thumbnailSize.
+func thumbnail(img image.Image) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > height && width > thumbnailSize {
+		height = max(1, height*thumbnailSize/width)
+		width = thumbnailSize
+	} else if height > thumbnailSize {
+		width = max(1, width*thumbnailSize/height)
+		height = thumbnailSize
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"strings"
+	"testing"
+)
+
+// encodeGIF returns a GIF with a width x height screen and frames 1x1
+// frames, so that large animations stay small on disk. With localPalette,
+// every frame carries its own color table.
+func encodeGIF(t *testing.T, width, height, frames int, localPalette bool) []byte {
+	t.Helper()
+	palette := color.Palette{color.Black, color.White}
+	anim := &gif.GIF{Config: image.Config{ColorModel: palette, Width: width, Height: height}}
+	for i := 0; i < frames; i++ {
+		framePalette := palette
+		if localPalette {
+			framePalette = color.Palette{color.Gray{Y: uint8(i)}, color.White, color.Black, color.Gray{Y: 128}}
+		}
+		frame := image.NewPaletted(image.Rect(0, 0, 1, 1), framePalette)
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10)
+	}
+	var out bytes.Buffer
+	if err := gif.EncodeAll(&out, anim); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestGIFFrameCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    int
+		wantErr bool
+	}{
+		{"one frame", encodeGIF(t, 10, 10, 1, false), 1, false},
+		{"many frames", encodeGIF(t, 10, 10, 25, false), 25, false},
+		{"local color tables", encodeGIF(t, 10, 10, 3, true), 3, false},
+		{"truncated header", []byte("GIF89a"), 0, true},
+		{"truncated color table", encodeGIF(t, 10, 10, 1, false)[:15], 0, true},
+		{"unknown block", append(encodeGIF(t, 10, 10, 1, false)[:19], 0x99), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := gifFrameCount(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("gifFrameCount error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("gifFrameCount = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessImageBoundsGIFFrames(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"small animation", encodeGIF(t, 100, 100, 10, false), ""},
+		{"large single frame", encodeGIF(t, 7000, 7000, 1, false), ""},
+		{"too many large frames", encodeGIF(t, 7000, 7000, 2, false), "too large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := processImage(tt.data, "image/gif")
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("processImage: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("processImage error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
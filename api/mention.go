@@ -0,0 +1,64 @@
+package api
+
+import (
+	"html"
+	"log"
+	"regexp"
+	"strings"
+
+	"knife/db"
+)
+
+// maxMentions is the most accounts resolved for one note. Further mentions
+// stay plain text.
+const maxMentions = 20
+
+// mentionPattern matches @user@host at the start of the text or after a
+// character that cannot be part of a word, URL or address.
+var mentionPattern = regexp.MustCompile(`(^|[^\p{L}\p{N}_/@.])@([\p{L}\p{N}_.\-]+)@([\p{L}\p{N}\-]+(?:\.[\p{L}\p{N}\-]+)+(?::\d+)?)`)
+
+// linkMentions resolves the @user@host mentions in rendered note HTML with
+// resolve and turns them into links to the mentioned profiles. It returns
+// the mentions in order of first use. Accounts that cannot be resolved stay
+// plain text.
+func linkMentions(content string, resolve func(account string) (*db.NoteMention, error)) (string, []db.NoteMention) {
+	var mentions []db.NoteMention
+	resolved := make(map[string]*db.NoteMention)
+
+	linked := rewriteText(content, func(text string) string {
+		matches := mentionPattern.FindAllStringSubmatchIndex(text, -1)
+		// m[3] is the end of the prefix, where the @ is.
+		return replaceMatches(text, matches, 3, 1, func(m []int) (string, bool) {
+			user := text[m[4]:m[5]]
+			account := strings.ToLower(user + "@" + text[m[6]:m[7]])
+			mention, ok := resolved[account]
+			if !ok {
+				if len(resolved) >= maxMentions {
+					return "", false
+				}
+				var err error
+				mention, err = resolve(account)
+				if err != nil {
+					log.Printf("failed to resolve mention of %s: %v", account, err)
+				} else if !mentionsActor(mentions, mention.ActorURI) {
+					mentions = append(mentions, *mention)
+				}
+				resolved[account] = mention
+			}
+			if mention == nil {
+				return "", false
+			}
+			return `<span class="h-card"><a href="` + html.EscapeString(mention.URL) + `" class="u-url mention">@<span>` + html.EscapeString(user) + `</span></a></span>`, true
+		})
+	})
+	return linked, mentions
+}
+
+func mentionsActor(mentions []db.NoteMention, actorURI string) bool {
+	for _, mention := range mentions {
+		if mention.ActorURI == actorURI {
+			return true
+		}
+	}
+	return false
+}
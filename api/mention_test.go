@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"knife/db"
+)
+
+func TestLinkMentions(t *testing.T) {
+	accounts := map[string]*db.NoteMention{
+		"bob@remote.example":        {ActorURI: "https://remote.example/users/bob", Acct: "bob@remote.example", URL: "https://remote.example/@bob"},
+		"bob@alias.example":         {ActorURI: "https://remote.example/users/bob", Acct: "bob@remote.example", URL: "https://remote.example/@bob"},
+		"carol@remote.example:8443": {ActorURI: "https://remote.example:8443/users/carol", Acct: "carol@remote.example:8443", URL: "https://remote.example:8443/@carol"},
+	}
+	link := func(user, url string) string {
+		return `<span class="h-card"><a href="` + url + `" class="u-url mention">@<span>` + user + `</span></a></span>`
+	}
+	bob := link("bob", "https://remote.example/@bob")
+
+	tests := []struct {
+		name         string
+		content      string
+		want         string
+		wantMentions []string
+		wantResolved []string
+	}{
+		{"none", "<p>hello</p>", "<p>hello</p>", nil, nil},
+		{"start", "<p>@bob@remote.example hi</p>", "<p>" + bob + " hi</p>", []string{"bob@remote.example"}, []string{"bob@remote.example"}},
+		{"after space", "<p>hi @bob@remote.example.</p>", "<p>hi " + bob + ".</p>", []string{"bob@remote.example"}, []string{"bob@remote.example"}},
+		{"case", "<p>@Bob@Remote.Example</p>", "<p>" + link("Bob", "https://remote.example/@bob") + "</p>", []string{"bob@remote.example"}, []string{"bob@remote.example"}},
+		{"port", "<p>@carol@remote.example:8443</p>", "<p>" + link("carol", "https://remote.example:8443/@carol") + "</p>", []string{"carol@remote.example:8443"}, []string{"carol@remote.example:8443"}},
+		{"unknown account", "<p>@dave@remote.example</p>", "<p>@dave@remote.example</p>", nil, []string{"dave@remote.example"}},
+		{"address", "<p>mail bob@remote.example</p>", "<p>mail bob@remote.example</p>", nil, nil},
+		{"inside word", "<p>x@bob@remote.example</p>", "<p>x@bob@remote.example</p>", nil, nil},
+		{"no host", "<p>@bob hi</p>", "<p>@bob hi</p>", nil, nil},
+		{"inside link", `<p><a href="/x">@bob@remote.example</a></p>`, `<p><a href="/x">@bob@remote.example</a></p>`, nil, nil},
+		{"repeated", "<p>@bob@remote.example @bob@remote.example</p>", "<p>" + bob + " " + bob + "</p>", []string{"bob@remote.example"}, []string{"bob@remote.example"}},
+		{"same actor", "<p>@bob@remote.example @bob@alias.example</p>", "<p>" + bob + " " + bob + "</p>", []string{"bob@remote.example"}, []string{"bob@remote.example", "bob@alias.example"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resolved []string
+			got, mentions := linkMentions(tt.content, func(account string) (*db.NoteMention, error) {
+				resolved = append(resolved, account)
+				if mention, ok := accounts[account]; ok {
+					return mention, nil
+				}
+				return nil, errors.New("not found")
+			})
+			if got != tt.want {
+				t.Errorf("content = %s\nwant      %s", got, tt.want)
+			}
+			var accts []string
+			for _, mention := range mentions {
+				accts = append(accts, mention.Acct)
+			}
+			if !slices.Equal(accts, tt.wantMentions) {
+				t.Errorf("mentions = %q, want %q", accts, tt.wantMentions)
+			}
+			if !slices.Equal(resolved, tt.wantResolved) {
+				t.Errorf("resolved = %q, want %q", resolved, tt.wantResolved)
+			}
+		})
+	}
+}
+
+func TestLinkMentionsLimit(t *testing.T) {
+	content := "<p>"
+	for i := range maxMentions + 1 {
+		content += fmt.Sprintf("@user%d@remote.example ", i)
+	}
+	content += "</p>"
+
+	calls := 0
+	_, mentions := linkMentions(content, func(account string) (*db.NoteMention, error) {
+		calls++
+		return &db.NoteMention{ActorURI: "https://remote.example/" + account, Acct: account}, nil
+	})
+	if calls != maxMentions || len(mentions) != maxMentions {
+		t.Errorf("resolved %d and kept %d mentions, want %d", calls, len(mentions), maxMentions)
+	}
+}
@@ -2,14 +2,15 @@ package api
 
 import (
 	"database/sql"
+	"encoding/json"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
 	"time"
 
 	"knife/ap"
 	"knife/base"
+	"knife/config"
 	"knife/db"
 
 	"github.com/gomarkdown/markdown"
@@ -17,21 +18,17 @@ import (
 )
 
 type NoteAPI struct {
+	cfg           *config.Config
+	authAPI       *AuthAPI
 	noteModel     *db.NoteModel
 	profileModel  *db.ProfileModel
 	followerModel *db.FollowerModel
+	mediaModel    *db.MediaModel
 	dispatcher    *ap.ActivityDispatcher
 }
 
-func NewNoteAPI(noteModel *db.NoteModel, profileModel *db.ProfileModel, followerModel *db.FollowerModel, dispatcher *ap.ActivityDispatcher) *NoteAPI {
-	return &NoteAPI{noteModel: noteModel, profileModel: profileModel, followerModel: followerModel, dispatcher: dispatcher}
-}
-
-func (a *NoteAPI) getHost(fallback string) string {
-	if host := os.Getenv("KNIFE_HOST"); host != "" {
-		return host
-	}
-	return fallback
+func NewNoteAPI(cfg *config.Config, authAPI *AuthAPI, noteModel *db.NoteModel, profileModel *db.ProfileModel, followerModel *db.FollowerModel, mediaModel *db.MediaModel, dispatcher *ap.ActivityDispatcher) *NoteAPI {
+	return &NoteAPI{cfg: cfg, authAPI: authAPI, noteModel: noteModel, profileModel: profileModel, followerModel: followerModel, mediaModel: mediaModel, dispatcher: dispatcher}
 }
 
 type NoteResponse struct {
@@ -39,6 +36,7 @@ type NoteResponse struct {
 	URI          string             `json:"uri"`
 	Cw           string             `json:"cw,omitempty"`
 	Content      string             `json:"content"`
+	Source       string             `json:"source,omitempty"`
 	Host         string             `json:"host"`
 	AuthorName   string             `json:"author_name"`
 	AuthorFinger string             `json:"author_finger"`
@@ -47,6 +45,103 @@ type NoteResponse struct {
 	Category     string             `json:"category,omitempty"`
 	Likes        int                `json:"likes"`
 	Shares       int                `json:"shares"` 
+	UpdateTime   *time.Time         `json:"update_time,omitempty"`
+	Attachments  []MediaResponse    `json:"attachments,omitempty"`
+	Tags         []string           `json:"tags,omitempty"`
+	Mentions     []db.NoteMention   `json:"mentions,omitempty"`
+	InReplyTo    string             `json:"in_reply_to,omitempty"`
+	Boost        *NoteResponse      `json:"boost,omitempty"`
+	Liked        bool               `json:"liked,omitempty"`
+	Boosted      bool               `json:"boosted,omitempty"`
+}
+
+func newNoteResponse(note *db.Note) NoteResponse {
+	var boost *NoteResponse
+	if note.Boost != nil {
+		response := newNoteResponse(note.Boost)
+		boost = &response
+	}
+	return NoteResponse{
+		ID:           note.ID,
+		URI:          note.URI,
+		Cw:           note.Cw,
+		Content:      note.Content,
+		Source:       note.Source,
+		Host:         note.Host,
+		AuthorName:   note.AuthorName,
+		AuthorFinger: note.AuthorFinger,
+		PublicRange:  note.PublicRange,
+		CreateTime:   note.CreateTime,
+		Category:     note.Category,
+		Likes:        int(note.Likes),
+		Shares:       int(note.Shares),
+		UpdateTime:   note.UpdateTime,
+		Attachments:  newAttachmentResponses(note.Attachments),
+		Tags:         note.Tags,
+		Mentions:     note.Mentions,
+		InReplyTo:    note.InReplyTo,
+		Boost:        boost,
+		Liked:        note.Liked,
+		Boosted:      note.Boosted,
+	}
+}
+
+// renderMarkdown converts note markdown into sanitized HTML.
+func renderMarkdown(source string) string {
+	unsafeHTML := markdown.ToHTML([]byte(source), nil, nil)
+	return string(bluemonday.UGCPolicy().SanitizeBytes(unsafeHTML))
+}
+
+// renderNote renders the markdown source of a note, links its mentions and
+// hashtags and returns the HTML with the tags and mentions found.
+func (a *NoteAPI) renderNote(source string) (string, []string, []db.NoteMention) {
+	content, mentions := linkMentions(renderMarkdown(source), a.dispatcher.ResolveMention)
+	content, tags := linkHashtags(content, a.cfg.BaseURL)
+	return content, tags, mentions
+}
+
+// mentionParentAuthor adds the author of the note a reply answers to its
+// mentions, so that the reply is addressed and delivered to them.
+func (a *NoteAPI) mentionParentAuthor(note *db.Note) {
+	if note.InReplyTo == "" {
+		return
+	}
+	parent, err := a.noteModel.GetByURI(note.InReplyTo)
+	if err != nil {
+		log.Printf("failed to load the note %s replies to: %v", note.InReplyTo, err)
+		return
+	}
+	if parent.IsLocal() || mentionsActor(note.Mentions, parent.AuthorURI) {
+		return
+	}
+	mention, err := a.dispatcher.MentionActor(parent.AuthorURI, parent.AuthorFinger)
+	if err != nil {
+		log.Printf("failed to resolve the author of %s: %v", parent.URI, err)
+		return
+	}
+	note.Mentions = append([]db.NoteMention{*mention}, note.Mentions...)
+}
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// returnNotePage writes one page of notes, linking to the neighbouring pages
+// through the Link header.
+func returnNotePage(ctx base.APIContext, page base.Pagination, notes []db.Note) {
+	if len(notes) > 0 {
+		ctx.SetPaginationLinks(page, notes[0].ID, notes[len(notes)-1].ID, len(notes))
+	}
+	ctx.ReturnJSON(newNoteResponses(notes))
+}
+
+func newNoteResponses(notes []db.Note) []NoteResponse {
+	responses := make([]NoteResponse, 0, len(notes))
+	for i := range notes {
+		responses = append(responses, newNoteResponse(&notes[i]))
+	}
+	return responses
 }
 
 // RegisterHandlers registers the API handlers for notes.
@@ -54,56 +149,94 @@ func (a *NoteAPI) RegisterHandlers(router *base.APIRouter) {
 	router.GET("notes", a.listNotes, []string{"AuthMiddleware"})
 	router.POST("notes", a.createNote, []string{"AuthMiddleware"})
 	router.GET("notes/{id}", a.getNote, nil)
+	router.PUT("notes/{id}", a.updateNote, []string{"AuthMiddleware"})
+	router.GET("notes/{id}/revisions", a.listRevisions, []string{"AuthMiddleware"})
+	router.GET("notes/{id}/context", a.getContext, nil)
 	router.DELETE("notes/{id}", a.deleteNote, []string{"AuthMiddleware"})
 }
 
 func (a *NoteAPI) listNotes(ctx base.APIContext) {
-	notes, err := a.noteModel.ListRecent()
+	page, err := ctx.GetPagination(defaultPageLimit, maxPageLimit)
 	if err != nil {
-		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		ctx.ReturnError("badrequest", err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	noteResponses := make([]NoteResponse, 0, len(notes))
-	for _, note := range notes {
-		noteResponses = append(noteResponses, NoteResponse{
-			ID:           note.ID,
-			URI:          note.URI,
-			Cw:           note.Cw,
-			Content:      note.Content,
-			Host:         note.Host,
-			AuthorName:   note.AuthorName,
-			AuthorFinger: note.AuthorFinger,
-			PublicRange:  note.PublicRange,
-			CreateTime:   note.CreateTime,
-			Category:     note.Category,
-			Likes:        int(note.Likes),
-			Shares:       int(note.Shares),
-		})
+	notes, err := a.noteModel.ListRecent(page.Limit, page.Before, page.After)
+	if err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	ctx.ReturnJSON(noteResponses)
+	returnNotePage(ctx, page, notes)
 }
 
 func (a *NoteAPI) createNote(ctx base.APIContext) {
-	var note db.Note
-	if err := ctx.GetContext(&note); err != nil {
+	// Only these fields are set by the client; the rest of the note is
+	// filled in here.
+	var req struct {
+		Content     string              `json:"content"`
+		Cw          string              `json:"cw"`
+		Category    string              `json:"category"`
+		PublicRange db.NotePublicRange  `json:"public_range,string"`
+		Attachments []db.NoteAttachment `json:"attachments"`
+		// InReplyToID is the ID of the note this one replies to.
+		InReplyToID int64 `json:"in_reply_to_id"`
+	}
+	if err := json.Unmarshal(ctx.RawBody(), &req); err != nil {
 		ctx.ReturnError("badrequest", "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
+	note := db.Note{
+		Cw:          req.Cw,
+		Content:     req.Content,
+		Category:    req.Category,
+		PublicRange: req.PublicRange,
+		Attachments: req.Attachments,
+	}
+	if req.InReplyToID != 0 {
+		parent, err := a.noteModel.Get(req.InReplyToID)
+		if err == sql.ErrNoRows {
+			ctx.ReturnError("badrequest", "The note replied to does not exist", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+			return
+		}
+		note.InReplyTo = parent.URI
+	}
+
 	profile, err := a.profileModel.Get()
 	if err != nil {
 		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	note.Host = a.getHost(ctx.GetHost())
+	note.Host = a.cfg.Host()
 	note.AuthorName = profile.DisplayName
 	note.AuthorFinger = profile.Finger
-	unsafeHTML := markdown.ToHTML([]byte(note.Content), nil, nil)
-	note.Content = string(bluemonday.UGCPolicy().SanitizeBytes(unsafeHTML))
-	if err := a.noteModel.CreateLocalNote(&note); err != nil {
+	note.Source = note.Content
+	note.Content, note.Tags, note.Mentions = a.renderNote(note.Source)
+	a.mentionParentAuthor(&note)
+	note.Attachments, err = loadAttachments(a.mediaModel, note.Attachments)
+	if err != nil {
+		ctx.ReturnError("badrequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := a.noteModel.CreateLocalNote(&note, a.cfg.BaseURL); err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := a.noteModel.SetAttachments(note.ID, note.Attachments); err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := a.noteModel.SetTags(note.ID, note.Tags); err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := a.noteModel.SetMentions(note.ID, note.Mentions); err != nil {
 		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -134,25 +267,170 @@ func (a *NoteAPI) getNote(ctx base.APIContext) {
 		}
 		return
 	}
-
-	response := NoteResponse{
-		ID:           note.ID,
-		URI:          note.URI,
-		Cw:           note.Cw,
-		Content:      note.Content,
-		Host:         note.Host,
-		AuthorName:   note.AuthorName,
-		AuthorFinger: note.AuthorFinger,
-		PublicRange:  note.PublicRange,
-		CreateTime:   note.CreateTime,
-		Category:     note.Category,
-		Likes:        int(note.Likes),
-		Shares:       int(note.Shares),
+	// Hidden notes look the same as missing ones.
+	if !note.VisibleTo(a.authAPI.viewer(ctx)) {
+		ctx.ReturnError("notfound", "Note not found", http.StatusNotFound)
+		return
 	}
 
+	response := newNoteResponse(note)
+
 	ctx.ReturnJSON(response)
 }
 
+func (a *NoteAPI) updateNote(ctx base.APIContext) {
+	idStr := ctx.GetPathParamValue("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		ctx.ReturnError("badrequest", "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	note, err := a.noteModel.Get(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.ReturnError("notfound", "Note not found", http.StatusNotFound)
+		} else {
+			ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	profile, err := a.profileModel.Get()
+	if err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if note.AuthorFinger != profile.Finger {
+		ctx.ReturnError("forbidden", "Only local notes can be edited", http.StatusForbidden)
+		return
+	}
+	if note.BoostOf != 0 {
+		ctx.ReturnError("badrequest", "Boosts cannot be edited", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Content     string             `json:"content"`
+		Cw          string             `json:"cw"`
+		Category    string             `json:"category"`
+		PublicRange db.NotePublicRange `json:"public_range,string"`
+		// Attachments replaces the attached media when present.
+		Attachments *[]db.NoteAttachment `json:"attachments"`
+	}
+	req.PublicRange = note.PublicRange
+	if err := json.Unmarshal(ctx.RawBody(), &req); err != nil {
+		ctx.ReturnError("badrequest", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Content == "" {
+		ctx.ReturnError("badrequest", "Content is required", http.StatusBadRequest)
+		return
+	}
+
+	if req.Attachments != nil {
+		note.Attachments, err = loadAttachments(a.mediaModel, *req.Attachments)
+		if err != nil {
+			ctx.ReturnError("badrequest", err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	note.Source = req.Content
+	note.Content, note.Tags, note.Mentions = a.renderNote(req.Content)
+	a.mentionParentAuthor(note)
+	note.Cw = req.Cw
+	note.Category = req.Category
+	note.PublicRange = req.PublicRange
+	if err := a.noteModel.Revise(note); err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if req.Attachments != nil {
+		if err := a.noteModel.SetAttachments(note.ID, note.Attachments); err != nil {
+			ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := a.noteModel.SetTags(note.ID, note.Tags); err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := a.noteModel.SetMentions(note.ID, note.Mentions); err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := a.dispatcher.SendUpdateNote(note); err != nil {
+		log.Printf("failed to dispatch update note activity: %v", err)
+	}
+
+	ctx.ReturnJSON(newNoteResponse(note))
+}
+
+// ThreadResponse is the thread a note is part of.
+type ThreadResponse struct {
+	Ancestors   []NoteResponse `json:"ancestors"`
+	Descendants []NoteResponse `json:"descendants"`
+}
+
+func (a *NoteAPI) getContext(ctx base.APIContext) {
+	idStr := ctx.GetPathParamValue("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		ctx.ReturnError("badrequest", "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	note, err := a.noteModel.Get(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.ReturnError("notfound", "Note not found", http.StatusNotFound)
+		} else {
+			ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	viewer := a.authAPI.viewer(ctx)
+	if !note.VisibleTo(viewer) {
+		ctx.ReturnError("notfound", "Note not found", http.StatusNotFound)
+		return
+	}
+
+	ancestors, err := a.noteModel.ListAncestors(note, viewer)
+	if err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	descendants, err := a.noteModel.ListDescendants(note, viewer)
+	if err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctx.ReturnJSON(ThreadResponse{
+		Ancestors:   newNoteResponses(ancestors),
+		Descendants: newNoteResponses(descendants),
+	})
+}
+
+func (a *NoteAPI) listRevisions(ctx base.APIContext) {
+	idStr := ctx.GetPathParamValue("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		ctx.ReturnError("badrequest", "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	revisions, err := a.noteModel.ListRevisions(id)
+	if err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctx.ReturnJSON(revisions)
+}
+
 func (a *NoteAPI) deleteNote(ctx base.APIContext) {
 	idStr := ctx.GetPathParamValue("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
@@ -170,6 +448,10 @@ func (a *NoteAPI) deleteNote(ctx base.APIContext) {
 		}
 		return
 	}
+	if note.BoostOf != 0 {
+		ctx.ReturnError("badrequest", "Boosts are undone through DELETE /api/boosts", http.StatusBadRequest)
+		return
+	}
 
 	if err := a.dispatcher.SendDeleteNote(note); err != nil {
 		log.Printf("failed to dispatch delete note activity: %v", err)
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"knife/ap"
+	"knife/base"
+	"knife/config"
+	"knife/db"
+)
+
+// newTestNoteAPI returns a NoteModel on a fresh database with an owner
+// profile, and a router serving NoteAPI without middlewares.
+func newTestNoteAPI(t *testing.T) (*db.NoteModel, *base.APIRouter) {
+	t.Helper()
+	dbconn, err := db.InitDB(filepath.Join(t.TempDir(), "knife.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { dbconn.Close() })
+
+	cfg := config.Default()
+	cfg.BaseURL = "https://knife.example"
+	profileModel := db.NewProfileModel(dbconn)
+	if err := profileModel.Create(&db.Profile{Finger: "alice", DisplayName: "Alice"}); err != nil {
+		t.Fatalf("Create profile: %v", err)
+	}
+	noteModel := db.NewNoteModel(dbconn)
+	followerModel := db.NewFollowerModel(dbconn)
+	dispatcher := ap.NewActivityDispatcher(cfg, ap.NewFetcher(cfg), followerModel, db.NewFollowingModel(dbconn), db.NewHTTPSigModel(dbconn), db.NewDeliveryModel(dbconn), nil)
+
+	a := NewNoteAPI(cfg, nil, noteModel, profileModel, followerModel, db.NewMediaModel(dbconn), dispatcher)
+	router := base.NewAPIRouter()
+	router.SetPrefix("api")
+	a.RegisterHandlers(&router)
+	return noteModel, &router
+}
+
+func TestCreateNoteIgnoresServerFields(t *testing.T) {
+	noteModel, router := newTestNoteAPI(t)
+	private := &db.Note{Content: "private", Host: "knife.example", AuthorFinger: "alice", PublicRange: db.NotePublicRangePrivate}
+	if err := noteModel.CreateLocalNote(private, "https://knife.example"); err != nil {
+		t.Fatalf("CreateLocalNote: %v", err)
+	}
+
+	rec := serve(router, http.MethodPost, "/api/notes", map[string]any{
+		"content":      "hello",
+		"public_range": "0",
+		"boost_of":     private.ID,
+		"uri":          "https://evil.example/notes/1",
+		"author_uri":   "https://evil.example/users/mallory",
+		"host":         "evil.example",
+		"likes":        100,
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+
+	notes, err := noteModel.ListRecent(1, 0, 0)
+	if err != nil || len(notes) != 1 {
+		t.Fatalf("ListRecent = %v, %v", notes, err)
+	}
+	note := notes[0]
+	if note.ID == private.ID {
+		t.Fatal("no note was created")
+	}
+	if note.BoostOf != 0 {
+		t.Errorf("BoostOf = %d, want 0", note.BoostOf)
+	}
+	if note.Boost != nil {
+		t.Errorf("note boosts %s", note.Boost.URI)
+	}
+	if want := "https://knife.example/notes/" + fmt.Sprint(note.ID); note.URI != want {
+		t.Errorf("URI = %s, want %s", note.URI, want)
+	}
+	if note.AuthorURI != "" || note.Host != "knife.example" || note.Likes != 0 {
+		t.Errorf("AuthorURI, Host, Likes = %q, %q, %d, want them set by the server", note.AuthorURI, note.Host, note.Likes)
+	}
+}
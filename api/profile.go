@@ -5,16 +5,19 @@ import (
 	"encoding/json"
 	"net/http"
 	"knife/base"
+	"knife/config"
 	"knife/db"
 )
 
 type ProfileAPI struct {
+	cfg          *config.Config
 	profileModel *db.ProfileModel
 	noteModel    *db.NoteModel
+	authAPI      *AuthAPI
 }
 
-func NewProfileAPI(profileModel *db.ProfileModel, noteModel *db.NoteModel) *ProfileAPI {
-	return &ProfileAPI{profileModel: profileModel, noteModel: noteModel}
+func NewProfileAPI(cfg *config.Config, profileModel *db.ProfileModel, noteModel *db.NoteModel, authAPI *AuthAPI) *ProfileAPI {
+	return &ProfileAPI{cfg: cfg, profileModel: profileModel, noteModel: noteModel, authAPI: authAPI}
 }
 
 // RegisterHandlers registers the API handlers for profiles.
@@ -35,19 +38,27 @@ func (a *ProfileAPI) getProfile(ctx base.APIContext) {
 		return
 	}
 
-	profile.Finger = "@" + profile.Finger + "@" + ctx.GetHost()
+	profile.Finger = "@" + profile.Finger + "@" + a.cfg.Host()
 	profile.PasswordHash = "" // Hide sensitive information
 	ctx.ReturnJSON(profile)
 }
 
 func (a *ProfileAPI) updateProfile(ctx base.APIContext) {
-	var profile db.Profile
-	if err := json.Unmarshal(ctx.RawBody(), &profile); err != nil {
+	profile, err := a.profileModel.Get()
+	if err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Fields missing from the request keep their stored values.
+	finger := profile.Finger
+	if err := json.Unmarshal(ctx.RawBody(), profile); err != nil {
 		ctx.ReturnError("badrequest", "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	profile.Finger = finger
 
-	if err := a.profileModel.Update(&profile); err != nil {
+	if err := a.profileModel.Update(profile); err != nil {
 		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -56,27 +67,17 @@ func (a *ProfileAPI) updateProfile(ctx base.APIContext) {
 }
 
 func (a *ProfileAPI) getRecentNotes(ctx base.APIContext) {
-	notes, err := a.noteModel.ListByMyRecent()
+	page, err := ctx.GetPagination(defaultPageLimit, maxPageLimit)
 	if err != nil {
-		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		ctx.ReturnError("badrequest", err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	noteResponses := make([]NoteResponse, 0, len(notes))
-	for _, note := range notes {
-		noteResponses = append(noteResponses, NoteResponse{
-			ID:           note.ID,
-			URI:          note.URI,
-			Cw:           note.Cw,
-			Content:      note.Content,
-			Host:         note.Host,
-			AuthorName:   note.AuthorName,
-			AuthorFinger: note.AuthorFinger,
-			PublicRange:  note.PublicRange,
-			CreateTime:   note.CreateTime,
-			Category:     note.Category,
-		})
+	notes, err := a.noteModel.ListByMyRecent(a.authAPI.viewer(ctx), page.Limit, page.Before, page.After)
+	if err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	ctx.ReturnJSON(noteResponses)
+	returnNotePage(ctx, page, notes)
 }
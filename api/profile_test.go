@@ -0,0 +1,35 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"knife/base"
+	"knife/db"
+)
+
+func TestGetProfileUsesConfiguredHost(t *testing.T) {
+	a, _ := newTestAuthAPI(t)
+	profileAPI := NewProfileAPI(a.cfg, a.ProfileModel, nil, a)
+	router := base.NewAPIRouter()
+	router.SetPrefix("api")
+	profileAPI.RegisterHandlers(&router)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/profile", nil)
+	req.Host = "evil.example"
+	rec := httptest.NewRecorder()
+	router.GetMUX().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var profile db.Profile
+	if err := json.Unmarshal(rec.Body.Bytes(), &profile); err != nil {
+		t.Fatal(err)
+	}
+	if want := "@alice@knife.example"; profile.Finger != want {
+		t.Errorf("finger = %s, want %s", profile.Finger, want)
+	}
+}
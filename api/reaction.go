@@ -0,0 +1,227 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"knife/ap"
+	"knife/base"
+	"knife/config"
+	"knife/db"
+)
+
+type ReactionAPI struct {
+	cfg          *config.Config
+	noteModel    *db.NoteModel
+	profileModel *db.ProfileModel
+	dispatcher   *ap.ActivityDispatcher
+}
+
+func NewReactionAPI(cfg *config.Config, noteModel *db.NoteModel, profileModel *db.ProfileModel, dispatcher *ap.ActivityDispatcher) *ReactionAPI {
+	return &ReactionAPI{cfg: cfg, noteModel: noteModel, profileModel: profileModel, dispatcher: dispatcher}
+}
+
+// RegisterHandlers registers the API handlers for likes and boosts.
+func (a *ReactionAPI) RegisterHandlers(router *base.APIRouter) {
+	router.POST("likes", a.like, []string{"AuthMiddleware"})
+	router.DELETE("likes", a.unlike, []string{"AuthMiddleware"})
+	router.POST("boosts", a.boost, []string{"AuthMiddleware"})
+	router.DELETE("boosts", a.unboost, []string{"AuthMiddleware"})
+}
+
+// reactionTarget identifies a note by its ID or its URI.
+type reactionTarget struct {
+	NoteID int64  `json:"note_id"`
+	URI    string `json:"uri"`
+}
+
+// bodyTarget reads the note a reaction is for from the request body.
+func bodyTarget(ctx base.APIContext) (reactionTarget, error) {
+	var target reactionTarget
+	err := ctx.GetContext(&target)
+	return target, err
+}
+
+// queryTarget reads the note a reaction is for from the note_id or uri
+// query parameter.
+func queryTarget(ctx base.APIContext) (reactionTarget, error) {
+	var target reactionTarget
+	query := ctx.GetRequest().URL.Query()
+	if idStr := query.Get("note_id"); idStr != "" {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			return target, fmt.Errorf("invalid note_id %q", idStr)
+		}
+		target.NoteID = id
+	}
+	target.URI = query.Get("uri")
+	return target, nil
+}
+
+// findNote loads the note a reaction is for. A boost stands for the note it
+// boosts. It writes the error response and returns nil when there is no
+// such note.
+func (a *ReactionAPI) findNote(ctx base.APIContext, target reactionTarget) *db.Note {
+	var note *db.Note
+	var err error
+	switch {
+	case target.NoteID != 0:
+		note, err = a.noteModel.Get(target.NoteID)
+	case target.URI != "":
+		note, err = a.noteModel.GetByURI(target.URI)
+	default:
+		ctx.ReturnError("badrequest", "note_id or uri is required", http.StatusBadRequest)
+		return nil
+	}
+	if err == sql.ErrNoRows {
+		ctx.ReturnError("notfound", "Note not found", http.StatusNotFound)
+		return nil
+	} else if err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+
+	if note.Boost != nil {
+		return note.Boost
+	}
+	return note
+}
+
+// returnNote writes the current state of a note after a reaction.
+func (a *ReactionAPI) returnNote(ctx base.APIContext, id int64) {
+	note, err := a.noteModel.Get(id)
+	if err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx.ReturnJSON(newNoteResponse(note))
+}
+
+func (a *ReactionAPI) like(ctx base.APIContext) {
+	target, err := bodyTarget(ctx)
+	if err != nil {
+		ctx.ReturnError("badrequest", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	note := a.findNote(ctx, target)
+	if note == nil {
+		return
+	}
+
+	if !note.Liked {
+		like := &db.NoteLike{
+			NoteID:     note.ID,
+			ActivityID: fmt.Sprintf("%s/activities/like-%d", a.cfg.BaseURL, time.Now().UnixNano()),
+		}
+		if err := a.noteModel.AddLike(like); err != nil {
+			ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := a.dispatcher.SendLike(note, like); err != nil {
+			log.Printf("failed to dispatch like activity: %v", err)
+		}
+	}
+
+	a.returnNote(ctx, note.ID)
+}
+
+func (a *ReactionAPI) unlike(ctx base.APIContext) {
+	target, err := queryTarget(ctx)
+	if err != nil {
+		ctx.ReturnError("badrequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+	note := a.findNote(ctx, target)
+	if note == nil {
+		return
+	}
+
+	like, err := a.noteModel.GetLike(note.ID)
+	if err == nil {
+		if err := a.noteModel.RemoveLike(note.ID); err != nil {
+			ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := a.dispatcher.SendUndoLike(note, like); err != nil {
+			log.Printf("failed to dispatch undo like activity: %v", err)
+		}
+	} else if err != sql.ErrNoRows {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	a.returnNote(ctx, note.ID)
+}
+
+func (a *ReactionAPI) boost(ctx base.APIContext) {
+	target, err := bodyTarget(ctx)
+	if err != nil {
+		ctx.ReturnError("badrequest", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	note := a.findNote(ctx, target)
+	if note == nil {
+		return
+	}
+	if note.PublicRange != db.NotePublicRangePublic && note.PublicRange != db.NotePublicRangeUnlisted {
+		ctx.ReturnError("forbidden", "Only public and unlisted notes can be boosted", http.StatusForbidden)
+		return
+	}
+
+	if !note.Boosted {
+		profile, err := a.profileModel.Get()
+		if err != nil {
+			ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+			return
+		}
+		boost := &db.Note{
+			Host:         a.cfg.Host(),
+			AuthorName:   profile.DisplayName,
+			AuthorFinger: profile.Finger,
+			PublicRange:  db.NotePublicRangePublic,
+			BoostOf:      note.ID,
+			Boost:        note,
+		}
+		if err := a.noteModel.CreateBoost(boost, a.cfg.BaseURL); err != nil {
+			ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := a.dispatcher.SendAnnounce(boost); err != nil {
+			log.Printf("failed to dispatch announce activity: %v", err)
+		}
+	}
+
+	a.returnNote(ctx, note.ID)
+}
+
+func (a *ReactionAPI) unboost(ctx base.APIContext) {
+	target, err := queryTarget(ctx)
+	if err != nil {
+		ctx.ReturnError("badrequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+	note := a.findNote(ctx, target)
+	if note == nil {
+		return
+	}
+
+	boost, err := a.noteModel.GetBoost(note.ID)
+	if err == nil {
+		if err := a.dispatcher.SendUndoAnnounce(boost); err != nil {
+			log.Printf("failed to dispatch undo announce activity: %v", err)
+		}
+		if err := a.noteModel.DeleteBoost(boost); err != nil {
+			ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else if err != sql.ErrNoRows {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	a.returnNote(ctx, note.ID)
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"knife/base"
+	"knife/db"
+)
+
+// maxSearchQueryLength caps q so that a query cannot grow unbounded.
+const maxSearchQueryLength = 256
+
+// visibilityNames maps the visibility filter values to public ranges.
+var visibilityNames = map[string]db.NotePublicRange{
+	"public":    db.NotePublicRangePublic,
+	"unlisted":  db.NotePublicRangeUnlisted,
+	"followers": db.NotePublicRangeFollowers,
+	"private":   db.NotePublicRangePrivate,
+}
+
+type SearchAPI struct {
+	noteModel *db.NoteModel
+	authAPI   *AuthAPI
+}
+
+func NewSearchAPI(noteModel *db.NoteModel, authAPI *AuthAPI) *SearchAPI {
+	return &SearchAPI{noteModel: noteModel, authAPI: authAPI}
+}
+
+// SearchResultResponse is a note matched by a search. Snippet is HTML with
+// the matched terms wrapped in <mark>.
+type SearchResultResponse struct {
+	NoteResponse
+	Snippet string `json:"snippet"`
+}
+
+func (a *SearchAPI) RegisterHandlers(router *base.APIRouter) {
+	router.GET("search", a.search, nil)
+}
+
+func (a *SearchAPI) search(ctx base.APIContext) {
+	q := ctx.GetRequest().URL.Query()
+
+	text := strings.TrimSpace(q.Get("q"))
+	if text == "" {
+		ctx.ReturnError("badrequest", "q is required", http.StatusBadRequest)
+		return
+	}
+	if len(text) > maxSearchQueryLength {
+		ctx.ReturnError("badrequest", fmt.Sprintf("q must be at most %d bytes", maxSearchQueryLength), http.StatusBadRequest)
+		return
+	}
+	terms := parseSearchTerms(text)
+	if len(terms) == 0 {
+		ctx.ReturnError("badrequest", "q has no searchable terms", http.StatusBadRequest)
+		return
+	}
+
+	page, err := ctx.GetOffsetPagination(defaultPageLimit, maxPageLimit)
+	if err != nil {
+		ctx.ReturnError("badrequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	search := db.NoteSearch{
+		Terms:    terms,
+		Author:   strings.TrimPrefix(q.Get("author"), "@"),
+		Category: q.Get("category"),
+		Limit:    page.Limit,
+		Offset:   page.Offset,
+	}
+
+	if v := q.Get("visibility"); v != "" {
+		for _, name := range strings.Split(v, ",") {
+			publicRange, ok := visibilityNames[strings.TrimSpace(name)]
+			if !ok {
+				ctx.ReturnError("badrequest", fmt.Sprintf("invalid visibility %q", name), http.StatusBadRequest)
+				return
+			}
+			search.Visibilities = append(search.Visibilities, publicRange)
+		}
+	}
+	// Visitors only ever see public notes.
+	if !a.authAPI.isLoggedIn(ctx) {
+		if len(search.Visibilities) > 0 && !slices.Contains(search.Visibilities, db.NotePublicRangePublic) {
+			ctx.ReturnJSON([]SearchResultResponse{})
+			return
+		}
+		search.Visibilities = []db.NotePublicRange{db.NotePublicRangePublic}
+	}
+
+	if search.Since, err = parseSearchTime(q.Get("since"), false); err != nil {
+		ctx.ReturnError("badrequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if search.Until, err = parseSearchTime(q.Get("until"), true); err != nil {
+		ctx.ReturnError("badrequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results, err := a.noteModel.Search(search)
+	if err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	responses := make([]SearchResultResponse, 0, len(results))
+	for i := range results {
+		responses = append(responses, SearchResultResponse{
+			NoteResponse: newNoteResponse(&results[i].Note),
+			Snippet:      highlightSnippet(results[i].Snippet),
+		})
+	}
+	ctx.SetOffsetPaginationLinks(page, len(results))
+	ctx.ReturnJSON(responses)
+}
+
+// parseSearchTerms splits a search box query into terms. Text in double
+// quotes is matched as a phrase and every other word as a prefix, so that
+// "검색" also finds "검색은". All terms must match. Search operators in the
+// input are treated as plain words.
+func parseSearchTerms(text string) []db.SearchTerm {
+	var terms []db.SearchTerm
+	for i, part := range strings.Split(text, `"`) {
+		if i%2 == 1 {
+			// Inside quotes
+			if phrase := strings.Join(strings.Fields(part), " "); phrase != "" {
+				terms = append(terms, db.SearchTerm{Text: phrase})
+			}
+			continue
+		}
+		for _, word := range strings.Fields(part) {
+			terms = append(terms, db.SearchTerm{Text: word, Prefix: true})
+		}
+	}
+	return terms
+}
+
+// parseSearchTime parses a since or until filter given as a date or an
+// RFC 3339 time. A date used as until includes the whole day.
+func parseSearchTime(value string, until bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time %q, expected YYYY-MM-DD or RFC 3339", value)
+	}
+	if until {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// highlightSnippet escapes a search snippet and marks the matched terms.
+func highlightSnippet(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, db.SnippetMatchStart, "<mark>")
+	return strings.ReplaceAll(snippet, db.SnippetMatchEnd, "</mark>")
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+
+	"knife/ap"
+	"knife/base"
+	"knife/db"
+)
+
+type TagAPI struct {
+	noteModel *db.NoteModel
+	authAPI   *AuthAPI
+}
+
+func NewTagAPI(noteModel *db.NoteModel, authAPI *AuthAPI) *TagAPI {
+	return &TagAPI{noteModel: noteModel, authAPI: authAPI}
+}
+
+// RegisterHandlers registers the API handlers for hashtags.
+func (a *TagAPI) RegisterHandlers(router *base.APIRouter) {
+	router.GET("tags", a.listTags, nil)
+	router.GET("tags/{name}", a.listTagNotes, nil)
+}
+
+func (a *TagAPI) listTags(ctx base.APIContext) {
+	tags, err := a.noteModel.ListTags(a.authAPI.viewer(ctx))
+	if err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctx.ReturnJSON(tags)
+}
+
+func (a *TagAPI) listTagNotes(ctx base.APIContext) {
+	name := ap.NormalizeTag(ctx.GetPathParamValue("name"))
+	if name == "" {
+		ctx.ReturnError("badrequest", "Tag name is required", http.StatusBadRequest)
+		return
+	}
+
+	page, err := ctx.GetPagination(defaultPageLimit, maxPageLimit)
+	if err != nil {
+		ctx.ReturnError("badrequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	notes, err := a.noteModel.ListByTag(name, a.authAPI.viewer(ctx), page.Limit, page.Before, page.After)
+	if err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	returnNotePage(ctx, page, notes)
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+
+	"knife/base"
+	"knife/db"
+)
+
+type TimelineAPI struct {
+	noteModel *db.NoteModel
+}
+
+func NewTimelineAPI(noteModel *db.NoteModel) *TimelineAPI {
+	return &TimelineAPI{noteModel: noteModel}
+}
+
+func (a *TimelineAPI) RegisterHandlers(router *base.APIRouter) {
+	router.GET("timeline/home", a.homeTimeline, []string{"AuthMiddleware"})
+	router.GET("timeline/public", a.publicTimeline, nil)
+}
+
+func (a *TimelineAPI) homeTimeline(ctx base.APIContext) {
+	page, err := ctx.GetPagination(defaultPageLimit, maxPageLimit)
+	if err != nil {
+		ctx.ReturnError("badrequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	notes, err := a.noteModel.ListHome(page.Limit, page.Before, page.After)
+	if err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	returnNotePage(ctx, page, notes)
+}
+
+func (a *TimelineAPI) publicTimeline(ctx base.APIContext) {
+	page, err := ctx.GetPagination(defaultPageLimit, maxPageLimit)
+	if err != nil {
+		ctx.ReturnError("badrequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	notes, err := a.noteModel.ListPublic(page.Limit, page.Before, page.After)
+	if err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	returnNotePage(ctx, page, notes)
+}
@@ -0,0 +1,367 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"knife/base"
+)
+
+// TOTP parameters (RFC 6238). These are the defaults every authenticator
+// app supports.
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew is the number of time steps before and after the current
+	// one whose codes are still accepted, to allow for clock drift.
+	totpSkew = 1
+)
+
+// recoveryCodeCount is the number of recovery codes handed out at once.
+const recoveryCodeCount = 10
+
+// pendingSessionLifetime is how long a login may wait for its second factor.
+const pendingSessionLifetime = 5 * time.Minute
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newTOTPSecret returns a random 160-bit secret in base32.
+func newTOTPSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// totpCode returns the code of a secret for a time step (RFC 4226 HOTP
+// with the step as counter).
+func totpCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	h := hmac.New(sha1.New, key)
+	h.Write(counter[:])
+	sum := h.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// matchTOTP returns the time step whose code is code, if it is close
+// enough to now.
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := totpCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpURI returns the otpauth:// URI authenticator apps enroll from,
+// usually shown as a QR code.
+func totpURI(account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", "Knife")
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/Knife:" + account,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// newRecoveryCodes returns a fresh set of recovery codes, formatted as
+// xxxxx-xxxxx.
+func newRecoveryCodes() ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(buf))[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode drops what a user may add or change when typing a
+// recovery code: case, spaces and the dash.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// isTOTPCode reports whether code has the form of a TOTP code rather than
+// a recovery code.
+func isTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// TOTPStatusResponse tells whether TOTP is on.
+type TOTPStatusResponse struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// TOTPSetupResponse holds what an authenticator app is enrolled with.
+type TOTPSetupResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// RecoveryCodesResponse holds recovery codes. They are shown only once.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (a *AuthAPI) totpStatus(ctx base.APIContext) {
+	profile, err := a.ProfileModel.Get()
+	if err != nil {
+		ctx.ReturnError("server_error", "Failed to fetch profile", http.StatusInternalServerError)
+		return
+	}
+	left, err := a.RecoveryCodeModel.CountUnused()
+	if err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx.ReturnJSON(TOTPStatusResponse{Enabled: profile.TOTPEnabled, RecoveryCodesLeft: left})
+}
+
+// setupTOTP starts enrollment with a new secret. TOTP is turned on by
+// confirmTOTP once the authenticator produces a valid code.
+func (a *AuthAPI) setupTOTP(ctx base.APIContext) {
+	profile, err := a.ProfileModel.Get()
+	if err != nil {
+		ctx.ReturnError("server_error", "Failed to fetch profile", http.StatusInternalServerError)
+		return
+	}
+	if profile.TOTPEnabled {
+		ctx.ReturnError("badrequest", "Two-factor authentication is already enabled", http.StatusBadRequest)
+		return
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		ctx.ReturnError("server_error", "Failed to generate secret", http.StatusInternalServerError)
+		return
+	}
+	if err := a.ProfileModel.SetTOTPSecret(profile.Finger, secret); err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	account := profile.Finger + "@" + a.cfg.Host()
+	ctx.ReturnJSON(TOTPSetupResponse{Secret: secret, URI: totpURI(account, secret)})
+}
+
+func (a *AuthAPI) confirmTOTP(ctx base.APIContext) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(ctx.RawBody(), &req); err != nil {
+		ctx.ReturnError("invalid_request", "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	profile, err := a.ProfileModel.Get()
+	if err != nil {
+		ctx.ReturnError("server_error", "Failed to fetch profile", http.StatusInternalServerError)
+		return
+	}
+	if profile.TOTPEnabled || profile.TOTPSecret == "" {
+		ctx.ReturnError("badrequest", "Two-factor authentication setup was not started", http.StatusBadRequest)
+		return
+	}
+	step, ok := matchTOTP(profile.TOTPSecret, strings.TrimSpace(req.Code), time.Now())
+	if !ok {
+		ctx.ReturnError("badrequest", "Invalid authentication code", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := a.replaceRecoveryCodes()
+	if err != nil {
+		ctx.ReturnError("server_error", "Failed to create recovery codes", http.StatusInternalServerError)
+		return
+	}
+	if err := a.ProfileModel.EnableTOTP(profile.Finger); err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := a.ProfileModel.UseTOTPStep(profile.Finger, step); err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx.ReturnJSON(RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// checkPassword reads the password from the request body and checks it
+// with verifyPassword. It writes the error response and returns false when
+// it does not match.
+func (a *AuthAPI) checkPassword(ctx base.APIContext) bool {
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.Unmarshal(ctx.RawBody(), &req); err != nil {
+		ctx.ReturnError("invalid_request", "Invalid request payload", http.StatusBadRequest)
+		return false
+	}
+	profile, err := a.ProfileModel.Get()
+	if err != nil {
+		ctx.ReturnError("server_error", "Failed to fetch profile", http.StatusInternalServerError)
+		return false
+	}
+	return a.verifyPassword(ctx, profile, req.Password)
+}
+
+func (a *AuthAPI) disableTOTP(ctx base.APIContext) {
+	if !a.checkPassword(ctx) {
+		return
+	}
+	profile, err := a.ProfileModel.Get()
+	if err != nil {
+		ctx.ReturnError("server_error", "Failed to fetch profile", http.StatusInternalServerError)
+		return
+	}
+	if err := a.ProfileModel.DisableTOTP(profile.Finger); err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := a.RecoveryCodeModel.DeleteAll(); err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx.ReturnJSON(map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+func (a *AuthAPI) regenerateRecoveryCodes(ctx base.APIContext) {
+	if !a.checkPassword(ctx) {
+		return
+	}
+	profile, err := a.ProfileModel.Get()
+	if err != nil {
+		ctx.ReturnError("server_error", "Failed to fetch profile", http.StatusInternalServerError)
+		return
+	}
+	if !profile.TOTPEnabled {
+		ctx.ReturnError("badrequest", "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := a.replaceRecoveryCodes()
+	if err != nil {
+		ctx.ReturnError("server_error", "Failed to create recovery codes", http.StatusInternalServerError)
+		return
+	}
+	ctx.ReturnJSON(RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// replaceRecoveryCodes stores a fresh set of recovery codes in place of
+// the old ones and returns them.
+func (a *AuthAPI) replaceRecoveryCodes() ([]string, error) {
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = a.hashToken(normalizeRecoveryCode(code))
+	}
+	if err := a.RecoveryCodeModel.Replace(hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// loginTOTPHandler is the second step of a login with TOTP. It takes a TOTP
+// code or a recovery code for the session the password step started.
+func (a *AuthAPI) loginTOTPHandler(ctx base.APIContext) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(ctx.RawBody(), &req); err != nil {
+		ctx.ReturnError("invalid_request", "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	ip := a.Proxies.ClientIP(ctx.GetRequest())
+	if a.lockedOut(ctx, ip) {
+		return
+	}
+	session := a.findSession(ctx.GetRequest())
+	if session == nil || !session.Pending {
+		ctx.ReturnError("unauthorized", "Log in with your password first", http.StatusUnauthorized)
+		return
+	}
+	profile, err := a.ProfileModel.Get()
+	if err != nil {
+		ctx.ReturnError("server_error", "Failed to fetch profile", http.StatusInternalServerError)
+		return
+	}
+
+	code := strings.TrimSpace(req.Code)
+	var ok bool
+	if isTOTPCode(code) {
+		var step int64
+		if step, ok = matchTOTP(profile.TOTPSecret, code, time.Now()); ok {
+			// A code seen before is refused, so one read over a shoulder
+			// cannot be replayed.
+			ok, err = a.ProfileModel.UseTOTPStep(profile.Finger, step)
+		}
+	} else {
+		ok, err = a.RecoveryCodeModel.Use(a.hashToken(normalizeRecoveryCode(code)))
+	}
+	if err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		a.lockout.fail(ip)
+		ctx.ReturnError("unauthorized", "Invalid authentication code", http.StatusUnauthorized)
+		return
+	}
+	a.lockout.reset(ip)
+
+	if err := a.SessionModel.Complete(session, sessionLifetime); err != nil {
+		ctx.ReturnError("dberror", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cookie, _ := ctx.GetCookie("auth_token")
+	ctx.SetCookie("auth_token", cookie.Value, "/", int64(sessionLifetime/time.Second), true)
+	ctx.ReturnJSON(map[string]string{"message": "Login successful"})
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors,
+// "12345678901234567890", in base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to six digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := totpCode(rfc6238Secret, tt.unix/totpPeriod)
+		if err != nil {
+			t.Fatalf("totpCode: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name   string
+		offset int64
+		want   bool
+	}{
+		{"current step", 0, true},
+		{"previous step", -1, true},
+		{"next step", 1, true},
+		{"too old", -totpSkew - 1, false},
+		{"too new", totpSkew + 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := totpCode(rfc6238Secret, current+tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			step, ok := matchTOTP(rfc6238Secret, code, now)
+			if ok != tt.want {
+				t.Fatalf("matchTOTP = %v, want %v", ok, tt.want)
+			}
+			if ok && step != current+tt.offset {
+				t.Errorf("step = %d, want %d", step, current+tt.offset)
+			}
+		})
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d codes, want %d", len(codes), recoveryCodeCount)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' || seen[code] {
+			t.Errorf("bad or repeated code %q", code)
+		}
+		seen[code] = true
+		if isTOTPCode(code) {
+			t.Errorf("recovery code %q looks like a TOTP code", code)
+		}
+	}
+
+	if got := normalizeRecoveryCode(" ABCDE-fghij "); got != "abcdefghij" {
+		t.Errorf("normalizeRecoveryCode = %q", got)
+	}
+}
+
+// enableTOTP turns TOTP on for the test owner with rfc6238Secret and the
+// given recovery codes.
+func enableTOTP(t *testing.T, a *AuthAPI, recoveryCodes ...string) {
+	t.Helper()
+	if err := a.ProfileModel.SetTOTPSecret("alice", rfc6238Secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ProfileModel.EnableTOTP("alice"); err != nil {
+		t.Fatal(err)
+	}
+	hashes := make([]string, 0, len(recoveryCodes))
+	for _, code := range recoveryCodes {
+		hashes = append(hashes, a.hashToken(normalizeRecoveryCode(code)))
+	}
+	if err := a.RecoveryCodeModel.Replace(hashes); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoginTOTPReplay(t *testing.T) {
+	a, router := newTestAuthAPI(t)
+	enableTOTP(t, a, "aaaaa-bbbbb")
+
+	code, err := totpCode(rfc6238Secret, time.Now().Unix()/totpPeriod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		code       string
+		wantStatus int
+	}{
+		{"wrong code", "000000", http.StatusUnauthorized},
+		{"current code", code, http.StatusOK},
+		{"same code again", code, http.StatusUnauthorized},
+		{"recovery code", "AAAAA BBBBB", http.StatusOK},
+		{"recovery code again", "aaaaa-bbbbb", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(router, http.MethodPost, "/api/login", map[string]string{"password": testPassword})
+			if rec.Code != http.StatusOK {
+				t.Fatalf("login status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			var session *http.Cookie
+			for _, cookie := range rec.Result().Cookies() {
+				if cookie.Name == "auth_token" {
+					session = cookie
+				}
+			}
+			if session == nil {
+				t.Fatal("login set no session cookie")
+			}
+
+			rec = serve(router, http.MethodPost, "/api/login/totp", map[string]string{"code": tt.code}, session)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("login/totp status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/api/auth/status", nil)
+			req.AddCookie(session)
+			if loggedIn, _ := a.authenticate(req); (loggedIn != nil) != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("logged in = %v, want %v", loggedIn, tt.wantStatus == http.StatusOK)
+			}
+		})
+	}
+}
+
+func TestTOTPPasswordLockout(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodDelete, "/api/auth/totp"},
+		{http.MethodPost, "/api/auth/totp/recovery-codes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			a, router := newTestAuthAPI(t)
+			enableTOTP(t, a)
+
+			for i := 0; i < lockoutFreeAttempts; i++ {
+				if rec := serve(router, tt.method, tt.path, map[string]string{"password": "wrong"}); rec.Code != http.StatusForbidden {
+					t.Fatalf("attempt %d: status = %d, want %d", i+1, rec.Code, http.StatusForbidden)
+				}
+			}
+			if rec := serve(router, tt.method, tt.path, map[string]string{"password": testPassword}); rec.Code != http.StatusTooManyRequests {
+				t.Fatalf("status after %d failures = %d, want %d", lockoutFreeAttempts, rec.Code, http.StatusTooManyRequests)
+			}
+
+			profile, err := a.ProfileModel.Get()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !profile.TOTPEnabled {
+				t.Error("TOTP was disabled by a locked out client")
+			}
+		})
+	}
+}
+
+func TestSetupTOTPUsesConfiguredHost(t *testing.T) {
+	_, router := newTestAuthAPI(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/totp", nil)
+	req.Host = "evil.example"
+	rec := httptest.NewRecorder()
+	router.GetMUX().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var setup TOTPSetupResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &setup); err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(setup.URI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/Knife:alice@knife.example"; u.Path != want {
+		t.Errorf("otpauth label = %s, want %s", u.Path, want)
+	}
+}
@@ -3,9 +3,11 @@ package base
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"reflect"
 	"slices"
@@ -18,6 +20,8 @@ type APIContext struct {
 
 	httpType    string
 	middleWares []APIMiddleware
+	// globalMiddleWares run for every route, before middleWares.
+	globalMiddleWares []APIMiddleware
 
 	rawBodyData []byte
 }
@@ -51,6 +55,14 @@ type APIMiddlewareResult struct {
 }
 
 func (context *APIContext) runMiddlewars(allowed []string) bool {
+	for _, middleware := range context.globalMiddleWares {
+		result := middleware.RunMiddleware(context.res, &context.req)
+		if !result.IsSuccess {
+			context.ReturnError(result.ApiError.ErrorType, result.ApiError.ErrorDesc, *result.ApiError.ErrorCode)
+			return false
+		}
+	}
+
 	if len(allowed) <= 0 {
 		return true
 	}
@@ -187,11 +199,19 @@ func (ctx *APIContext) SetCookie(name, value, path string, maxAge int64, httpOnl
 	})
 }
 
+// DefaultBodyLimit is the largest request body a route accepts unless it
+// sets its own limit with SetBodyLimit.
+const DefaultBodyLimit = 1 << 20
+
 type APIRouter struct {
 	mux http.ServeMux
 
-	prefix      string
-	middlewares []APIMiddleware
+	prefix            string
+	middlewares       []APIMiddleware
+	globalMiddlewares []APIMiddleware
+	// bodyLimits holds the routes that accept bodies larger or smaller
+	// than DefaultBodyLimit.
+	bodyLimits map[string]int64
 }
 
 func NewAPIRouter() APIRouter {
@@ -199,13 +219,49 @@ func NewAPIRouter() APIRouter {
 		mux:         *http.NewServeMux(),
 		prefix:      "",
 		middlewares: make([]APIMiddleware, 0),
+		bodyLimits:  make(map[string]int64),
+	}
+}
+
+// SetBodyLimit sets the largest request body accepted by the routes on
+// path, whatever their method.
+func (router *APIRouter) SetBodyLimit(path string, limit int64) {
+	router.bodyLimits[path] = limit
+}
+
+// readBody reads the body of reqx, up to the limit of the route. Larger
+// bodies are refused before middlewares run. It reports whether the
+// request may go on.
+func (router *APIRouter) readBody(resx http.ResponseWriter, reqx *http.Request, path string) ([]byte, bool) {
+	limit, ok := router.bodyLimits[path]
+	if !ok {
+		limit = DefaultBodyLimit
+	}
+
+	bodydata, berr := io.ReadAll(http.MaxBytesReader(resx, reqx.Body, limit))
+	if berr != nil {
+		rctx := APIContext{res: resx, req: *reqx, httpType: reqx.Method}
+		var tooLarge *http.MaxBytesError
+		if errors.As(berr, &tooLarge) {
+			rctx.ReturnError("toolarge", fmt.Sprintf("Request body is larger than %d bytes", limit), http.StatusRequestEntityTooLarge)
+		} else {
+			rctx.ReturnError("servererror", "internal bytestream read error", http.StatusInternalServerError)
+		}
+		return nil, false
 	}
+	return bodydata, true
 }
 
 func (router *APIRouter) RegisterMidddleware(mw APIMiddleware) {
 	router.middlewares = append(router.middlewares, mw)
 }
 
+// RegisterGlobalMiddleware adds a middleware that runs for every route,
+// whatever middlewares the route names.
+func (router *APIRouter) RegisterGlobalMiddleware(mw APIMiddleware) {
+	router.globalMiddlewares = append(router.globalMiddlewares, mw)
+}
+
 func (router *APIRouter) SetPrefix(prefix string) {
 	router.prefix = prefix
 }
@@ -219,26 +275,25 @@ func (router *APIRouter) pathMaker(path string, method string) string {
 		endpath = strings.Join([]string{method, " ", "/", path}, "")
 	}
 
-	fmt.Println(endpath)
+	slog.Debug("route registered", "path", endpath)
 
 	return endpath
 }
 
 func (router *APIRouter) GET(path string, delegate func(APIContext), allowMiddleware []string) {
 	interceptor := func(resx http.ResponseWriter, reqx *http.Request) {
-		bodydata, berr := io.ReadAll(reqx.Body)
-
-		if berr != nil {
-			rctx := APIContext{res: resx, req: *reqx, httpType: reqx.Method}
-			rctx.ReturnError("servererror", "internal bytestream read error", http.StatusInternalServerError)
+		bodydata, ok := router.readBody(resx, reqx, path)
+		if !ok {
+			return
 		}
 
 		ctx := APIContext{
 			res: resx,
 			req: *reqx.Clone(context.Background()),
 
-			httpType:    reqx.Method,
-			middleWares: router.middlewares,
+			httpType:          reqx.Method,
+			middleWares:       router.middlewares,
+			globalMiddleWares: router.globalMiddlewares,
 
 			rawBodyData: bodydata,
 		}
@@ -254,19 +309,18 @@ func (router *APIRouter) GET(path string, delegate func(APIContext), allowMiddle
 
 func (router *APIRouter) POST(path string, delegate func(APIContext), allowMiddleware []string) {
 	interceptor := func(resx http.ResponseWriter, reqx *http.Request) {
-		bodydata, berr := io.ReadAll(reqx.Body)
-
-		if berr != nil {
-			rctx := APIContext{res: resx, req: *reqx, httpType: reqx.Method}
-			rctx.ReturnError("servererror", "internal bytestream read error", http.StatusInternalServerError)
+		bodydata, ok := router.readBody(resx, reqx, path)
+		if !ok {
+			return
 		}
 
 		ctx := APIContext{
 			res: resx,
 			req: *reqx,
 
-			httpType:    reqx.Method,
-			middleWares: router.middlewares,
+			httpType:          reqx.Method,
+			middleWares:       router.middlewares,
+			globalMiddleWares: router.globalMiddlewares,
 
 			rawBodyData: bodydata,
 		}
@@ -282,19 +336,18 @@ func (router *APIRouter) POST(path string, delegate func(APIContext), allowMiddl
 
 func (router *APIRouter) PUT(path string, delegate func(APIContext), allowMiddleware []string) {
 	interceptor := func(resx http.ResponseWriter, reqx *http.Request) {
-		bodydata, berr := io.ReadAll(reqx.Body)
-
-		if berr != nil {
-			rctx := APIContext{res: resx, req: *reqx, httpType: reqx.Method}
-			rctx.ReturnError("servererror", "internal bytestream read error", http.StatusInternalServerError)
+		bodydata, ok := router.readBody(resx, reqx, path)
+		if !ok {
+			return
 		}
 
 		ctx := APIContext{
 			res: resx,
 			req: *reqx,
 
-			httpType:    reqx.Method,
-			middleWares: router.middlewares,
+			httpType:          reqx.Method,
+			middleWares:       router.middlewares,
+			globalMiddleWares: router.globalMiddlewares,
 
 			rawBodyData: bodydata,
 		}
@@ -310,19 +363,18 @@ func (router *APIRouter) PUT(path string, delegate func(APIContext), allowMiddle
 
 func (router *APIRouter) DELETE(path string, delegate func(APIContext), allowMiddleware []string) {
 	interceptor := func(resx http.ResponseWriter, reqx *http.Request) {
-		bodydata, berr := io.ReadAll(reqx.Body)
-
-		if berr != nil {
-			rctx := APIContext{res: resx, req: *reqx, httpType: reqx.Method}
-			rctx.ReturnError("servererror", "internal bytestream read error", http.StatusInternalServerError)
+		bodydata, ok := router.readBody(resx, reqx, path)
+		if !ok {
+			return
 		}
 
 		ctx := APIContext{
 			res: resx,
 			req: *reqx.Clone(context.Background()),
 
-			httpType:    reqx.Method,
-			middleWares: router.middlewares,
+			httpType:          reqx.Method,
+			middleWares:       router.middlewares,
+			globalMiddleWares: router.globalMiddlewares,
 
 			rawBodyData: bodydata,
 		}
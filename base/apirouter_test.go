@@ -0,0 +1,55 @@
+package base
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIRouterBodyLimit(t *testing.T) {
+	router := NewAPIRouter()
+	router.SetPrefix("api")
+	router.SetBodyLimit("upload", 2*DefaultBodyLimit)
+
+	var got int
+	handler := func(ctx APIContext) {
+		got = len(ctx.RawBody())
+		ctx.ReturnJSON(struct{}{})
+	}
+	router.POST("notes", handler, nil)
+	router.POST("upload", handler, nil)
+	router.PUT("notes", handler, nil)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		size       int
+		wantStatus int
+	}{
+		{"under default limit", http.MethodPost, "/api/notes", DefaultBodyLimit, http.StatusOK},
+		{"over default limit", http.MethodPost, "/api/notes", DefaultBodyLimit + 1, http.StatusRequestEntityTooLarge},
+		{"PUT over default limit", http.MethodPut, "/api/notes", DefaultBodyLimit + 1, http.StatusRequestEntityTooLarge},
+		{"under route limit", http.MethodPost, "/api/upload", 2 * DefaultBodyLimit, http.StatusOK},
+		{"over route limit", http.MethodPost, "/api/upload", 2*DefaultBodyLimit + 1, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = -1
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(strings.Repeat("x", tt.size)))
+			rec := httptest.NewRecorder()
+			router.GetMUX().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && got != tt.size {
+				t.Errorf("handler read %d bytes, want %d", got, tt.size)
+			}
+			if tt.wantStatus != http.StatusOK && got != -1 {
+				t.Errorf("handler ran for a refused body")
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package base
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCSRFProtection(t *testing.T) {
+	csrf, err := NewCSRFProtection("https://knife.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const token = "0123456789abcdef"
+	tests := []struct {
+		name    string
+		method  string
+		cookie  string
+		headers map[string]string
+		wantOK  bool
+	}{
+		{"safe method", http.MethodGet, "", nil, true},
+		{"safe method cross-site", http.MethodGet, "", map[string]string{"Sec-Fetch-Site": "cross-site"}, true},
+		{"token", http.MethodPost, token, map[string]string{CSRFHeaderName: token}, true},
+		{"token from another site", http.MethodDelete, token, map[string]string{CSRFHeaderName: token, "Sec-Fetch-Site": "cross-site"}, true},
+		{"wrong token", http.MethodPost, token, map[string]string{CSRFHeaderName: "fedcba9876543210"}, false},
+		{"token without cookie", http.MethodPost, "", map[string]string{CSRFHeaderName: token}, false},
+		{"cookie without token", http.MethodPost, token, nil, false},
+		{"nothing", http.MethodPut, "", nil, false},
+		{"same origin fetch", http.MethodPost, "", map[string]string{"Sec-Fetch-Site": "same-origin"}, true},
+		{"user initiated fetch", http.MethodPost, "", map[string]string{"Sec-Fetch-Site": "none"}, true},
+		{"cross-site fetch", http.MethodPost, "", map[string]string{"Sec-Fetch-Site": "cross-site"}, false},
+		{"same-site fetch", http.MethodPost, "", map[string]string{"Sec-Fetch-Site": "same-site"}, false},
+		{"trusted origin", http.MethodPost, "", map[string]string{"Origin": "https://knife.example"}, true},
+		{"matching host origin", http.MethodPost, "", map[string]string{"Origin": "http://localhost"}, true},
+		{"foreign origin", http.MethodPost, "", map[string]string{"Origin": "https://evil.example"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "http://localhost/api/notes", nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: tt.cookie})
+			}
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+
+			result := csrf.RunMiddleware(rec, r)
+			if result.IsSuccess != tt.wantOK {
+				t.Fatalf("IsSuccess = %v, want %v", result.IsSuccess, tt.wantOK)
+			}
+			if !result.IsSuccess && (result.ApiError.ErrorType != "csrf" || *result.ApiError.ErrorCode != http.StatusForbidden) {
+				t.Errorf("error = %s %d, want csrf %d", result.ApiError.ErrorType, *result.ApiError.ErrorCode, http.StatusForbidden)
+			}
+
+			issued := rec.Result().Cookies()
+			if tt.cookie != "" && len(issued) != 0 {
+				t.Errorf("token cookie reissued although the request had one")
+			}
+			if tt.cookie == "" && (len(issued) != 1 || issued[0].Name != CSRFCookieName || issued[0].Value == "") {
+				t.Errorf("cookies = %v, want a new %s", issued, CSRFCookieName)
+			}
+		})
+	}
+}
@@ -1,30 +1,156 @@
 package base
 
-import "time"
+import (
+	"context"
+	"sync"
+	"time"
+)
 
+// JobQueue runs jobs on a bounded pool of workers. Jobs are grouped by a
+// key, usually the destination host, and each key has its own concurrency
+// and rate limit so that one slow or busy server does not hold up the rest.
 type JobQueue struct {
-	jobs         chan func()
-	limitsPerMin int
+	workers     chan struct{}
+	size        int
+	perKey      int
+	keyInterval time.Duration
+	mu          sync.Mutex
+	notFull     *sync.Cond
+	pending     int
+	keys        map[string]*keyQueue
+	stopped     bool
+	done        chan struct{}
+	drainers    sync.WaitGroup
 }
 
-func NewJobQueue(limitsPerMin int) *JobQueue {
-	return &JobQueue{
-		jobs:         make(chan func(), 100),
-		limitsPerMin: limitsPerMin,
+type keyQueue struct {
+	jobs    []func()
+	running int
+	next    time.Time
+}
+
+// NewJobQueue returns a queue running at most workers jobs at once, with
+// at most size jobs waiting. Jobs sharing a key run at most perKey at a
+// time and are started at most ratePerMinute times a minute.
+func NewJobQueue(workers, size, perKey, ratePerMinute int) *JobQueue {
+	jq := &JobQueue{
+		workers:     make(chan struct{}, workers),
+		size:        size,
+		perKey:      perKey,
+		keyInterval: time.Minute / time.Duration(ratePerMinute),
+		keys:        make(map[string]*keyQueue),
+		done:        make(chan struct{}),
+	}
+	jq.notFull = sync.NewCond(&jq.mu)
+	return jq
+}
+
+// Enqueue adds a job under key. It blocks while the queue is full. Jobs
+// enqueued after Stop are dropped.
+func (jq *JobQueue) Enqueue(key string, job func()) {
+	jq.mu.Lock()
+	defer jq.mu.Unlock()
+
+	for jq.pending >= jq.size && !jq.stopped {
+		jq.notFull.Wait()
+	}
+	if jq.stopped {
+		return
+	}
+
+	q, ok := jq.keys[key]
+	if !ok {
+		q = &keyQueue{}
+		jq.keys[key] = q
+	}
+	q.jobs = append(q.jobs, job)
+	jq.pending++
+
+	if q.running < jq.perKey {
+		q.running++
+		jq.drainers.Add(1)
+		go jq.drain(key, q)
 	}
 }
 
-func (jq *JobQueue) Start() {
+// Stop drops the jobs that have not started yet and waits for the running
+// ones to finish, or for ctx to be done.
+func (jq *JobQueue) Stop(ctx context.Context) error {
+	jq.mu.Lock()
+	if !jq.stopped {
+		jq.stopped = true
+		close(jq.done)
+		jq.notFull.Broadcast()
+	}
+	jq.mu.Unlock()
+
+	finished := make(chan struct{})
 	go func() {
-		ticker := time.NewTicker(time.Minute / time.Duration(jq.limitsPerMin))
-		defer ticker.Stop()
-		for job := range jq.jobs {
-			<-ticker.C
-			go job()
-		}
+		jq.drainers.Wait()
+		close(finished)
 	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drain runs the jobs queued under key until there are none left.
+func (jq *JobQueue) drain(key string, q *keyQueue) {
+	defer jq.drainers.Done()
+
+	for {
+		jq.mu.Lock()
+		if len(q.jobs) == 0 || jq.stopped {
+			q.running--
+			// Keep the key while its next start slot is reserved, so that
+			// a job queued right after does not skip the rate limit.
+			if q.running == 0 && !q.next.After(time.Now()) {
+				delete(jq.keys, key)
+			}
+			jq.mu.Unlock()
+			return
+		}
+		job := q.jobs[0]
+		q.jobs = q.jobs[1:]
+		jq.pending--
+		jq.notFull.Signal()
+
+		// Reserve the next start slot for this key.
+		now := time.Now()
+		start := now
+		if q.next.After(now) {
+			start = q.next
+		}
+		q.next = start.Add(jq.keyInterval)
+		jq.mu.Unlock()
+
+		if !jq.wait(start.Sub(now)) {
+			continue
+		}
+		job()
+		<-jq.workers
+	}
 }
 
-func (jq *JobQueue) Enqueue(job func()) {
-	jq.jobs <- job
+// wait sleeps for delay and then takes a worker slot. It returns false
+// without a slot when the queue is stopped first.
+func (jq *JobQueue) wait(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-jq.done:
+		return false
+	}
+
+	select {
+	case jq.workers <- struct{}{}:
+		return true
+	case <-jq.done:
+		return false
+	}
 }
@@ -0,0 +1,134 @@
+package base
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// Pagination holds the cursor parameters shared by list endpoints. Before
+// and After are exclusive ID bounds; zero means unbounded.
+type Pagination struct {
+	Limit  int
+	Before int64
+	After  int64
+}
+
+// GetPagination parses the limit, before and after query parameters.
+// max_id and since_id are accepted as aliases of before and after.
+func (context *APIContext) GetPagination(defaultLimit, maxLimit int) (Pagination, error) {
+	q := context.req.URL.Query()
+	page := Pagination{Limit: defaultLimit}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return page, fmt.Errorf("invalid limit %q", v)
+		}
+		page.Limit = min(limit, maxLimit)
+	}
+
+	var err error
+	if page.Before, err = cursorParam(q, "before", "max_id"); err != nil {
+		return page, err
+	}
+	if page.After, err = cursorParam(q, "after", "since_id"); err != nil {
+		return page, err
+	}
+
+	return page, nil
+}
+
+func cursorParam(q url.Values, names ...string) (int64, error) {
+	for _, name := range names {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 0 {
+			return 0, fmt.Errorf("invalid %s %q", name, v)
+		}
+		return id, nil
+	}
+	return 0, nil
+}
+
+// SetPaginationLinks sets a Link header pointing to the pages around the
+// returned items, whose IDs run from newest to oldest. The next page is
+// only linked when the current one is full.
+func (context *APIContext) SetPaginationLinks(page Pagination, newestID, oldestID int64, count int) {
+	if count == 0 {
+		return
+	}
+
+	// The router strips its prefix from URL.Path, so rebuild the link
+	// from the URI the client actually requested.
+	requested, err := url.ParseRequestURI(context.req.RequestURI)
+	if err != nil {
+		return
+	}
+
+	link := func(key string, id int64, rel string) string {
+		q := requested.Query()
+		for _, name := range []string{"before", "after", "max_id", "since_id"} {
+			q.Del(name)
+		}
+		q.Set("limit", strconv.Itoa(page.Limit))
+		q.Set(key, strconv.FormatInt(id, 10))
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, requested.Path, q.Encode(), rel)
+	}
+
+	links := link("after", newestID, "prev")
+	if count >= page.Limit {
+		links = link("before", oldestID, "next") + ", " + links
+	}
+	context.SetHeader("Link", links)
+}
+
+// OffsetPagination is a page of results that have no stable ID order, such
+// as search results ranked by relevance.
+type OffsetPagination struct {
+	Limit  int
+	Offset int
+}
+
+// GetOffsetPagination parses the limit and offset query parameters.
+func (context *APIContext) GetOffsetPagination(defaultLimit, maxLimit int) (OffsetPagination, error) {
+	q := context.req.URL.Query()
+	page := OffsetPagination{Limit: defaultLimit}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return page, fmt.Errorf("invalid limit %q", v)
+		}
+		page.Limit = min(limit, maxLimit)
+	}
+	if v := q.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return page, fmt.Errorf("invalid offset %q", v)
+		}
+		page.Offset = offset
+	}
+
+	return page, nil
+}
+
+// SetOffsetPaginationLinks sets a Link header pointing to the next page
+// when the current one is full.
+func (context *APIContext) SetOffsetPaginationLinks(page OffsetPagination, count int) {
+	if count < page.Limit {
+		return
+	}
+
+	requested, err := url.ParseRequestURI(context.req.RequestURI)
+	if err != nil {
+		return
+	}
+	q := requested.Query()
+	q.Set("limit", strconv.Itoa(page.Limit))
+	q.Set("offset", strconv.Itoa(page.Offset+count))
+	context.SetHeader("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, requested.Path, q.Encode()))
+}
@@ -0,0 +1,94 @@
+package base
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// serveContext runs handler for a GET of target through a router, so that
+// it gets a real APIContext.
+func serveContext(t *testing.T, target string, handler func(ctx APIContext)) *httptest.ResponseRecorder {
+	t.Helper()
+	router := NewAPIRouter()
+	router.SetPrefix("api")
+	router.GET("notes", handler, nil)
+	rec := httptest.NewRecorder()
+	router.GetMUX().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+func TestGetPagination(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    Pagination
+		wantErr bool
+	}{
+		{"", Pagination{Limit: 20}, false},
+		{"limit=5", Pagination{Limit: 5}, false},
+		{"limit=500", Pagination{Limit: 40}, false},
+		{"before=10&after=3", Pagination{Limit: 20, Before: 10, After: 3}, false},
+		{"max_id=10&since_id=3", Pagination{Limit: 20, Before: 10, After: 3}, false},
+		{"before=10&max_id=99", Pagination{Limit: 20, Before: 10}, false},
+		{"limit=0", Pagination{}, true},
+		{"limit=x", Pagination{}, true},
+		{"before=-1", Pagination{}, true},
+		{"after=x", Pagination{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			serveContext(t, "/api/notes?"+tt.query, func(ctx APIContext) {
+				page, err := ctx.GetPagination(20, 40)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("GetPagination error = %v, want error %v", err, tt.wantErr)
+				}
+				if err == nil && page != tt.want {
+					t.Errorf("GetPagination = %+v, want %+v", page, tt.want)
+				}
+			})
+		})
+	}
+}
+
+func TestSetPaginationLinks(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		count    int
+		wantLink string
+	}{
+		{
+			name:     "full page",
+			target:   "/api/notes?limit=2&category=a",
+			count:    2,
+			wantLink: `</api/notes?before=8&category=a&limit=2>; rel="next", </api/notes?after=9&category=a&limit=2>; rel="prev"`,
+		},
+		{
+			name:     "last page",
+			target:   "/api/notes?limit=2&before=10",
+			count:    1,
+			wantLink: `</api/notes?after=9&limit=2>; rel="prev"`,
+		},
+		{
+			name:     "empty page",
+			target:   "/api/notes?limit=2",
+			count:    0,
+			wantLink: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveContext(t, tt.target, func(ctx APIContext) {
+				page, err := ctx.GetPagination(20, 40)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ctx.SetPaginationLinks(page, 9, 8, tt.count)
+				ctx.ReturnJSON(struct{}{})
+			})
+			if got := rec.Header().Get("Link"); got != tt.wantLink {
+				t.Errorf("Link = %s, want %s", got, tt.wantLink)
+			}
+		})
+	}
+}
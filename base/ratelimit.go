@@ -0,0 +1,193 @@
+package base
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TrustedProxies are the reverse proxies whose X-Forwarded-For header is
+// believed.
+type TrustedProxies []netip.Prefix
+
+func (p TrustedProxies) contains(addr netip.Addr) bool {
+	for _, prefix := range p {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address a request came from. When it came through
+// trusted proxies, X-Forwarded-For is read from the right and the first
+// address that is not a trusted proxy is the client. Addresses further left
+// were written by the client itself and are not believed.
+func (p TrustedProxies) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap()
+	if !p.contains(addr) {
+		return addr.String()
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !p.contains(addr) {
+			break
+		}
+	}
+	return addr.String()
+}
+
+// ClientKey returns the key the requests of the client at ip are counted
+// under. IPv4 clients are counted by address. IPv6 clients are usually
+// given a whole /64 and are counted by that network, so that moving to
+// another address of it does not make a new client.
+func ClientKey(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+	if addr.Is4() {
+		return addr.String()
+	}
+	prefix, err := addr.WithZone("").Prefix(64)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
+
+// rateLimitSweepInterval is how often buckets that have filled up again are
+// forgotten.
+const rateLimitSweepInterval = time.Minute
+
+// RateLimiter limits requests per client, as told apart by ClientKey, with
+// a token bucket. It is an APIMiddleware for the routes that name it, and
+// wraps plain handlers with Wrap.
+type RateLimiter struct {
+	name     string
+	interval time.Duration // time to earn one token
+	burst    int
+	proxies  TrustedProxies
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewRateLimiter returns a limiter registered as middleware under name. Each
+// client may send burst requests at once and earns perMinute more a minute.
+// With perMinute zero every request is allowed.
+func NewRateLimiter(name string, perMinute, burst int, proxies TrustedProxies) *RateLimiter {
+	l := &RateLimiter{
+		name:      name,
+		burst:     burst,
+		proxies:   proxies,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+	if perMinute > 0 {
+		l.interval = time.Minute / time.Duration(perMinute)
+	}
+	return l
+}
+
+// Allow takes a token from key's bucket. When the bucket is empty it
+// returns false and how long until a token is earned.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	if l.interval == 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.burst), updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.burst), b.tokens+float64(now.Sub(b.updated))/float64(l.interval))
+	b.updated = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) * float64(l.interval))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets the buckets that would be full by now, so that clients seen
+// once do not pile up. l.mu must be held.
+func (l *RateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+float64(now.Sub(b.updated))/float64(l.interval) >= float64(l.burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// check takes a token for the client of r. When there is none it sets
+// Retry-After and returns false.
+func (l *RateLimiter) check(w http.ResponseWriter, r *http.Request) bool {
+	ok, wait := l.Allow(ClientKey(l.proxies.ClientIP(r)))
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	}
+	return ok
+}
+
+func (l *RateLimiter) RunMiddleware(w http.ResponseWriter, r *http.Request) APIMiddlewareResult {
+	if !l.check(w, r) {
+		return APIMiddlewareResult{
+			IsSuccess: false,
+			ApiError:  NewAPIError("ratelimited", "Too many requests", http.StatusTooManyRequests),
+		}
+	}
+	return APIMiddlewareResult{IsSuccess: true}
+}
+
+func (l *RateLimiter) GetMiddlewareInfo() APIMiddlewareInfo {
+	return APIMiddlewareInfo{MiddlewareName: l.name}
+}
+
+// Wrap limits a handler that is not served by an APIRouter.
+func (l *RateLimiter) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.check(w, r) {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
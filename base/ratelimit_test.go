@@ -0,0 +1,156 @@
+package base
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	l := NewRateLimiter("test", 60, 3, nil)
+	for i := range 3 {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d within the burst was refused", i+1)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok {
+		t.Fatal("request over the burst was allowed")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("wait = %v, want up to the 1s it takes to earn a token", wait)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("another client was refused")
+	}
+
+	// Earn a token back.
+	l.buckets["a"].updated = l.buckets["a"].updated.Add(-time.Second)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("request after earning a token was refused")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Error("second request after earning one token was allowed")
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	l := NewRateLimiter("test", 0, 1, nil)
+	for range 10 {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatal("request refused by a limiter with no limit")
+		}
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	l := NewRateLimiter("test", 60, 2, nil)
+	l.Allow("a")
+	l.Allow("b")
+	l.Allow("b")
+	l.buckets["a"].updated = l.buckets["a"].updated.Add(-2 * time.Second)
+	l.lastSweep = time.Now().Add(-2 * rateLimitSweepInterval)
+
+	l.Allow("c")
+	if _, ok := l.buckets["a"]; ok {
+		t.Error("refilled bucket was not swept")
+	}
+	if _, ok := l.buckets["b"]; !ok {
+		t.Error("empty bucket was swept")
+	}
+}
+
+func TestRateLimiterWrap(t *testing.T) {
+	l := NewRateLimiter("test", 1, 1, nil)
+	handler := l.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	wantCodes := []int{http.StatusOK, http.StatusTooManyRequests}
+	for _, want := range wantCodes {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/inbox", nil))
+		if rec.Code != want {
+			t.Errorf("status = %d, want %d", rec.Code, want)
+		}
+		if want == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "60" {
+			t.Errorf("Retry-After = %q, want 60", rec.Header().Get("Retry-After"))
+		}
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	tests := []struct{ ip, want string }{
+		{"192.0.2.1", "192.0.2.1"},
+		{"::ffff:192.0.2.1", "192.0.2.1"},
+		{"2001:db8:1:2:3:4:5:6", "2001:db8:1:2::/64"},
+		{"2001:db8:1:2::1", "2001:db8:1:2::/64"},
+		{"fe80::1%eth0", "fe80::/64"},
+		{"::1", "::/64"},
+		{"not an address", "not an address"},
+	}
+	for _, tt := range tests {
+		if got := ClientKey(tt.ip); got != tt.want {
+			t.Errorf("ClientKey(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimiterGroupsIPv6Networks(t *testing.T) {
+	l := NewRateLimiter("test", 1, 1, nil)
+	handler := l.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		remoteAddr string
+		want       int
+	}{
+		{"[2001:db8:1:2::1]:1234", http.StatusOK},
+		{"[2001:db8:1:2::2]:1234", http.StatusTooManyRequests},
+		{"[2001:db8:1:3::1]:1234", http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/inbox", nil)
+		r.RemoteAddr = tt.remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != tt.want {
+			t.Errorf("request from %s: status = %d, want %d", tt.remoteAddr, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies := TrustedProxies{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("::1/128"),
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct", "192.0.2.1:1234", nil, "192.0.2.1"},
+		{"direct ignores forwarded", "192.0.2.1:1234", []string{"198.51.100.1"}, "192.0.2.1"},
+		{"mapped address", "[::ffff:192.0.2.1]:1234", nil, "192.0.2.1"},
+		{"proxy without forwarded", "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"one proxy", "10.0.0.1:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"ipv6 proxy", "[::1]:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"proxy chain", "10.0.0.1:1234", []string{"198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"spoofed left entries", "10.0.0.1:1234", []string{"203.0.113.9, 198.51.100.1"}, "198.51.100.1"},
+		{"several headers", "10.0.0.1:1234", []string{"203.0.113.9", "198.51.100.1"}, "198.51.100.1"},
+		{"garbage stops the walk", "10.0.0.1:1234", []string{"198.51.100.1, junk, 10.0.0.2"}, "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := proxies.ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
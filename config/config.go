@@ -0,0 +1,348 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// DefaultPath is the config file read when none is given on the command line.
+const DefaultPath = "knife.toml"
+
+// Config holds the settings the server is started with.
+type Config struct {
+	// Listen is the address the HTTP server binds to.
+	Listen string `toml:"listen"`
+	// BaseURL is the public URL of the instance, e.g. https://example.com.
+	// Actor, note and collection IDs are built from it.
+	BaseURL string `toml:"base_url"`
+	// DatabasePath is the path of the SQLite database.
+	DatabasePath string `toml:"database"`
+	// SecretKeyPath is the file holding the key session tokens are hashed with.
+	SecretKeyPath string `toml:"secret_key"`
+	// MediaDir is the directory uploaded media is stored in.
+	MediaDir string `toml:"media_dir"`
+	// LogLevel is one of debug, info, warn or error.
+	LogLevel string `toml:"log_level"`
+	// DevMode allows fetching from loopback and private addresses.
+	DevMode bool `toml:"dev_mode"`
+
+	Queue     QueueConfig     `toml:"queue"`
+	RateLimit RateLimitConfig `toml:"rate_limit"`
+}
+
+// QueueConfig sets the limits of the outgoing delivery queue.
+type QueueConfig struct {
+	// Workers is the number of deliveries sent at the same time.
+	Workers int `toml:"workers"`
+	// HostConcurrency is the number of deliveries sent to one host at the
+	// same time.
+	HostConcurrency int `toml:"host_concurrency"`
+	// RatePerMinute is the number of deliveries started per minute for one
+	// host.
+	RatePerMinute int `toml:"rate_per_minute"`
+	// Size is the number of jobs that may wait in the queue.
+	Size int `toml:"size"`
+}
+
+// RateLimitConfig sets the request rate limits. Clients are told apart by
+// IP address.
+type RateLimitConfig struct {
+	// TrustedProxies lists the reverse proxies, as addresses or CIDR
+	// ranges, whose X-Forwarded-For header is believed.
+	TrustedProxies []string `toml:"trusted_proxies"`
+	// Login limits the login endpoints.
+	Login RateLimit `toml:"login"`
+	// API limits the whole local API.
+	API RateLimit `toml:"api"`
+	// Inbox limits deliveries from other servers to the inbox.
+	Inbox RateLimit `toml:"inbox"`
+}
+
+// RateLimit is a token bucket: a client may send Burst requests at once,
+// and is given PerMinute more a minute. A PerMinute of zero turns the limit
+// off.
+type RateLimit struct {
+	PerMinute int `toml:"per_minute"`
+	Burst     int `toml:"burst"`
+}
+
+// ProxyPrefixes parses TrustedProxies. A plain address stands for itself
+// alone.
+func (r RateLimitConfig) ProxyPrefixes() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(r.TrustedProxies))
+	for _, proxy := range r.TrustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// Default returns the configuration used when nothing else is set.
+func Default() *Config {
+	return &Config{
+		Listen:        ":8080",
+		DatabasePath:  "knife.db",
+		SecretKeyPath: "secret.key",
+		MediaDir:      "media",
+		LogLevel:      "info",
+		Queue: QueueConfig{
+			Workers:         8,
+			HostConcurrency: 2,
+			RatePerMinute:   60,
+			Size:            100,
+		},
+		RateLimit: RateLimitConfig{
+			Login: RateLimit{PerMinute: 10, Burst: 5},
+			API:   RateLimit{PerMinute: 600, Burst: 120},
+			Inbox: RateLimit{PerMinute: 300, Burst: 100},
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the config file,
+// KNIFE_* environment variables and command line flags, each overriding the
+// previous one. It returns the arguments left after the flags.
+func Load(args []string) (*Config, []string, error) {
+	cfg := Default()
+
+	flags := flag.NewFlagSet("knife", flag.ContinueOnError)
+	path := flags.String("config", "", "path of the config file (default "+DefaultPath+")")
+	listen := flags.String("listen", "", "address to listen on")
+	baseURL := flags.String("base-url", "", "public URL of the instance")
+	database := flags.String("db", "", "path of the SQLite database")
+	secretKey := flags.String("secret-key", "", "path of the session secret key")
+	mediaDir := flags.String("media-dir", "", "directory for uploaded media")
+	logLevel := flags.String("log-level", "", "log level (debug, info, warn, error)")
+	devMode := flags.Bool("dev", false, "allow fetching from private addresses")
+	queueWorkers := flags.Int("queue-workers", 0, "deliveries sent at the same time")
+	queueRate := flags.Int("queue-rate", 0, "deliveries started per minute for one host")
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *path == "" {
+		*path = os.Getenv("KNIFE_CONFIG")
+	}
+	if err := cfg.loadFile(*path); err != nil {
+		return nil, nil, err
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, nil, err
+	}
+
+	// Only flags given on the command line override the file and environment.
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "listen":
+			cfg.Listen = *listen
+		case "base-url":
+			cfg.BaseURL = *baseURL
+		case "db":
+			cfg.DatabasePath = *database
+		case "secret-key":
+			cfg.SecretKeyPath = *secretKey
+		case "media-dir":
+			cfg.MediaDir = *mediaDir
+		case "log-level":
+			cfg.LogLevel = *logLevel
+		case "dev":
+			cfg.DevMode = *devMode
+		case "queue-workers":
+			cfg.Queue.Workers = *queueWorkers
+		case "queue-rate":
+			cfg.Queue.RatePerMinute = *queueRate
+		}
+	})
+
+	cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	return cfg, flags.Args(), nil
+}
+
+// loadFile reads the TOML file at path. When path is empty, DefaultPath is
+// read if it exists.
+func (c *Config) loadFile(path string) error {
+	explicit := path != ""
+	if !explicit {
+		path = DefaultPath
+	}
+
+	meta, err := toml.DecodeFile(path, c)
+	if err != nil {
+		if !explicit && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("could not read config file %s: %w", path, err)
+	}
+
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return fmt.Errorf("unknown key %q in config file %s", undecoded[0].String(), path)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	stringVars := map[string]*string{
+		"KNIFE_LISTEN":     &c.Listen,
+		"KNIFE_BASE_URL":   &c.BaseURL,
+		"KNIFE_DB":         &c.DatabasePath,
+		"KNIFE_SECRET_KEY": &c.SecretKeyPath,
+		"KNIFE_MEDIA_DIR":  &c.MediaDir,
+		"KNIFE_LOG_LEVEL":  &c.LogLevel,
+	}
+	for name, field := range stringVars {
+		if value := os.Getenv(name); value != "" {
+			*field = value
+		}
+	}
+
+	intVars := map[string]*int{
+		"KNIFE_QUEUE_WORKERS":          &c.Queue.Workers,
+		"KNIFE_QUEUE_HOST_CONCURRENCY": &c.Queue.HostConcurrency,
+		"KNIFE_QUEUE_RATE":             &c.Queue.RatePerMinute,
+		"KNIFE_QUEUE_SIZE":             &c.Queue.Size,
+		"KNIFE_RATE_LIMIT_LOGIN":       &c.RateLimit.Login.PerMinute,
+		"KNIFE_RATE_LIMIT_API":         &c.RateLimit.API.PerMinute,
+		"KNIFE_RATE_LIMIT_INBOX":       &c.RateLimit.Inbox.PerMinute,
+	}
+	for name, field := range intVars {
+		if value := os.Getenv(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*field = n
+		}
+	}
+
+	if value := os.Getenv("KNIFE_TRUSTED_PROXIES"); value != "" {
+		c.RateLimit.TrustedProxies = strings.Split(value, ",")
+	}
+
+	if value := os.Getenv("KNIFE_DEV_MODE"); value != "" {
+		devMode, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid KNIFE_DEV_MODE: %w", err)
+		}
+		c.DevMode = devMode
+	}
+
+	// KNIFE_HOST and KNIFE_PROTOCOL predate KNIFE_BASE_URL.
+	if host := os.Getenv("KNIFE_HOST"); host != "" && os.Getenv("KNIFE_BASE_URL") == "" {
+		protocol := os.Getenv("KNIFE_PROTOCOL")
+		if protocol == "" {
+			protocol = "https"
+		}
+		c.BaseURL = protocol + "://" + host
+	}
+
+	return nil
+}
+
+// Validate checks that the configuration can be used to run the server.
+func (c *Config) Validate() error {
+	if c.Listen == "" {
+		return fmt.Errorf("listen address is required")
+	}
+
+	if c.BaseURL == "" {
+		return fmt.Errorf("base_url is required")
+	}
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return fmt.Errorf("invalid base_url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("base_url must use http or https, got %q", c.BaseURL)
+	}
+	if u.Host == "" || u.Path != "" || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("base_url must be a scheme and host only, got %q", c.BaseURL)
+	}
+
+	if c.DatabasePath == "" {
+		return fmt.Errorf("database path is required")
+	}
+	if c.SecretKeyPath == "" {
+		return fmt.Errorf("secret_key path is required")
+	}
+	if c.MediaDir == "" {
+		return fmt.Errorf("media_dir is required")
+	}
+
+	if _, err := c.SlogLevel(); err != nil {
+		return err
+	}
+
+	if c.Queue.Workers <= 0 {
+		return fmt.Errorf("queue.workers must be positive")
+	}
+	if c.Queue.HostConcurrency <= 0 {
+		return fmt.Errorf("queue.host_concurrency must be positive")
+	}
+	if c.Queue.RatePerMinute <= 0 {
+		return fmt.Errorf("queue.rate_per_minute must be positive")
+	}
+	if c.Queue.Size <= 0 {
+		return fmt.Errorf("queue.size must be positive")
+	}
+
+	limits := map[string]RateLimit{
+		"login": c.RateLimit.Login,
+		"api":   c.RateLimit.API,
+		"inbox": c.RateLimit.Inbox,
+	}
+	for name, limit := range limits {
+		if limit.PerMinute < 0 {
+			return fmt.Errorf("rate_limit.%s.per_minute must not be negative", name)
+		}
+		if limit.PerMinute > 0 && limit.Burst <= 0 {
+			return fmt.Errorf("rate_limit.%s.burst must be positive", name)
+		}
+	}
+	if _, err := c.RateLimit.ProxyPrefixes(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Host returns the host part of BaseURL, e.g. example.com.
+func (c *Config) Host() string {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// SlogLevel returns LogLevel as a slog.Level.
+func (c *Config) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return 0, fmt.Errorf("invalid log_level %q", c.LogLevel)
+	}
+	return level, nil
+}
@@ -0,0 +1,206 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// envVars are the variables Load reads. They are cleared for every test so
+// that the environment running the tests does not leak in.
+var envVars = []string{
+	"KNIFE_CONFIG", "KNIFE_LISTEN", "KNIFE_BASE_URL", "KNIFE_DB", "KNIFE_SECRET_KEY",
+	"KNIFE_MEDIA_DIR", "KNIFE_LOG_LEVEL", "KNIFE_QUEUE_WORKERS", "KNIFE_QUEUE_HOST_CONCURRENCY",
+	"KNIFE_QUEUE_RATE", "KNIFE_QUEUE_SIZE", "KNIFE_RATE_LIMIT_LOGIN", "KNIFE_RATE_LIMIT_API",
+	"KNIFE_RATE_LIMIT_INBOX", "KNIFE_TRUSTED_PROXIES", "KNIFE_DEV_MODE", "KNIFE_HOST", "KNIFE_PROTOCOL",
+}
+
+func TestLoad(t *testing.T) {
+	const file = `
+listen = ":9000"
+base_url = "https://file.example/"
+
+[queue]
+workers = 3
+`
+	tests := []struct {
+		name     string
+		file     string
+		env      map[string]string
+		args     []string
+		check    func(c *Config) bool
+		wantArgs []string
+	}{
+		{
+			name:  "defaults",
+			check: func(c *Config) bool { return c.Listen == ":8080" && c.Queue.Workers == 8 && c.BaseURL == "" },
+		},
+		{
+			name:  "file over defaults",
+			file:  file,
+			check: func(c *Config) bool { return c.Listen == ":9000" && c.Queue.Workers == 3 && c.Queue.Size == 100 },
+		},
+		{
+			name:  "trailing slash of base_url",
+			file:  file,
+			check: func(c *Config) bool { return c.BaseURL == "https://file.example" },
+		},
+		{
+			name:  "env over file",
+			file:  file,
+			env:   map[string]string{"KNIFE_LISTEN": ":9100", "KNIFE_QUEUE_WORKERS": "4", "KNIFE_DEV_MODE": "true"},
+			check: func(c *Config) bool { return c.Listen == ":9100" && c.Queue.Workers == 4 && c.DevMode },
+		},
+		{
+			name:  "flags over env",
+			file:  file,
+			env:   map[string]string{"KNIFE_LISTEN": ":9100", "KNIFE_QUEUE_WORKERS": "4"},
+			args:  []string{"-listen", ":9200", "-queue-workers", "5"},
+			check: func(c *Config) bool { return c.Listen == ":9200" && c.Queue.Workers == 5 },
+		},
+		{
+			name:  "flags not given keep env",
+			env:   map[string]string{"KNIFE_LISTEN": ":9100"},
+			args:  []string{"-db", "other.db"},
+			check: func(c *Config) bool { return c.Listen == ":9100" && c.DatabasePath == "other.db" },
+		},
+		{
+			name: "trusted proxies from env",
+			env:  map[string]string{"KNIFE_TRUSTED_PROXIES": "10.0.0.1,10.1.0.0/16"},
+			check: func(c *Config) bool {
+				return slices.Equal(c.RateLimit.TrustedProxies, []string{"10.0.0.1", "10.1.0.0/16"})
+			},
+		},
+		{
+			name:  "legacy host and protocol",
+			env:   map[string]string{"KNIFE_HOST": "legacy.example", "KNIFE_PROTOCOL": "http"},
+			check: func(c *Config) bool { return c.BaseURL == "http://legacy.example" },
+		},
+		{
+			name:  "base url over legacy host",
+			env:   map[string]string{"KNIFE_HOST": "legacy.example", "KNIFE_BASE_URL": "https://env.example"},
+			check: func(c *Config) bool { return c.BaseURL == "https://env.example" },
+		},
+		{
+			name:     "arguments after flags",
+			args:     []string{"-dev", "migrate", "status"},
+			check:    func(c *Config) bool { return c.DevMode },
+			wantArgs: []string{"migrate", "status"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range envVars {
+				t.Setenv(name, "")
+			}
+			if tt.file != "" {
+				path := filepath.Join(t.TempDir(), "knife.toml")
+				if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				t.Setenv("KNIFE_CONFIG", path)
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, args, err := Load(tt.args)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if !tt.check(cfg) {
+				t.Errorf("Load gave %+v", cfg)
+			}
+			if !slices.Equal(args, tt.wantArgs) {
+				t.Errorf("remaining args = %q, want %q", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+	}{
+		{name: "missing explicit file", args: []string{"-config", "does-not-exist.toml"}},
+		{name: "unknown key", file: "listn = \":9000\"\n"},
+		{name: "malformed file", file: "listen = \n"},
+		{name: "invalid number", env: map[string]string{"KNIFE_QUEUE_SIZE": "many"}},
+		{name: "invalid dev mode", env: map[string]string{"KNIFE_DEV_MODE": "sometimes"}},
+		{name: "unknown flag", args: []string{"-nope"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range envVars {
+				t.Setenv(name, "")
+			}
+			args := tt.args
+			if tt.file != "" {
+				path := filepath.Join(t.TempDir(), "knife.toml")
+				if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				args = append([]string{"-config", path}, args...)
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			if _, _, err := Load(args); err == nil {
+				t.Error("Load succeeded")
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(c *Config)
+		wantErr string
+	}{
+		{"valid", func(c *Config) {}, ""},
+		{"http base url", func(c *Config) { c.BaseURL = "http://localhost:8080" }, ""},
+		{"listen", func(c *Config) { c.Listen = "" }, "listen address is required"},
+		{"base url missing", func(c *Config) { c.BaseURL = "" }, "base_url is required"},
+		{"base url unparsable", func(c *Config) { c.BaseURL = "https://[::1" }, "invalid base_url"},
+		{"base url scheme", func(c *Config) { c.BaseURL = "ftp://knife.example" }, "must use http or https"},
+		{"base url without host", func(c *Config) { c.BaseURL = "https://" }, "scheme and host only"},
+		{"base url with path", func(c *Config) { c.BaseURL = "https://knife.example/knife" }, "scheme and host only"},
+		{"base url with query", func(c *Config) { c.BaseURL = "https://knife.example?a=b" }, "scheme and host only"},
+		{"database", func(c *Config) { c.DatabasePath = "" }, "database path is required"},
+		{"secret key", func(c *Config) { c.SecretKeyPath = "" }, "secret_key path is required"},
+		{"media dir", func(c *Config) { c.MediaDir = "" }, "media_dir is required"},
+		{"log level", func(c *Config) { c.LogLevel = "loud" }, "invalid log_level"},
+		{"queue workers", func(c *Config) { c.Queue.Workers = 0 }, "queue.workers"},
+		{"queue host concurrency", func(c *Config) { c.Queue.HostConcurrency = 0 }, "queue.host_concurrency"},
+		{"queue rate", func(c *Config) { c.Queue.RatePerMinute = -1 }, "queue.rate_per_minute"},
+		{"queue size", func(c *Config) { c.Queue.Size = 0 }, "queue.size"},
+		{"negative rate limit", func(c *Config) { c.RateLimit.API.PerMinute = -1 }, "rate_limit.api.per_minute"},
+		{"rate limit without burst", func(c *Config) { c.RateLimit.Login.Burst = 0 }, "rate_limit.login.burst"},
+		{"rate limit off without burst", func(c *Config) { c.RateLimit.Inbox = RateLimit{} }, ""},
+		{"trusted proxy", func(c *Config) { c.RateLimit.TrustedProxies = []string{"proxy.example"} }, "invalid trusted proxy"},
+		{"trusted proxy range", func(c *Config) { c.RateLimit.TrustedProxies = []string{"10.0.0.0/33"} }, "invalid trusted proxy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.BaseURL = "https://knife.example"
+			tt.change(cfg)
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate = %v, want an error about %q", err, tt.wantErr)
+			}
+		})
+	}
+}
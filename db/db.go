@@ -10,100 +10,26 @@ type DB struct {
 	*sqlx.DB
 }
 
-// InitDB initializes the database connection and creates tables
-func InitDB(dataSourceName string) (*DB, error) {
+// Open connects to the database without touching its schema.
+func Open(dataSourceName string) (*DB, error) {
 	db, err := sqlx.Connect("sqlite3", dataSourceName)
 	if err != nil {
 		return nil, err
 	}
+	return &DB{db}, nil
+}
 
-	if _, err := db.Exec(schemaNotes); err != nil {
-		return nil, err
-	}
-
-	if _, err := db.Exec(schemaProfiles); err != nil {
-		return nil, err
-	}
-
-	if _, err := db.Exec(schemaBookmarks); err != nil {
-		return nil, err
-	}
-
-	if _, err := db.Exec(schemaFollowers); err != nil {
-		return nil, err
-	}
-
-	if _, err := db.Exec(schemaHTTPSigs); err != nil {
+// InitDB initializes the database connection and applies pending migrations
+func InitDB(dataSourceName string) (*DB, error) {
+	db, err := Open(dataSourceName)
+	if err != nil {
 		return nil, err
 	}
 
-	if _, err := db.Exec(schemaDrafts); err != nil {
+	if _, err := db.MigrateUp(); err != nil {
+		db.Close()
 		return nil, err
 	}
 
-	// Migration: Add category column to notes if it doesn't exist
-	// We ignore the error because it likely means the column already exists
-	db.Exec("ALTER TABLE notes ADD COLUMN category TEXT DEFAULT ''")
-	db.Exec("ALTER TABLE notes DROP COLUMN medias;")
-	db.Exec("ALTER TABLE notes ADD COLUMN likes INTEGER DEFAULT 0")
-	db.Exec("ALTER TABLE notes ADD COLUMN shares INTEGER DEFAULT 0")
-
-	return &DB{db}, nil
+	return db, nil
 }
-
-const schemaDrafts = `
-CREATE TABLE IF NOT EXISTS drafts (
-	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	content TEXT NOT NULL,
-	create_time DATETIME NOT NULL,
-	update_time DATETIME NOT NULL
-);
-`
-
-const schemaHTTPSigs = `
-CREATE TABLE IF NOT EXISTS httpsigs (
-	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	actor TEXT NOT NULL UNIQUE,
-	public_key TEXT NOT NULL,
-	private_key TEXT NOT NULL
-);
-`
-
-const schemaFollowers = `
-CREATE TABLE IF NOT EXISTS followers (
-    actor_uri TEXT PRIMARY KEY,
-    inbox_uri TEXT NOT NULL,
-    followed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-);`
-
-const schemaNotes = `
-CREATE TABLE IF NOT EXISTS notes (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    uri TEXT UNIQUE,
-    cw TEXT NOT NULL,
-    content TEXT NOT NULL,
-    host TEXT NOT NULL,
-    author_name TEXT NOT NULL,
-    public_range INTEGER NOT NULL,
-    create_time DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-	  author_finger TEXT NOT NULL,
-	  category TEXT DEFAULT '',
-	  likes INTEGER DEFAULT 0,
-	  shares INTEGER DEFAULT 0
-);`
-
-const schemaProfiles = `
-CREATE TABLE IF NOT EXISTS profile (
-    finger TEXT PRIMARY KEY,
-    password_hash TEXT NOT NULL,
-    display_name TEXT NOT NULL,
-    avatar_url TEXT NOT NULL,
-    bio TEXT NOT NULL
-);`
-
-const schemaBookmarks = `
-CREATE TABLE IF NOT EXISTS bookmarks (
-	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	note_id INTEGER NOT NULL,
-	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-);`
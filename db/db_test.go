@@ -0,0 +1,32 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// newTestDB returns a migrated database in a temporary directory.
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := InitDB(filepath.Join(t.TempDir(), "knife.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// createNote inserts a local note and fails the test on error.
+func createNote(t *testing.T, m *NoteModel, note Note) *Note {
+	t.Helper()
+	if note.Host == "" {
+		note.Host = "example.com"
+	}
+	if note.AuthorFinger == "" {
+		note.AuthorFinger = "alice"
+	}
+	if err := m.CreateLocalNote(&note, "https://example.com"); err != nil {
+		t.Fatalf("CreateLocalNote: %v", err)
+	}
+	return &note
+}
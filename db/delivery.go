@@ -0,0 +1,176 @@
+package db
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	DeliveryStatePending = "pending"
+	DeliveryStateFailed  = "failed"
+)
+
+// Delivery is an activity waiting to be POSTed to a remote inbox.
+type Delivery struct {
+	ID            int64     `db:"id" json:"id"`
+	InboxURI      string    `db:"inbox_uri" json:"inbox_uri"`
+	ActorURI      string    `db:"actor_uri" json:"actor_uri"`
+	Payload       string    `db:"payload" json:"payload"`
+	Attempts      int       `db:"attempts" json:"attempts"`
+	NextAttemptAt time.Time `db:"next_attempt_at" json:"next_attempt_at"`
+	LastError     string    `db:"last_error" json:"last_error,omitempty"`
+	State         string    `db:"state" json:"state"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+}
+
+// DeadInbox is an inbox that kept failing and no longer receives deliveries.
+type DeadInbox struct {
+	InboxURI  string    `db:"inbox_uri" json:"inbox_uri"`
+	LastError string    `db:"last_error" json:"last_error"`
+	MarkedAt  time.Time `db:"marked_at" json:"marked_at"`
+}
+
+type DeliveryModel struct {
+	DB *DB
+}
+
+func NewDeliveryModel(db *DB) *DeliveryModel {
+	return &DeliveryModel{DB: db}
+}
+
+// Create queues a delivery for immediate sending.
+func (m *DeliveryModel) Create(delivery *Delivery) error {
+	now := time.Now().UTC()
+	delivery.State = DeliveryStatePending
+	delivery.NextAttemptAt = now
+	delivery.CreatedAt = now
+
+	query := `
+		INSERT INTO deliveries (inbox_uri, actor_uri, payload, attempts, next_attempt_at, state, created_at)
+		VALUES (:inbox_uri, :actor_uri, :payload, :attempts, :next_attempt_at, :state, :created_at)
+	`
+	result, err := m.DB.NamedExec(query, delivery)
+	if err != nil {
+		return err
+	}
+	delivery.ID, err = result.LastInsertId()
+	return err
+}
+
+// ClaimDue returns up to limit pending deliveries that are due and pushes
+// their next attempt lease into the future, so that they are not claimed
+// twice while being sent. A delivery whose worker dies is claimed again once
+// the lease runs out.
+func (m *DeliveryModel) ClaimDue(lease time.Duration, limit int) ([]Delivery, error) {
+	tx, err := m.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // Rollback on error
+
+	now := time.Now().UTC()
+	deliveries := []Delivery{}
+	query := `
+		SELECT * FROM deliveries
+		WHERE state = ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at ASC LIMIT ?
+	`
+	if err := tx.Select(&deliveries, query, DeliveryStatePending, now, limit); err != nil {
+		return nil, err
+	}
+
+	for _, delivery := range deliveries {
+		if _, err := tx.Exec("UPDATE deliveries SET next_attempt_at = ? WHERE id = ?", now.Add(lease), delivery.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return deliveries, tx.Commit()
+}
+
+// Release makes claimed deliveries that were not sent due again right away.
+func (m *DeliveryModel) Release(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	query, args, err := sqlx.In("UPDATE deliveries SET next_attempt_at = ? WHERE state = ? AND id IN (?)", time.Now().UTC(), DeliveryStatePending, ids)
+	if err != nil {
+		return err
+	}
+	_, err = m.DB.Exec(m.DB.Rebind(query), args...)
+	return err
+}
+
+// Delete removes a delivery once it has been sent.
+func (m *DeliveryModel) Delete(id int64) error {
+	_, err := m.DB.Exec("DELETE FROM deliveries WHERE id = ?", id)
+	return err
+}
+
+// Reschedule records a failed attempt and sets when to try again.
+func (m *DeliveryModel) Reschedule(id int64, attempts int, next time.Time, lastError string) error {
+	query := "UPDATE deliveries SET attempts = ?, next_attempt_at = ?, last_error = ? WHERE id = ?"
+	_, err := m.DB.Exec(query, attempts, next.UTC(), lastError, id)
+	return err
+}
+
+// MarkFailed gives up on a delivery.
+func (m *DeliveryModel) MarkFailed(id int64, attempts int, lastError string) error {
+	query := "UPDATE deliveries SET state = ?, attempts = ?, last_error = ? WHERE id = ?"
+	_, err := m.DB.Exec(query, DeliveryStateFailed, attempts, lastError, id)
+	return err
+}
+
+// ListByState returns deliveries in the given state, newest first.
+func (m *DeliveryModel) ListByState(state string, limit, offset int) ([]Delivery, error) {
+	deliveries := []Delivery{}
+	query := "SELECT * FROM deliveries WHERE state = ? ORDER BY id DESC LIMIT ? OFFSET ?"
+	err := m.DB.Select(&deliveries, query, state, limit, offset)
+	return deliveries, err
+}
+
+// Retry puts a failed delivery back in the queue and revives its inbox.
+func (m *DeliveryModel) Retry(id int64) (*Delivery, error) {
+	var delivery Delivery
+	if err := m.DB.Get(&delivery, "SELECT * FROM deliveries WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+
+	delivery.State = DeliveryStatePending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now().UTC()
+	query := "UPDATE deliveries SET state = ?, attempts = 0, next_attempt_at = ? WHERE id = ?"
+	if _, err := m.DB.Exec(query, delivery.State, delivery.NextAttemptAt, id); err != nil {
+		return nil, err
+	}
+
+	if err := m.ReviveInbox(delivery.InboxURI); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// MarkInboxDead stops deliveries to an inbox.
+func (m *DeliveryModel) MarkInboxDead(inboxURI string, lastError string) error {
+	query := "INSERT OR REPLACE INTO dead_inboxes (inbox_uri, last_error, marked_at) VALUES (?, ?, ?)"
+	_, err := m.DB.Exec(query, inboxURI, lastError, time.Now().UTC())
+	return err
+}
+
+func (m *DeliveryModel) IsInboxDead(inboxURI string) (bool, error) {
+	var count int
+	err := m.DB.Get(&count, "SELECT COUNT(*) FROM dead_inboxes WHERE inbox_uri = ?", inboxURI)
+	return count > 0, err
+}
+
+func (m *DeliveryModel) ReviveInbox(inboxURI string) error {
+	_, err := m.DB.Exec("DELETE FROM dead_inboxes WHERE inbox_uri = ?", inboxURI)
+	return err
+}
+
+func (m *DeliveryModel) ListDeadInboxes() ([]DeadInbox, error) {
+	inboxes := []DeadInbox{}
+	err := m.DB.Select(&inboxes, "SELECT * FROM dead_inboxes ORDER BY marked_at DESC")
+	return inboxes, err
+}
@@ -1,9 +1,10 @@
 package db
 
 type Follower struct {
-	ActorURI   string `db:"actor_uri"`
-	InboxURI   string `db:"inbox_uri"`
-	FollowedAt string `db:"followed_at"`
+	ActorURI    string `db:"actor_uri"`
+	InboxURI    string `db:"inbox_uri"`
+	SharedInbox string `db:"shared_inbox"`
+	FollowedAt  string `db:"followed_at"`
 }
 
 type FollowerModel struct {
@@ -14,8 +15,13 @@ func NewFollowerModel(db *DB) *FollowerModel {
 	return &FollowerModel{db: db}
 }
 
-func (m *FollowerModel) AddFollower(actorURI, inboxURI string) error {
-	_, err := m.db.Exec("INSERT OR IGNORE INTO followers (actor_uri, inbox_uri) VALUES (?, ?)", actorURI, inboxURI)
+// AddFollower records a follower. A repeated Follow refreshes its inboxes.
+func (m *FollowerModel) AddFollower(actorURI, inboxURI, sharedInbox string) error {
+	query := `
+		INSERT INTO followers (actor_uri, inbox_uri, shared_inbox) VALUES (?, ?, ?)
+		ON CONFLICT(actor_uri) DO UPDATE SET inbox_uri = excluded.inbox_uri, shared_inbox = excluded.shared_inbox
+	`
+	_, err := m.db.Exec(query, actorURI, inboxURI, sharedInbox)
 	return err
 }
 
@@ -29,3 +35,35 @@ func (m *FollowerModel) ListFollowers() ([]Follower, error) {
 	err := m.db.Select(&followers, "SELECT * FROM followers ORDER BY followed_at DESC")
 	return followers, err
 }
+
+// ListDeliveryInboxes returns the inboxes an activity for all followers is
+// sent to: each shared inbox once, and the personal inbox of followers
+// whose server has no shared inbox.
+func (m *FollowerModel) ListDeliveryInboxes() ([]string, error) {
+	var inboxes []string
+	query := `
+		SELECT DISTINCT CASE WHEN shared_inbox != '' THEN shared_inbox ELSE inbox_uri END
+		FROM followers
+	`
+	err := m.db.Select(&inboxes, query)
+	return inboxes, err
+}
+
+func (m *FollowerModel) IsFollower(actorURI string) (bool, error) {
+	var count int
+	err := m.db.Get(&count, "SELECT COUNT(*) FROM followers WHERE actor_uri = ?", actorURI)
+	return count > 0, err
+}
+
+func (m *FollowerModel) CountFollowers() (int, error) {
+	var count int
+	err := m.db.Get(&count, "SELECT COUNT(*) FROM followers")
+	return count, err
+}
+
+// ListFollowersPage returns one page of followers, most recent first.
+func (m *FollowerModel) ListFollowersPage(limit, offset int) ([]Follower, error) {
+	var followers []Follower
+	err := m.db.Select(&followers, "SELECT * FROM followers ORDER BY followed_at DESC LIMIT ? OFFSET ?", limit, offset)
+	return followers, err
+}
@@ -0,0 +1,79 @@
+package db
+
+import "time"
+
+const (
+	FollowingStatePending  = "pending"
+	FollowingStateAccepted = "accepted"
+)
+
+// Following is a remote actor we have sent a Follow to.
+type Following struct {
+	ActorURI  string    `db:"actor_uri" json:"actor_uri"`
+	InboxURI  string    `db:"inbox_uri" json:"inbox_uri"`
+	Acct      string    `db:"acct" json:"acct"`
+	FollowID  string    `db:"follow_id" json:"follow_id"`
+	State     string    `db:"state" json:"state"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type FollowingModel struct {
+	db *DB
+}
+
+func NewFollowingModel(db *DB) *FollowingModel {
+	return &FollowingModel{db: db}
+}
+
+// AddFollowing records a Follow we sent. Following an actor again replaces
+// the previous record and resets it to pending.
+func (m *FollowingModel) AddFollowing(following *Following) error {
+	query := `
+		INSERT OR REPLACE INTO following (actor_uri, inbox_uri, acct, follow_id, state)
+		VALUES (:actor_uri, :inbox_uri, :acct, :follow_id, :state)
+	`
+	_, err := m.db.NamedExec(query, following)
+	return err
+}
+
+func (m *FollowingModel) Get(actorURI string) (*Following, error) {
+	var following Following
+	err := m.db.Get(&following, "SELECT * FROM following WHERE actor_uri = ?", actorURI)
+	return &following, err
+}
+
+func (m *FollowingModel) GetByFollowID(followID string) (*Following, error) {
+	var following Following
+	err := m.db.Get(&following, "SELECT * FROM following WHERE follow_id = ?", followID)
+	return &following, err
+}
+
+func (m *FollowingModel) SetState(actorURI, state string) error {
+	_, err := m.db.Exec("UPDATE following SET state = ? WHERE actor_uri = ?", state, actorURI)
+	return err
+}
+
+func (m *FollowingModel) RemoveFollowing(actorURI string) error {
+	_, err := m.db.Exec("DELETE FROM following WHERE actor_uri = ?", actorURI)
+	return err
+}
+
+func (m *FollowingModel) ListFollowing() ([]Following, error) {
+	var following []Following
+	err := m.db.Select(&following, "SELECT * FROM following ORDER BY created_at DESC")
+	return following, err
+}
+
+func (m *FollowingModel) CountAccepted() (int, error) {
+	var count int
+	err := m.db.Get(&count, "SELECT COUNT(*) FROM following WHERE state = ?", FollowingStateAccepted)
+	return count, err
+}
+
+// ListAcceptedPage returns one page of accepted follows, most recent first.
+func (m *FollowingModel) ListAcceptedPage(limit, offset int) ([]Following, error) {
+	var following []Following
+	query := "SELECT * FROM following WHERE state = ? ORDER BY created_at DESC LIMIT ? OFFSET ?"
+	err := m.db.Select(&following, query, FollowingStateAccepted, limit, offset)
+	return following, err
+}
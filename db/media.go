@@ -0,0 +1,118 @@
+package db
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Media is an uploaded file stored in the media directory.
+type Media struct {
+	ID            int64     `db:"id" json:"id"`
+	FileName      string    `db:"file_name" json:"file_name"`
+	ThumbnailName string    `db:"thumbnail_name" json:"thumbnail_name"`
+	MimeType      string    `db:"mime_type" json:"mime_type"`
+	Width         int       `db:"width" json:"width"`
+	Height        int       `db:"height" json:"height"`
+	Blurhash      string    `db:"blurhash" json:"blurhash"`
+	Size          int64     `db:"size" json:"size"`
+	CreateTime    time.Time `db:"create_time" json:"create_time"`
+}
+
+// NoteAttachment is a media file attached to a note, with its alt text.
+type NoteAttachment struct {
+	Media
+	NoteID      int64  `db:"note_id" json:"-"`
+	Description string `db:"description" json:"description"`
+}
+
+type MediaModel struct {
+	DB *DB
+}
+
+func NewMediaModel(db *DB) *MediaModel {
+	return &MediaModel{DB: db}
+}
+
+func (m *MediaModel) Create(media *Media) error {
+	query := `
+		INSERT INTO media (file_name, thumbnail_name, mime_type, width, height, blurhash, size)
+		VALUES (:file_name, :thumbnail_name, :mime_type, :width, :height, :blurhash, :size)
+	`
+	result, err := m.DB.NamedExec(query, media)
+	if err != nil {
+		return err
+	}
+
+	media.ID, err = result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	return m.DB.Get(&media.CreateTime, "SELECT create_time FROM media WHERE id = ?", media.ID)
+}
+
+func (m *MediaModel) Get(id int64) (*Media, error) {
+	var media Media
+	err := m.DB.Get(&media, "SELECT * FROM media WHERE id = ?", id)
+	return &media, err
+}
+
+// SetAttachments replaces the media attached to a note. The order of
+// attachments is kept.
+func (m *NoteModel) SetAttachments(noteID int64, attachments []NoteAttachment) error {
+	tx, err := m.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error
+
+	if _, err := tx.Exec("DELETE FROM note_media WHERE note_id = ?", noteID); err != nil {
+		return err
+	}
+
+	query := "INSERT INTO note_media (note_id, media_id, description, position) VALUES (?, ?, ?, ?)"
+	for i, attachment := range attachments {
+		if _, err := tx.Exec(query, noteID, attachment.ID, attachment.Description, i); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// loadAttachments fills in the Attachments of the given notes.
+func (m *NoteModel) loadAttachments(notes []Note) error {
+	if len(notes) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(notes))
+	for _, note := range notes {
+		ids = append(ids, note.ID)
+	}
+
+	query, args, err := sqlx.In(`
+		SELECT m.*, nm.note_id, nm.description FROM note_media nm
+		JOIN media m ON m.id = nm.media_id
+		WHERE nm.note_id IN (?)
+		ORDER BY nm.note_id, nm.position
+	`, ids)
+	if err != nil {
+		return err
+	}
+
+	var attachments []NoteAttachment
+	if err := m.DB.Select(&attachments, query, args...); err != nil {
+		return err
+	}
+
+	byNote := make(map[int64][]NoteAttachment)
+	for _, attachment := range attachments {
+		byNote[attachment.NoteID] = append(byNote[attachment.NoteID], attachment)
+	}
+	for i := range notes {
+		notes[i].Attachments = byNote[notes[i].ID]
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+// NoteMention is a remote account mentioned in a note.
+type NoteMention struct {
+	NoteID      int64  `db:"note_id" json:"-"`
+	ActorURI    string `db:"actor_uri" json:"actor_uri"`
+	Acct        string `db:"acct" json:"acct"`
+	URL         string `db:"url" json:"url"`
+	InboxURI    string `db:"inbox_uri" json:"-"`
+	SharedInbox string `db:"shared_inbox" json:"-"`
+}
+
+// SetMentions replaces the mentions of a note. The order of mentions is
+// kept.
+func (m *NoteModel) SetMentions(noteID int64, mentions []NoteMention) error {
+	tx, err := m.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error
+
+	if _, err := tx.Exec("DELETE FROM note_mentions WHERE note_id = ?", noteID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT OR IGNORE INTO note_mentions (note_id, actor_uri, acct, url, inbox_uri, shared_inbox)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	for _, mention := range mentions {
+		if _, err := tx.Exec(query, noteID, mention.ActorURI, mention.Acct, mention.URL, mention.InboxURI, mention.SharedInbox); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// loadMentions fills in the Mentions of the given notes.
+func (m *NoteModel) loadMentions(notes []Note) error {
+	if len(notes) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(notes))
+	for _, note := range notes {
+		ids = append(ids, note.ID)
+	}
+
+	query, args, err := sqlx.In(`
+		SELECT note_id, actor_uri, acct, url, inbox_uri, shared_inbox FROM note_mentions
+		WHERE note_id IN (?)
+		ORDER BY note_id, rowid
+	`, ids)
+	if err != nil {
+		return err
+	}
+
+	var mentions []NoteMention
+	if err := m.DB.Select(&mentions, query, args...); err != nil {
+		return err
+	}
+
+	byNote := make(map[int64][]NoteMention)
+	for _, mention := range mentions {
+		byNote[mention.NoteID] = append(byNote[mention.NoteID], mention)
+	}
+	for i := range notes {
+		notes[i].Mentions = byNote[notes[i].ID]
+	}
+	return nil
+}
+
+// MentionsActor reports whether the note mentions actorURI.
+func (n *Note) MentionsActor(actorURI string) bool {
+	for _, mention := range n.Mentions {
+		if mention.ActorURI == actorURI {
+			return true
+		}
+	}
+	return false
+}
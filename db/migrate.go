@@ -0,0 +1,228 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// Migration is one numbered step of the schema. Up and Down may hold
+// several statements and each runs in a transaction.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+	// Requires names an SQLite module the migration needs, such as fts5.
+	// When SQLite was built without it, the migration is left pending and
+	// the later ones are applied. It is applied once the module is there.
+	Requires string
+}
+
+// MigrationStatus tells whether a migration has been applied.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+const schemaMigrations = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at DATETIME NOT NULL
+);`
+
+// legacyAlters brought databases created before schema_migrations up to
+// date on every boot. They are run once, with errors ignored, when such a
+// database is first migrated, after which it is recorded at version 1.
+var legacyAlters = []string{
+	"ALTER TABLE notes ADD COLUMN category TEXT DEFAULT ''",
+	"ALTER TABLE notes ADD COLUMN likes INTEGER DEFAULT 0",
+	"ALTER TABLE notes ADD COLUMN shares INTEGER DEFAULT 0",
+	"ALTER TABLE profile ADD COLUMN hide_network INTEGER NOT NULL DEFAULT 0",
+	"ALTER TABLE notes ADD COLUMN author_uri TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE notes ADD COLUMN update_time DATETIME",
+	"ALTER TABLE notes ADD COLUMN source TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE note_revisions ADD COLUMN source TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE followers ADD COLUMN shared_inbox TEXT NOT NULL DEFAULT ''",
+}
+
+// MigrationStatus lists every known migration and when it was applied.
+func (db *DB) MigrationStatus() ([]MigrationStatus, error) {
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Migration: m}
+		if at, ok := applied[m.Version]; ok {
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// MigrateUp applies every pending migration in order and returns the ones
+// it applied. It stops at the first migration that fails. Migrations whose
+// required module is missing are skipped.
+func (db *DB) MigrateUp() ([]Migration, error) {
+	var done []Migration
+	adopted, err := db.adoptLegacySchema()
+	if err != nil {
+		return nil, err
+	}
+	if adopted {
+		done = append(done, migrations[0])
+	}
+	if _, err := db.Exec(schemaMigrations); err != nil {
+		return done, err
+	}
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return done, err
+	}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if m.Requires != "" {
+			ok, err := db.HasModule(m.Requires)
+			if err != nil {
+				return done, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		if err := db.runMigration(m, m.Up, true); err != nil {
+			return done, fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// MigrateDown reverts the latest applied migration. It returns nil when no
+// migration is applied.
+func (db *DB) MigrateDown() (*Migration, error) {
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if err := db.runMigration(m, m.Down, false); err != nil {
+			return nil, fmt.Errorf("reverting migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		return &m, nil
+	}
+	return nil, nil
+}
+
+// runMigration runs one direction of a migration and records it, in a
+// single transaction.
+func (db *DB) runMigration(m Migration, query string, up bool) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error
+
+	if _, err := tx.Exec(query); err != nil {
+		return err
+	}
+
+	if up {
+		_, err = tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", m.Version, m.Name, time.Now().UTC())
+	} else {
+		_, err = tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// appliedMigrations returns when each applied migration was applied.
+func (db *DB) appliedMigrations() (map[int]time.Time, error) {
+	exists, err := db.hasTable("schema_migrations")
+	if err != nil || !exists {
+		return map[int]time.Time{}, err
+	}
+
+	var rows []struct {
+		Version   int       `db:"version"`
+		AppliedAt time.Time `db:"applied_at"`
+	}
+	if err := db.Select(&rows, "SELECT version, applied_at FROM schema_migrations"); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]time.Time, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row.AppliedAt
+	}
+	return applied, nil
+}
+
+// adoptLegacySchema records a database created before schema_migrations
+// existed at version 1, after bringing it to that schema. It reports whether
+// the database needed it.
+func (db *DB) adoptLegacySchema() (bool, error) {
+	hasNotes, err := db.hasTable("notes")
+	if err != nil {
+		return false, err
+	}
+	hasMigrations, err := db.hasTable("schema_migrations")
+	if err != nil {
+		return false, err
+	}
+	if !hasNotes || hasMigrations {
+		return false, nil
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback() // Rollback on error
+
+	// Migration 1 only creates tables that do not exist yet.
+	if _, err := tx.Exec(migrations[0].Up); err != nil {
+		return false, fmt.Errorf("adopting legacy schema failed: %w", err)
+	}
+	for _, alter := range legacyAlters {
+		// The column may already exist.
+		tx.Exec(alter)
+	}
+	if _, err := tx.Exec(schemaMigrations); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", migrations[0].Version, migrations[0].Name, time.Now().UTC()); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// HasModule reports whether SQLite was built with a module, such as fts5.
+func (db *DB) HasModule(name string) (bool, error) {
+	var count int
+	err := db.Get(&count, "SELECT COUNT(*) FROM pragma_module_list WHERE name = ?", name)
+	return count > 0, err
+}
+
+func (db *DB) hasTable(name string) (bool, error) {
+	var count int
+	err := db.Get(&count, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name)
+	return count > 0, err
+}
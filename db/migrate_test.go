@@ -0,0 +1,151 @@
+package db
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateUpAndDown(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "knife.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	hasFTS, err := db.HasModule("fts5")
+	if err != nil {
+		t.Fatalf("HasModule: %v", err)
+	}
+
+	done, err := db.MigrateUp()
+	if err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	want := len(migrations)
+	if !hasFTS {
+		want--
+	}
+	if len(done) != want {
+		t.Fatalf("MigrateUp applied %d migrations, want %d", len(done), want)
+	}
+
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	for _, status := range statuses {
+		skipped := status.Requires != "" && !hasFTS
+		if applied := status.AppliedAt != nil; applied == skipped {
+			t.Errorf("migration %d applied = %v, want %v", status.Version, applied, !skipped)
+		}
+	}
+
+	// Running again applies nothing.
+	if done, err := db.MigrateUp(); err != nil || len(done) != 0 {
+		t.Fatalf("second MigrateUp = %d migrations, %v; want none", len(done), err)
+	}
+
+	for i := 0; i < want; i++ {
+		m, err := db.MigrateDown()
+		if err != nil {
+			t.Fatalf("MigrateDown: %v", err)
+		}
+		if m == nil {
+			t.Fatalf("MigrateDown reverted nothing after %d steps", i)
+		}
+	}
+	if m, err := db.MigrateDown(); err != nil || m != nil {
+		t.Fatalf("MigrateDown on an empty schema = %v, %v; want nil", m, err)
+	}
+
+	var tables []string
+	if err := db.Select(&tables, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT IN ('schema_migrations', 'sqlite_sequence')"); err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 0 {
+		t.Errorf("tables left after reverting every migration: %v", tables)
+	}
+
+	// And the schema can be built again.
+	if done, err := db.MigrateUp(); err != nil || len(done) != want {
+		t.Fatalf("MigrateUp after reverting = %d migrations, %v; want %d", len(done), err, want)
+	}
+}
+
+func TestMigrateUpAdoptsLegacySchema(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "knife.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	// A database from before schema_migrations, missing later columns.
+	if _, err := db.Exec(`CREATE TABLE notes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		uri TEXT UNIQUE,
+		cw TEXT NOT NULL,
+		content TEXT NOT NULL,
+		host TEXT NOT NULL,
+		author_name TEXT NOT NULL,
+		public_range INTEGER NOT NULL,
+		create_time DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		author_finger TEXT NOT NULL
+	)`); err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := db.MigrateUp()
+	if err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	if len(done) == 0 || done[0].Version != 1 {
+		t.Fatalf("MigrateUp did not adopt the legacy schema: %v", done)
+	}
+
+	createNote(t, NewNoteModel(db), Note{Content: "old", Source: "old", Category: "misc"})
+}
+
+func TestMigrateBackfillsRemoteAuthors(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.Exec(`INSERT INTO following (actor_uri, inbox_uri, acct, follow_id, state) VALUES
+		('https://remote.example/users/bob', 'https://remote.example/users/bob/inbox', 'bob@remote.example', 'https://knife.example/follow/1', 'accepted')`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rows as stored before author_uri was recorded.
+	notes := []struct {
+		finger   string
+		wantURI  string
+		wantSelf bool
+	}{
+		{"alice", "", true},
+		{"Bob@remote.example", "https://remote.example/users/bob", false},
+		{"carol@other.example", "acct:carol@other.example", false},
+	}
+	for i, note := range notes {
+		if _, err := db.Exec("INSERT INTO notes (uri, cw, content, host, author_name, public_range, author_finger) VALUES (?, '', 'x', 'example.com', '', 0, ?)",
+			fmt.Sprintf("https://example.com/notes/%d", i), note.finger); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Apply the backfill again to the rows.
+	if m, err := db.MigrateDown(); err != nil || m.Version != 10 {
+		t.Fatalf("MigrateDown = %v, %v", m, err)
+	}
+	if _, err := db.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+
+	m := NewNoteModel(db)
+	for i, want := range notes {
+		note, err := m.Get(int64(i + 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if note.AuthorURI != want.wantURI || note.IsLocal() != want.wantSelf {
+			t.Errorf("note by %s: author_uri = %q, local = %v; want %q, %v", want.finger, note.AuthorURI, note.IsLocal(), want.wantURI, want.wantSelf)
+		}
+	}
+}
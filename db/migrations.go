@@ -0,0 +1,345 @@
+package db
+
+// migrations is the schema history, oldest first. Applied migrations must
+// not be edited; change the schema by appending a new one.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		Up: `
+CREATE TABLE IF NOT EXISTS notes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    uri TEXT UNIQUE,
+    cw TEXT NOT NULL,
+    content TEXT NOT NULL,
+    host TEXT NOT NULL,
+    author_name TEXT NOT NULL,
+    public_range INTEGER NOT NULL,
+    create_time DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    author_finger TEXT NOT NULL,
+    category TEXT DEFAULT '',
+    likes INTEGER DEFAULT 0,
+    shares INTEGER DEFAULT 0,
+    author_uri TEXT NOT NULL DEFAULT '',
+    update_time DATETIME,
+    source TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS note_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    note_id INTEGER NOT NULL,
+    cw TEXT NOT NULL,
+    content TEXT NOT NULL,
+    public_range INTEGER NOT NULL,
+    category TEXT DEFAULT '',
+    create_time DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    source TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS media (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    file_name TEXT NOT NULL UNIQUE,
+    thumbnail_name TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    blurhash TEXT NOT NULL DEFAULT '',
+    size INTEGER NOT NULL,
+    create_time DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS note_media (
+    note_id INTEGER NOT NULL,
+    media_id INTEGER NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    position INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (note_id, media_id)
+);
+
+CREATE TABLE IF NOT EXISTS profile (
+    finger TEXT PRIMARY KEY,
+    password_hash TEXT NOT NULL,
+    display_name TEXT NOT NULL,
+    avatar_url TEXT NOT NULL,
+    bio TEXT NOT NULL,
+    hide_network INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS bookmarks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    note_id INTEGER NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS followers (
+    actor_uri TEXT PRIMARY KEY,
+    inbox_uri TEXT NOT NULL,
+    shared_inbox TEXT NOT NULL DEFAULT '',
+    followed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS following (
+    actor_uri TEXT PRIMARY KEY,
+    inbox_uri TEXT NOT NULL,
+    acct TEXT NOT NULL,
+    follow_id TEXT NOT NULL UNIQUE,
+    state TEXT NOT NULL DEFAULT 'pending',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS httpsigs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    actor TEXT NOT NULL UNIQUE,
+    public_key TEXT NOT NULL,
+    private_key TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS drafts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    content TEXT NOT NULL,
+    create_time DATETIME NOT NULL,
+    update_time DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    inbox_uri TEXT NOT NULL,
+    actor_uri TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    state TEXT NOT NULL DEFAULT 'pending',
+    created_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_deliveries_due ON deliveries (state, next_attempt_at);
+
+CREATE TABLE IF NOT EXISTS dead_inboxes (
+    inbox_uri TEXT PRIMARY KEY,
+    last_error TEXT NOT NULL DEFAULT '',
+    marked_at DATETIME NOT NULL
+);
+`,
+		Down: `
+DROP TABLE IF EXISTS notes;
+DROP TABLE IF EXISTS note_revisions;
+DROP TABLE IF EXISTS media;
+DROP TABLE IF EXISTS note_media;
+DROP TABLE IF EXISTS profile;
+DROP TABLE IF EXISTS bookmarks;
+DROP TABLE IF EXISTS followers;
+DROP TABLE IF EXISTS following;
+DROP TABLE IF EXISTS httpsigs;
+DROP TABLE IF EXISTS drafts;
+DROP TABLE IF EXISTS deliveries;
+DROP TABLE IF EXISTS dead_inboxes;
+`,
+	},
+	{
+		Version:  2,
+		Name:     "note search",
+		Requires: "fts5",
+		Up: `
+CREATE VIRTUAL TABLE notes_fts USING fts5(
+    content, cw, category,
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+INSERT INTO notes_fts (rowid, content, cw, category)
+SELECT id, CASE WHEN source != '' THEN source ELSE content END, cw, COALESCE(category, '') FROM notes;
+
+CREATE TRIGGER notes_fts_insert AFTER INSERT ON notes BEGIN
+    INSERT INTO notes_fts (rowid, content, cw, category)
+    VALUES (new.id, CASE WHEN new.source != '' THEN new.source ELSE new.content END, new.cw, COALESCE(new.category, ''));
+END;
+
+CREATE TRIGGER notes_fts_update AFTER UPDATE OF content, source, cw, category ON notes BEGIN
+    DELETE FROM notes_fts WHERE rowid = old.id;
+    INSERT INTO notes_fts (rowid, content, cw, category)
+    VALUES (new.id, CASE WHEN new.source != '' THEN new.source ELSE new.content END, new.cw, COALESCE(new.category, ''));
+END;
+
+CREATE TRIGGER notes_fts_delete AFTER DELETE ON notes BEGIN
+    DELETE FROM notes_fts WHERE rowid = old.id;
+END;
+`,
+		Down: `
+DROP TRIGGER IF EXISTS notes_fts_insert;
+DROP TRIGGER IF EXISTS notes_fts_update;
+DROP TRIGGER IF EXISTS notes_fts_delete;
+DROP TABLE IF EXISTS notes_fts;
+`,
+	},
+	{
+		Version: 3,
+		Name:    "note tags",
+		Up: `
+CREATE TABLE tags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE note_tags (
+    note_id INTEGER NOT NULL,
+    tag_id INTEGER NOT NULL,
+    PRIMARY KEY (note_id, tag_id)
+);
+CREATE INDEX idx_note_tags_tag ON note_tags (tag_id, note_id);
+
+CREATE TRIGGER note_tags_delete AFTER DELETE ON notes BEGIN
+    DELETE FROM note_tags WHERE note_id = old.id;
+END;
+`,
+		Down: `
+DROP TRIGGER IF EXISTS note_tags_delete;
+DROP TABLE IF EXISTS note_tags;
+DROP TABLE IF EXISTS tags;
+`,
+	},
+	{
+		Version: 4,
+		Name:    "note mentions",
+		Up: `
+CREATE TABLE note_mentions (
+    note_id INTEGER NOT NULL,
+    actor_uri TEXT NOT NULL,
+    acct TEXT NOT NULL,
+    url TEXT NOT NULL,
+    inbox_uri TEXT NOT NULL,
+    shared_inbox TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (note_id, actor_uri)
+);
+CREATE INDEX idx_note_mentions_actor ON note_mentions (actor_uri);
+
+CREATE TRIGGER note_mentions_delete AFTER DELETE ON notes BEGIN
+    DELETE FROM note_mentions WHERE note_id = old.id;
+END;
+`,
+		Down: `
+DROP TRIGGER IF EXISTS note_mentions_delete;
+DROP TABLE IF EXISTS note_mentions;
+`,
+	},
+	{
+		Version: 5,
+		Name:    "note replies",
+		Up: `
+ALTER TABLE notes ADD COLUMN in_reply_to TEXT NOT NULL DEFAULT '';
+CREATE INDEX idx_notes_in_reply_to ON notes (in_reply_to);
+`,
+		Down: `
+DROP INDEX IF EXISTS idx_notes_in_reply_to;
+ALTER TABLE notes DROP COLUMN in_reply_to;
+`,
+	},
+	{
+		Version: 6,
+		Name:    "likes and boosts",
+		Up: `
+ALTER TABLE notes ADD COLUMN boost_of INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX idx_notes_boost_of ON notes (boost_of) WHERE boost_of != 0;
+
+CREATE TABLE note_likes (
+    note_id INTEGER PRIMARY KEY,
+    activity_id TEXT NOT NULL,
+    create_time DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER note_reactions_delete AFTER DELETE ON notes BEGIN
+    DELETE FROM note_likes WHERE note_id = old.id;
+    DELETE FROM notes WHERE boost_of = old.id;
+END;
+`,
+		Down: `
+DROP TRIGGER IF EXISTS note_reactions_delete;
+DROP TABLE IF EXISTS note_likes;
+DELETE FROM notes WHERE boost_of != 0;
+DROP INDEX IF EXISTS idx_notes_boost_of;
+ALTER TABLE notes DROP COLUMN boost_of;
+`,
+	},
+	{
+		Version: 7,
+		Name:    "sessions",
+		Up: `
+CREATE TABLE sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_hash TEXT NOT NULL UNIQUE,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    last_seen_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_sessions_expires_at ON sessions (expires_at);
+`,
+		Down: `
+DROP INDEX IF EXISTS idx_sessions_expires_at;
+DROP TABLE IF EXISTS sessions;
+`,
+	},
+	{
+		Version: 8,
+		Name:    "two-factor authentication",
+		Up: `
+ALTER TABLE profile ADD COLUMN totp_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE profile ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE profile ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE recovery_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code_hash TEXT NOT NULL UNIQUE,
+    used_at DATETIME
+);
+
+ALTER TABLE sessions ADD COLUMN pending BOOLEAN NOT NULL DEFAULT 0;
+`,
+		Down: `
+DELETE FROM sessions WHERE pending = 1;
+ALTER TABLE sessions DROP COLUMN pending;
+DROP TABLE IF EXISTS recovery_codes;
+ALTER TABLE profile DROP COLUMN totp_last_step;
+ALTER TABLE profile DROP COLUMN totp_enabled;
+ALTER TABLE profile DROP COLUMN totp_secret;
+`,
+	},
+	{
+		Version: 9,
+		Name:    "note cleanup",
+		Up: `
+DELETE FROM note_revisions WHERE note_id NOT IN (SELECT id FROM notes);
+DELETE FROM bookmarks WHERE note_id NOT IN (SELECT id FROM notes);
+DELETE FROM note_media WHERE note_id NOT IN (SELECT id FROM notes);
+
+CREATE TRIGGER note_children_delete AFTER DELETE ON notes BEGIN
+    DELETE FROM note_revisions WHERE note_id = old.id;
+    DELETE FROM bookmarks WHERE note_id = old.id;
+    DELETE FROM note_media WHERE note_id = old.id;
+END;
+`,
+		Down: `
+DROP TRIGGER IF EXISTS note_children_delete;
+`,
+	},
+	{
+		Version: 10,
+		Name:    "remote note authors",
+		// Notes federated before author_uri was recorded have none and
+		// would pass for our own. Their author_finger is user@host, unlike
+		// that of local notes. The actor is taken from the accounts we
+		// follow or have mentioned; otherwise an acct: URI keeps the note
+		// remote without naming an actor that could claim it.
+		Up: `
+UPDATE notes SET author_uri = COALESCE(
+    (SELECT actor_uri FROM following WHERE lower(following.acct) = lower(notes.author_finger)),
+    (SELECT actor_uri FROM note_mentions WHERE lower(note_mentions.acct) = lower(notes.author_finger) LIMIT 1),
+    'acct:' || author_finger
+)
+WHERE author_uri = '' AND author_finger LIKE '%_@_%';
+`,
+		Down: `
+UPDATE notes SET author_uri = '' WHERE author_uri LIKE 'acct:%';
+`,
+	},
+}
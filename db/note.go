@@ -2,6 +2,7 @@ package db
 
 import (
 	"fmt"
+	"slices"
 	"time"
 )
 
@@ -27,8 +28,27 @@ type Note struct {
 	Category     string          `db:"category" json:"category,omitempty"`
 	Likes        int64           `db:"likes" json:"likes"`
 	Shares       int64           `db:"shares" json:"shares"`
+	AuthorURI    string          `db:"author_uri" json:"author_uri,omitempty"`
+	UpdateTime   *time.Time      `db:"update_time" json:"update_time,omitempty"`
+	Source       string          `db:"source" json:"source,omitempty"`
+	InReplyTo    string          `db:"in_reply_to" json:"in_reply_to,omitempty"`
+	// BoostOf is the ID of the note this one boosts. Boosts have no
+	// content of their own.
+	BoostOf int64 `db:"boost_of" json:"boost_of,omitempty"`
+
+	Attachments []NoteAttachment `db:"-" json:"attachments,omitempty"`
+	Tags        []string         `db:"-" json:"tags,omitempty"`
+	Mentions    []NoteMention    `db:"-" json:"mentions,omitempty"`
+	// Boost is the note boosted, for boosts.
+	Boost *Note `db:"-" json:"boost,omitempty"`
+	// Liked and Boosted tell whether the owner liked or boosted the note.
+	Liked   bool `db:"-" json:"liked,omitempty"`
+	Boosted bool `db:"-" json:"boosted,omitempty"`
 }
 
+// noteColumns lists the columns selected into a Note.
+const noteColumns = "id, uri, cw, content, host, author_name, author_finger, public_range, create_time, category, likes, shares, author_uri, update_time, source, in_reply_to, boost_of"
+
 type NoteModel struct {
 	DB *DB
 }
@@ -40,21 +60,23 @@ func NewNoteModel(db *DB) *NoteModel {
 // CreateFederatedNote creates a note that already has a URI (e.g., from ActivityPub).
 func (m *NoteModel) CreateFederatedNote(note *Note) error {
 	query := `
-		INSERT INTO notes (uri, cw, content, host, author_name, public_range, author_finger, category, likes, shares)
-		VALUES (:uri, :cw, :content, :host, :author_name, :public_range, :author_finger, :category, :likes, :shares)
+		INSERT INTO notes (uri, cw, content, host, author_name, public_range, author_finger, category, likes, shares, author_uri, in_reply_to)
+		VALUES (:uri, :cw, :content, :host, :author_name, :public_range, :author_finger, :category, :likes, :shares, :author_uri, :in_reply_to)
 	`
 
-	_, err := m.DB.NamedExec(query, note)
+	result, err := m.DB.NamedExec(query, note)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	note.ID, err = result.LastInsertId()
+	return err
 }
 
 // CreateLocalNote creates a note originating from the local instance.
-// It inserts the note, gets the ID, and then constructs the URI.
-func (m *NoteModel) CreateLocalNote(note *Note) error {
+// It inserts the note, gets the ID, and then constructs the URI under
+// baseURL, the public URL of the instance.
+func (m *NoteModel) CreateLocalNote(note *Note, baseURL string) error {
 	tx, err := m.DB.Beginx()
 	if err != nil {
 		return err
@@ -63,8 +85,8 @@ func (m *NoteModel) CreateLocalNote(note *Note) error {
 
 	// Insert the note without the URI
 	query := `
-		INSERT INTO notes (cw, content, host, author_name, public_range, author_finger, category, likes, shares)
-		VALUES (:cw, :content, :host, :author_name, :public_range, :author_finger, :category, 0, 0)
+		INSERT INTO notes (cw, content, host, author_name, public_range, author_finger, category, likes, shares, source, in_reply_to, boost_of)
+		VALUES (:cw, :content, :host, :author_name, :public_range, :author_finger, :category, 0, 0, :source, :in_reply_to, :boost_of)
 	`
 	result, err := tx.NamedExec(query, note)
 	if err != nil {
@@ -78,8 +100,7 @@ func (m *NoteModel) CreateLocalNote(note *Note) error {
 	note.ID = id
 
 	// Generate the URI and update the note
-	// Note: The note.Host must be set by the caller (API layer)
-	note.URI = fmt.Sprintf("https://%s/notes/%d", note.Host, note.ID)
+	note.URI = fmt.Sprintf("%s/notes/%d", baseURL, note.ID)
 	updateQuery := "UPDATE notes SET uri = ? WHERE id = ?"
 	if _, err := tx.Exec(updateQuery, note.URI, note.ID); err != nil {
 		return err
@@ -94,17 +115,40 @@ func (m *NoteModel) CreateLocalNote(note *Note) error {
 }
 
 func (m *NoteModel) Get(id int64) (*Note, error) {
-	var note Note
-	query := "SELECT id, uri, cw, content, host, author_name, author_finger, public_range, create_time, category, likes, shares FROM notes WHERE id = ?"
-	err := m.DB.Get(&note, query, id)
-	return &note, err
+	query := "SELECT " + noteColumns + " FROM notes WHERE id = ?"
+	return m.getOne(query, id)
 }
 
 func (m *NoteModel) GetByURI(uri string) (*Note, error) {
-	var note Note
-	query := "SELECT id, uri, cw, content, host, author_name, author_finger, public_range, create_time, category, likes, shares FROM notes WHERE uri = ?"
-	err := m.DB.Get(&note, query, uri)
-	return &note, err
+	query := "SELECT " + noteColumns + " FROM notes WHERE uri = ?"
+	return m.getOne(query, uri)
+}
+
+func (m *NoteModel) getOne(query string, args ...interface{}) (*Note, error) {
+	notes := make([]Note, 1)
+	if err := m.DB.Get(&notes[0], query, args...); err != nil {
+		return &notes[0], err
+	}
+	err := m.loadDetails(notes)
+	return &notes[0], err
+}
+
+// loadDetails fills in the attachments, tags, mentions and reactions of
+// the given notes, and the notes boosted by boosts.
+func (m *NoteModel) loadDetails(notes []Note) error {
+	if err := m.loadAttachments(notes); err != nil {
+		return err
+	}
+	if err := m.loadTags(notes); err != nil {
+		return err
+	}
+	if err := m.loadMentions(notes); err != nil {
+		return err
+	}
+	if err := m.loadReactions(notes); err != nil {
+		return err
+	}
+	return m.loadBoosts(notes)
 }
 
 // Update allows modifying a note's content. It also allows setting the URI.
@@ -118,8 +162,39 @@ func (m *NoteModel) Update(note *Note) error {
 	return err
 }
 
+// Revise edits a local note. The current version is kept in note_revisions
+// and the note's update_time is set.
+func (m *NoteModel) Revise(note *Note) error {
+	tx, err := m.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error
+
+	snapshot := `
+		INSERT INTO note_revisions (note_id, cw, content, public_range, category, source)
+		SELECT id, cw, content, public_range, COALESCE(category, ''), source FROM notes WHERE id = ?
+	`
+	if _, err := tx.Exec(snapshot, note.ID); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	note.UpdateTime = &now
+	query := `
+		UPDATE notes
+		SET cw = :cw, content = :content, source = :source, public_range = :public_range, category = :category, update_time = :update_time
+		WHERE id = :id
+	`
+	if _, err := tx.NamedExec(query, note); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (m *NoteModel) UpdateFederatedNote(note *Note) error {
-	query := "UPDATE notes SET content = ? WHERE uri = ?"
+	query := "UPDATE notes SET content = ?, update_time = CURRENT_TIMESTAMP WHERE uri = ?"
 	_, err := m.DB.Exec(query, note.Content, note.URI)
 	return err
 }
@@ -130,22 +205,48 @@ func (m *NoteModel) Delete(id int64) error {
 	return err
 }
 
-func (m *NoteModel) DeleteByURI(uri string) error {
-	query := "DELETE FROM notes WHERE uri = ?"
-	_, err := m.DB.Exec(query, uri)
-	return err
-}
+// listPage selects the notes matching where, bounded by the exclusive
+// before/after ID cursors. Notes come back newest first. When only after is
+// given, the page directly following it is returned instead of the newest
+// notes, so clients can walk forward without gaps.
+func (m *NoteModel) listPage(where string, args []interface{}, limit int, before, after int64) ([]Note, error) {
+	query := "SELECT " + noteColumns + " FROM notes WHERE " + where
+	if before > 0 {
+		query += " AND id < ?"
+		args = append(args, before)
+	}
+	if after > 0 {
+		query += " AND id > ?"
+		args = append(args, after)
+	}
 
-func (m *NoteModel) ListRecent() ([]Note, error) {
-	var notes []Note
-	query := "SELECT id, uri, cw, content, host, author_name, author_finger, public_range, create_time, category, likes, shares FROM notes ORDER BY create_time DESC LIMIT 100"
-	err := m.DB.Select(&notes, query)
-	return notes, err
+	ascending := after > 0 && before == 0
+	if ascending {
+		query += " ORDER BY id ASC LIMIT ?"
+	} else {
+		query += " ORDER BY id DESC LIMIT ?"
+	}
+	args = append(args, limit)
+
+	notes := []Note{}
+	if err := m.DB.Select(&notes, query, args...); err != nil {
+		return nil, err
+	}
+	if ascending {
+		slices.Reverse(notes)
+	}
+	if err := m.loadDetails(notes); err != nil {
+		return nil, err
+	}
+	return notes, nil
 }
 
-func (m *NoteModel) ListByMyRecent() ([]Note, error) {
-	var notes []Note
+func (m *NoteModel) ListRecent(limit int, before, after int64) ([]Note, error) {
+	return m.listPage("1 = 1", nil, limit, before, after)
+}
 
+// ListByMyRecent returns our own notes that viewer may see.
+func (m *NoteModel) ListByMyRecent(viewer NoteViewer, limit int, before, after int64) ([]Note, error) {
 	fquery := `SELECT finger FROM profile LIMIT 1`
 	var myFinger string
 	err := m.DB.Get(&myFinger, fquery)
@@ -153,23 +254,63 @@ func (m *NoteModel) ListByMyRecent() ([]Note, error) {
 		return nil, err
 	}
 
-	query := "SELECT id, uri, cw, content, host, author_name, author_finger, public_range, create_time, category, likes, shares FROM notes WHERE author_finger = ? ORDER BY create_time DESC LIMIT 100"
-	err = m.DB.Select(&notes, query, myFinger)
+	visible, args := viewer.visibleWhere()
+	args = append([]interface{}{myFinger}, args...)
+	return m.listPage("author_finger = ? AND "+visible, args, limit, before, after)
+}
+
+// CountMyPublic returns the number of local notes that are public or unlisted.
+func (m *NoteModel) CountMyPublic() (int, error) {
+	var count int
+	query := `
+		SELECT COUNT(*) FROM notes
+		WHERE author_finger = (SELECT finger FROM profile LIMIT 1) AND public_range IN (?, ?)
+	`
+	err := m.DB.Get(&count, query, NotePublicRangePublic, NotePublicRangeUnlisted)
+	return count, err
+}
+
+// ListMyPublic returns local public and unlisted notes, newest first.
+func (m *NoteModel) ListMyPublic(limit, offset int) ([]Note, error) {
+	var notes []Note
+	query := `
+		SELECT ` + noteColumns + ` FROM notes
+		WHERE author_finger = (SELECT finger FROM profile LIMIT 1) AND public_range IN (?, ?)
+		ORDER BY create_time DESC, id DESC LIMIT ? OFFSET ?
+	`
+	if err := m.DB.Select(&notes, query, NotePublicRangePublic, NotePublicRangeUnlisted, limit, offset); err != nil {
+		return nil, err
+	}
+	err := m.loadDetails(notes)
 	return notes, err
 }
 
-func (m *NoteModel) ListCategories() ([]string, error) {
+// ListHome returns our own notes and notes from accounts we follow.
+func (m *NoteModel) ListHome(limit int, before, after int64) ([]Note, error) {
+	where := `(author_finger = (SELECT finger FROM profile LIMIT 1)
+		OR author_uri IN (SELECT actor_uri FROM following WHERE state = ?))`
+	return m.listPage(where, []interface{}{FollowingStateAccepted}, limit, before, after)
+}
+
+// ListPublic returns public notes from every source, local or federated.
+func (m *NoteModel) ListPublic(limit int, before, after int64) ([]Note, error) {
+	return m.listPage("public_range = ?", []interface{}{NotePublicRangePublic}, limit, before, after)
+}
+
+// ListCategories returns the categories of the notes viewer may see.
+func (m *NoteModel) ListCategories(viewer NoteViewer) ([]string, error) {
 	var categories []string
-	query := "SELECT DISTINCT category FROM notes WHERE category != '' AND category IS NOT NULL ORDER BY category ASC"
-	err := m.DB.Select(&categories, query)
+	visible, args := viewer.visibleWhere()
+	query := "SELECT DISTINCT category FROM notes WHERE category != '' AND category IS NOT NULL AND " + visible + " ORDER BY category ASC"
+	err := m.DB.Select(&categories, query, args...)
 	return categories, err
 }
 
-func (m *NoteModel) ListByCategory(category string) ([]Note, error) {
-	var notes []Note
-	query := "SELECT id, uri, cw, content, host, author_name, author_finger, public_range, create_time, category, likes, shares FROM notes WHERE category = ? ORDER BY create_time DESC LIMIT 100"
-	err := m.DB.Select(&notes, query, category)
-	return notes, err
+// ListByCategory returns the notes in category that viewer may see.
+func (m *NoteModel) ListByCategory(category string, viewer NoteViewer, limit int, before, after int64) ([]Note, error) {
+	visible, args := viewer.visibleWhere()
+	args = append([]interface{}{category}, args...)
+	return m.listPage("category = ? AND "+visible, args, limit, before, after)
 }
 
 func (m *NoteModel) IncrementLikes(id int64) error {
@@ -0,0 +1,23 @@
+package db
+
+import "time"
+
+// NoteRevision is a previous version of an edited note.
+type NoteRevision struct {
+	ID          int64           `db:"id" json:"id"`
+	NoteID      int64           `db:"note_id" json:"note_id"`
+	Cw          string          `db:"cw" json:"cw,omitempty"`
+	Content     string          `db:"content" json:"content"`
+	PublicRange NotePublicRange `db:"public_range" json:"public_range,string"`
+	Category    string          `db:"category" json:"category,omitempty"`
+	CreateTime  time.Time       `db:"create_time" json:"create_time"`
+	Source      string          `db:"source" json:"source,omitempty"`
+}
+
+// ListRevisions returns the previous versions of a note, newest first.
+func (m *NoteModel) ListRevisions(noteID int64) ([]NoteRevision, error) {
+	revisions := []NoteRevision{}
+	query := "SELECT * FROM note_revisions WHERE note_id = ? ORDER BY id DESC"
+	err := m.DB.Select(&revisions, query, noteID)
+	return revisions, err
+}
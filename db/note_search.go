@@ -0,0 +1,234 @@
+package db
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SearchTerm is one term of a search. All terms of a search must match.
+type SearchTerm struct {
+	// Text is a word or, for a quoted phrase, several.
+	Text string
+	// Prefix lets Text match the start of a longer word.
+	Prefix bool
+}
+
+// NoteSearch holds the query and filters of a full-text note search.
+type NoteSearch struct {
+	// Terms are matched against content, CW and category.
+	Terms []SearchTerm
+	// Author matches author_finger, e.g. "alice" or "bob@example.com".
+	Author   string
+	Category string
+	// Visibilities limits the results to these public ranges. Empty means
+	// any.
+	Visibilities []NotePublicRange
+	// Since and Until bound create_time. Until is exclusive.
+	Since, Until *time.Time
+	Limit        int
+	Offset       int
+}
+
+// NoteSearchResult is a note matched by a search, with a snippet of the
+// matching text. Matched terms in Snippet are wrapped in
+// SnippetMatchStart and SnippetMatchEnd.
+type NoteSearchResult struct {
+	Note
+	Snippet string `db:"snippet"`
+}
+
+const (
+	SnippetMatchStart = "\x02"
+	SnippetMatchEnd   = "\x03"
+)
+
+// searchTimeFormat matches how SQLite's datetime() prints create_time.
+const searchTimeFormat = "2006-01-02 15:04:05"
+
+// likeSnippetLength is the length in runes of the snippets made when
+// searching without FTS5.
+const likeSnippetLength = 160
+
+// Search returns the notes matching s. With the notes_fts index, the best
+// match comes first. Without it, as when SQLite was built without FTS5,
+// every term is matched as a substring and the newest note comes first.
+func (m *NoteModel) Search(s NoteSearch) ([]NoteSearchResult, error) {
+	fts, err := m.DB.hasTable("notes_fts")
+	if err != nil {
+		return nil, err
+	}
+
+	var where []string
+	var args []interface{}
+	if fts {
+		where = append(where, "notes_fts MATCH ?")
+		args = append(args, ftsMatch(s.Terms))
+	} else {
+		for _, term := range s.Terms {
+			where = append(where, `(notes.content LIKE ? ESCAPE '\' OR notes.source LIKE ? ESCAPE '\' OR notes.cw LIKE ? ESCAPE '\' OR notes.category LIKE ? ESCAPE '\')`)
+			pattern := "%" + escapeLike(term.Text) + "%"
+			args = append(args, pattern, pattern, pattern, pattern)
+		}
+	}
+
+	if s.Author != "" {
+		where = append(where, "(notes.author_finger = ? OR notes.author_finger || '@' || notes.host = ?)")
+		args = append(args, s.Author, s.Author)
+	}
+	if s.Category != "" {
+		where = append(where, "notes.category = ?")
+		args = append(args, s.Category)
+	}
+	if len(s.Visibilities) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(s.Visibilities)), ", ")
+		where = append(where, "notes.public_range IN ("+placeholders+")")
+		for _, v := range s.Visibilities {
+			args = append(args, v)
+		}
+	}
+	if s.Since != nil {
+		where = append(where, "datetime(notes.create_time) >= ?")
+		args = append(args, s.Since.UTC().Format(searchTimeFormat))
+	}
+	if s.Until != nil {
+		where = append(where, "datetime(notes.create_time) < ?")
+		args = append(args, s.Until.UTC().Format(searchTimeFormat))
+	}
+	if len(where) == 0 {
+		where = append(where, "1 = 1")
+	}
+
+	var query string
+	if fts {
+		query = `
+			SELECT ` + qualifiedNoteColumns() + `,
+				snippet(notes_fts, -1, '` + SnippetMatchStart + `', '` + SnippetMatchEnd + `', '…', 24) AS snippet
+			FROM notes_fts JOIN notes ON notes.id = notes_fts.rowid
+			WHERE ` + strings.Join(where, " AND ") + `
+			ORDER BY notes_fts.rank, notes.id DESC
+			LIMIT ? OFFSET ?
+		`
+	} else {
+		query = `
+			SELECT ` + qualifiedNoteColumns() + `, '' AS snippet
+			FROM notes
+			WHERE ` + strings.Join(where, " AND ") + `
+			ORDER BY notes.id DESC
+			LIMIT ? OFFSET ?
+		`
+	}
+	args = append(args, s.Limit, s.Offset)
+
+	results := []NoteSearchResult{}
+	if err := m.DB.Select(&results, query, args...); err != nil {
+		return nil, err
+	}
+
+	notes := make([]Note, len(results))
+	for i := range results {
+		notes[i] = results[i].Note
+	}
+	if err := m.loadDetails(notes); err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Note = notes[i]
+		if !fts {
+			text := notes[i].Source
+			if text == "" {
+				text = notes[i].Content
+			}
+			results[i].Snippet = likeSnippet(text, s.Terms)
+		}
+	}
+	return results, nil
+}
+
+// ftsMatch builds the FTS5 query for terms. Each term is quoted, so FTS5
+// operators in it are plain words.
+func ftsMatch(terms []SearchTerm) string {
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		part := `"` + strings.ReplaceAll(term.Text, `"`, `""`) + `"`
+		if term.Prefix {
+			part += "*"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+// escapeLike escapes the LIKE wildcards in s, for use with ESCAPE '\'.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// likeSnippet cuts the part of text around the first matched term and
+// marks the matches in it, the way FTS5's snippet() does.
+func likeSnippet(text string, terms []SearchTerm) string {
+	lower := strings.ToLower(text)
+	start := -1
+	for _, term := range terms {
+		if i := strings.Index(lower, strings.ToLower(term.Text)); i >= 0 && (start < 0 || i < start) {
+			start = i
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+
+	// Start a little before the match, on a rune boundary.
+	from := start
+	for n := 0; from > 0 && n < likeSnippetLength/4; n++ {
+		_, size := utf8.DecodeLastRuneInString(text[:from])
+		from -= size
+	}
+	to := from
+	for n := 0; to < len(text) && n < likeSnippetLength; n++ {
+		_, size := utf8.DecodeRuneInString(text[to:])
+		to += size
+	}
+
+	snippet := text[from:to]
+	for _, term := range terms {
+		snippet = markTerm(snippet, term.Text)
+	}
+	if from > 0 {
+		snippet = "…" + snippet
+	}
+	if to < len(text) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// markTerm wraps every case-insensitive occurrence of term in s.
+func markTerm(s, term string) string {
+	if term == "" {
+		return s
+	}
+	lowerTerm := strings.ToLower(term)
+	var b strings.Builder
+	for {
+		i := strings.Index(strings.ToLower(s), lowerTerm)
+		// Lowercasing may change byte lengths; only mark exact-length hits.
+		if i < 0 || i+len(term) > len(s) || strings.ToLower(s[i:i+len(term)]) != lowerTerm {
+			b.WriteString(s)
+			return b.String()
+		}
+		b.WriteString(s[:i])
+		b.WriteString(SnippetMatchStart + s[i:i+len(term)] + SnippetMatchEnd)
+		s = s[i+len(term):]
+	}
+}
+
+// qualifiedNoteColumns returns noteColumns prefixed with the notes table,
+// for queries joining tables that share column names.
+func qualifiedNoteColumns() string {
+	columns := strings.Split(noteColumns, ", ")
+	for i, column := range columns {
+		columns[i] = "notes." + column
+	}
+	return strings.Join(columns, ", ")
+}
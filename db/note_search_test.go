@@ -0,0 +1,106 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		name   string
+		search NoteSearch
+		want   []string
+	}{
+		{
+			name:   "word",
+			search: NoteSearch{Terms: []SearchTerm{{Text: "apple", Prefix: true}}},
+			want:   []string{"apple pie", "apple tart"},
+		},
+		{
+			name:   "all terms must match",
+			search: NoteSearch{Terms: []SearchTerm{{Text: "apple", Prefix: true}, {Text: "pie", Prefix: true}}},
+			want:   []string{"apple pie"},
+		},
+		{
+			name:   "prefix",
+			search: NoteSearch{Terms: []SearchTerm{{Text: "tar", Prefix: true}}},
+			want:   []string{"apple tart"},
+		},
+		{
+			name:   "category",
+			search: NoteSearch{Terms: []SearchTerm{{Text: "apple", Prefix: true}}, Category: "baking"},
+			want:   []string{"apple tart"},
+		},
+		{
+			name:   "visibility",
+			search: NoteSearch{Terms: []SearchTerm{{Text: "apple", Prefix: true}}, Visibilities: []NotePublicRange{NotePublicRangePublic}},
+			want:   []string{"apple pie"},
+		},
+		{
+			name:   "wildcards are literal",
+			search: NoteSearch{Terms: []SearchTerm{{Text: "%"}}},
+			want:   nil,
+		},
+	}
+
+	for _, mode := range []string{"fts5", "like"} {
+		t.Run(mode, func(t *testing.T) {
+			db := newTestDB(t)
+			if has, _ := db.hasTable("notes_fts"); !has && mode == "fts5" {
+				t.Skip("SQLite was built without fts5")
+			} else if has && mode == "like" {
+				// Drop the index to search without it.
+				if err := db.runMigration(migrations[1], migrations[1].Down, false); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			m := NewNoteModel(db)
+			createNote(t, m, Note{Content: "<p>apple pie</p>", Source: "apple pie", PublicRange: NotePublicRangePublic})
+			createNote(t, m, Note{Content: "<p>apple tart</p>", Source: "apple tart", Category: "baking", PublicRange: NotePublicRangePrivate})
+			createNote(t, m, Note{Content: "<p>pear</p>", Source: "pear", PublicRange: NotePublicRangePublic})
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					tt.search.Limit = 10
+					results, err := m.Search(tt.search)
+					if err != nil {
+						t.Fatalf("Search: %v", err)
+					}
+					got := map[string]bool{}
+					for _, r := range results {
+						got[r.Source] = true
+						if r.Snippet == "" {
+							t.Errorf("no snippet for %q", r.Source)
+						}
+					}
+					if len(got) != len(tt.want) {
+						t.Fatalf("Search = %v, want %v", got, tt.want)
+					}
+					for _, source := range tt.want {
+						if !got[source] {
+							t.Errorf("Search = %v, want %v", got, tt.want)
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestLikeSnippet(t *testing.T) {
+	tests := []struct {
+		text  string
+		terms []SearchTerm
+		want  string
+	}{
+		{"Apple pie", []SearchTerm{{Text: "apple"}}, "\x02Apple\x03 pie"},
+		{"pie and pie", []SearchTerm{{Text: "pie"}}, "\x02pie\x03 and \x02pie\x03"},
+		{"검색은 쉽다", []SearchTerm{{Text: "검색"}}, "\x02검색\x03은 쉽다"},
+		{"nothing", []SearchTerm{{Text: "x"}}, "nothing"},
+	}
+	for _, tt := range tests {
+		if got := likeSnippet(tt.text, tt.terms); got != tt.want {
+			t.Errorf("likeSnippet(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
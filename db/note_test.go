@@ -0,0 +1,137 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestCreateLocalNoteURI(t *testing.T) {
+	tests := []string{
+		"https://example.com",
+		"http://localhost:8080",
+		"https://example.com/knife",
+	}
+	m := NewNoteModel(newTestDB(t))
+	for _, baseURL := range tests {
+		t.Run(baseURL, func(t *testing.T) {
+			note := Note{Content: "hello", Host: "example.com", AuthorFinger: "alice"}
+			if err := m.CreateLocalNote(&note, baseURL); err != nil {
+				t.Fatalf("CreateLocalNote: %v", err)
+			}
+			want := fmt.Sprintf("%s/notes/%d", baseURL, note.ID)
+			if note.URI != want {
+				t.Errorf("URI = %q, want %q", note.URI, want)
+			}
+			stored, err := m.Get(note.ID)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if stored.URI != want {
+				t.Errorf("stored URI = %q, want %q", stored.URI, want)
+			}
+		})
+	}
+}
+
+func TestDeleteNoteClearsChildTables(t *testing.T) {
+	tables := []string{"note_revisions", "bookmarks", "note_media", "note_tags", "note_mentions", "note_likes"}
+
+	tests := []struct {
+		name   string
+		delete func(m *NoteModel, note *Note) error
+	}{
+		{"Delete", func(m *NoteModel, note *Note) error { return m.Delete(note.ID) }},
+		{"delete by URI", func(m *NoteModel, note *Note) error {
+			_, err := m.DB.Exec("DELETE FROM notes WHERE uri = ?", note.URI)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			m := NewNoteModel(db)
+			note := createNote(t, m, Note{Content: "first", Source: "first"})
+
+			note.Content, note.Source = "second", "second"
+			if err := m.Revise(note); err != nil {
+				t.Fatalf("Revise: %v", err)
+			}
+			if err := NewBookmarkModel(db).Create(&Bookmark{NoteID: note.ID}); err != nil {
+				t.Fatalf("bookmark: %v", err)
+			}
+			media := &Media{FileName: "a.png", ThumbnailName: "a_thumb.png", MimeType: "image/png"}
+			if err := NewMediaModel(db).Create(media); err != nil {
+				t.Fatalf("media: %v", err)
+			}
+			if err := m.SetAttachments(note.ID, []NoteAttachment{{Media: *media}}); err != nil {
+				t.Fatalf("SetAttachments: %v", err)
+			}
+			if err := m.SetTags(note.ID, []string{"tag"}); err != nil {
+				t.Fatalf("SetTags: %v", err)
+			}
+			if err := m.SetMentions(note.ID, []NoteMention{{ActorURI: "https://remote.example/users/bob", Acct: "bob@remote.example"}}); err != nil {
+				t.Fatalf("SetMentions: %v", err)
+			}
+			if err := m.AddLike(&NoteLike{NoteID: note.ID, ActivityID: "https://example.com/likes/1"}); err != nil {
+				t.Fatalf("AddLike: %v", err)
+			}
+			boost := &Note{Host: "example.com", AuthorFinger: "alice", BoostOf: note.ID}
+			if err := m.CreateBoost(boost, "https://example.com"); err != nil {
+				t.Fatalf("CreateBoost: %v", err)
+			}
+
+			if err := tt.delete(m, note); err != nil {
+				t.Fatalf("delete: %v", err)
+			}
+
+			for _, table := range tables {
+				var count int
+				if err := db.Get(&count, "SELECT COUNT(*) FROM "+table+" WHERE note_id = ?", note.ID); err != nil {
+					t.Fatal(err)
+				}
+				if count != 0 {
+					t.Errorf("%d rows left in %s", count, table)
+				}
+			}
+			if _, err := m.Get(boost.ID); err == nil {
+				t.Errorf("boost of the deleted note is left")
+			}
+		})
+	}
+}
+
+func TestListPage(t *testing.T) {
+	m := NewNoteModel(newTestDB(t))
+	for i := 0; i < 10; i++ {
+		createNote(t, m, Note{Content: fmt.Sprint(i)})
+	}
+
+	tests := []struct {
+		name          string
+		before, after int64
+		want          []int64
+	}{
+		{"newest", 0, 0, []int64{10, 9, 8}},
+		{"before", 8, 0, []int64{7, 6, 5}},
+		{"before the oldest", 2, 0, []int64{1}},
+		{"after", 0, 5, []int64{8, 7, 6}},
+		{"after the newest", 0, 10, []int64{}},
+		{"between", 9, 6, []int64{8, 7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notes, err := m.ListRecent(3, tt.before, tt.after)
+			if err != nil {
+				t.Fatalf("ListRecent: %v", err)
+			}
+			got := []int64{}
+			for _, note := range notes {
+				got = append(got, note.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ListRecent(3, %d, %d) = %v, want %v", tt.before, tt.after, got, tt.want)
+			}
+		})
+	}
+}
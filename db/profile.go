@@ -6,6 +6,14 @@ type Profile struct {
 	AvatarURL    string `db:"avatar_url" json:"avatar_url"`
 	Bio          string `db:"bio" json:"bio"`
 	PasswordHash string `db:"password_hash" json:"-"`
+	HideNetwork  bool   `db:"hide_network" json:"hide_network"`
+	// TOTPSecret is the base32 TOTP secret. It is set while enrolling and
+	// only checked at login once TOTPEnabled is set.
+	TOTPSecret  string `db:"totp_secret" json:"-"`
+	TOTPEnabled bool   `db:"totp_enabled" json:"-"`
+	// TOTPLastStep is the time step of the last code accepted, so that a
+	// code cannot be used twice.
+	TOTPLastStep int64 `db:"totp_last_step" json:"-"`
 }
 
 type ProfileModel struct {
@@ -27,7 +35,7 @@ func (m *ProfileModel) Create(profile *Profile) error {
 
 func (m *ProfileModel) Get() (*Profile, error) {
 	var profile Profile
-	query := `SELECT finger, display_name, avatar_url, bio, password_hash FROM profile LIMIT 1`
+	query := `SELECT finger, display_name, avatar_url, bio, password_hash, hide_network, totp_secret, totp_enabled, totp_last_step FROM profile LIMIT 1`
 	err := m.DB.Get(&profile, query)
 	return &profile, err
 }
@@ -37,13 +45,55 @@ func (m *ProfileModel) Update(profile *Profile) error {
         UPDATE profile
         SET display_name = :display_name,
             avatar_url = :avatar_url,
-            bio = :bio
+            bio = :bio,
+            hide_network = :hide_network
         WHERE finger = :finger
     `
 	_, err := m.DB.NamedExec(query, profile)
 	return err
 }
 
+// UpdatePassword replaces the password hash of the profile.
+func (m *ProfileModel) UpdatePassword(finger, passwordHash string) error {
+	query := `UPDATE profile SET password_hash = ? WHERE finger = ?`
+	_, err := m.DB.Exec(query, passwordHash, finger)
+	return err
+}
+
+// SetTOTPSecret starts TOTP enrollment with a new secret. TOTP stays off
+// until EnableTOTP is called.
+func (m *ProfileModel) SetTOTPSecret(finger, secret string) error {
+	query := `UPDATE profile SET totp_secret = ?, totp_enabled = 0, totp_last_step = 0 WHERE finger = ?`
+	_, err := m.DB.Exec(query, secret, finger)
+	return err
+}
+
+// EnableTOTP turns TOTP on with the secret set by SetTOTPSecret.
+func (m *ProfileModel) EnableTOTP(finger string) error {
+	query := `UPDATE profile SET totp_enabled = 1 WHERE finger = ? AND totp_secret != ''`
+	_, err := m.DB.Exec(query, finger)
+	return err
+}
+
+// DisableTOTP turns TOTP off and forgets the secret.
+func (m *ProfileModel) DisableTOTP(finger string) error {
+	query := `UPDATE profile SET totp_secret = '', totp_enabled = 0, totp_last_step = 0 WHERE finger = ?`
+	_, err := m.DB.Exec(query, finger)
+	return err
+}
+
+// UseTOTPStep records step as used. It reports false when step is not newer
+// than the last one used, that is when the code was already used.
+func (m *ProfileModel) UseTOTPStep(finger string, step int64) (bool, error) {
+	query := `UPDATE profile SET totp_last_step = ? WHERE finger = ? AND totp_last_step < ?`
+	result, err := m.DB.Exec(query, step, finger, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
 func (m *ProfileModel) CountProfiles() (int, error) {
 	var count int
 	query := `SELECT COUNT(*) FROM profile`
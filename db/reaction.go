@@ -0,0 +1,168 @@
+package db
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// NoteLike is a like the owner gave to a note.
+type NoteLike struct {
+	NoteID     int64     `db:"note_id" json:"note_id"`
+	ActivityID string    `db:"activity_id" json:"activity_id"`
+	CreateTime time.Time `db:"create_time" json:"create_time"`
+}
+
+// AddLike records a like of the owner. It fails when the note is already
+// liked.
+func (m *NoteModel) AddLike(like *NoteLike) error {
+	tx, err := m.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error
+
+	query := "INSERT INTO note_likes (note_id, activity_id) VALUES (?, ?)"
+	if _, err := tx.Exec(query, like.NoteID, like.ActivityID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE notes SET likes = likes + 1 WHERE id = ?", like.NoteID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetLike returns the like of the owner on a note.
+func (m *NoteModel) GetLike(noteID int64) (*NoteLike, error) {
+	var like NoteLike
+	query := "SELECT note_id, activity_id, create_time FROM note_likes WHERE note_id = ?"
+	if err := m.DB.Get(&like, query, noteID); err != nil {
+		return nil, err
+	}
+	return &like, nil
+}
+
+// RemoveLike forgets the like of the owner on a note.
+func (m *NoteModel) RemoveLike(noteID int64) error {
+	tx, err := m.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error
+
+	result, err := tx.Exec("DELETE FROM note_likes WHERE note_id = ?", noteID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		if _, err := tx.Exec("UPDATE notes SET likes = MAX(0, likes - 1) WHERE id = ?", noteID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CreateBoost stores a boost of the owner. The boost is a local note with
+// BoostOf set and no content.
+func (m *NoteModel) CreateBoost(boost *Note, baseURL string) error {
+	if err := m.CreateLocalNote(boost, baseURL); err != nil {
+		return err
+	}
+	return m.IncrementShares(boost.BoostOf)
+}
+
+// GetBoost returns the boost of the owner of a note.
+func (m *NoteModel) GetBoost(noteID int64) (*Note, error) {
+	query := "SELECT " + noteColumns + " FROM notes WHERE boost_of = ? AND author_uri = ''"
+	return m.getOne(query, noteID)
+}
+
+// DeleteBoost removes a boost of the owner.
+func (m *NoteModel) DeleteBoost(boost *Note) error {
+	if err := m.Delete(boost.ID); err != nil {
+		return err
+	}
+	return m.DecrementShares(boost.BoostOf)
+}
+
+// loadReactions fills in whether the owner liked or boosted the given
+// notes.
+func (m *NoteModel) loadReactions(notes []Note) error {
+	if len(notes) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(notes))
+	for _, note := range notes {
+		ids = append(ids, note.ID)
+	}
+
+	query, args, err := sqlx.In(`
+		SELECT note_id, 'like' AS kind FROM note_likes WHERE note_id IN (?)
+		UNION ALL
+		SELECT boost_of, 'boost' FROM notes WHERE boost_of IN (?) AND author_uri = ''
+	`, ids, ids)
+	if err != nil {
+		return err
+	}
+
+	var rows []struct {
+		NoteID int64  `db:"note_id"`
+		Kind   string `db:"kind"`
+	}
+	if err := m.DB.Select(&rows, query, args...); err != nil {
+		return err
+	}
+
+	liked := make(map[int64]bool)
+	boosted := make(map[int64]bool)
+	for _, row := range rows {
+		if row.Kind == "like" {
+			liked[row.NoteID] = true
+		} else {
+			boosted[row.NoteID] = true
+		}
+	}
+	for i := range notes {
+		notes[i].Liked = liked[notes[i].ID]
+		notes[i].Boosted = boosted[notes[i].ID]
+	}
+	return nil
+}
+
+// loadBoosts fills in the Boost of the boosts among the given notes.
+func (m *NoteModel) loadBoosts(notes []Note) error {
+	var ids []int64
+	for _, note := range notes {
+		if note.BoostOf != 0 {
+			ids = append(ids, note.BoostOf)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query, args, err := sqlx.In("SELECT "+noteColumns+" FROM notes WHERE id IN (?)", ids)
+	if err != nil {
+		return err
+	}
+	boosted := []Note{}
+	if err := m.DB.Select(&boosted, query, args...); err != nil {
+		return err
+	}
+	// Boosts of boosts are not created, so this does not recurse further.
+	if err := m.loadDetails(boosted); err != nil {
+		return err
+	}
+
+	byID := make(map[int64]*Note, len(boosted))
+	for i := range boosted {
+		byID[boosted[i].ID] = &boosted[i]
+	}
+	for i := range notes {
+		if notes[i].BoostOf != 0 {
+			notes[i].Boost = byID[notes[i].BoostOf]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package db
+
+import "time"
+
+// RecoveryCodeModel stores the one-time codes that stand in for a TOTP
+// code when the authenticator is lost. Only hashes of the codes are kept.
+type RecoveryCodeModel struct {
+	DB *DB
+}
+
+func NewRecoveryCodeModel(db *DB) *RecoveryCodeModel {
+	return &RecoveryCodeModel{DB: db}
+}
+
+// Replace forgets every recovery code and stores the given ones.
+func (m *RecoveryCodeModel) Replace(codeHashes []string) error {
+	tx, err := m.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes"); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec("INSERT INTO recovery_codes (code_hash) VALUES (?)", hash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Use marks an unused code as used. It reports whether there was one.
+func (m *RecoveryCodeModel) Use(codeHash string) (bool, error) {
+	query := "UPDATE recovery_codes SET used_at = ? WHERE code_hash = ? AND used_at IS NULL"
+	result, err := m.DB.Exec(query, time.Now().UTC(), codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// CountUnused returns the number of codes left.
+func (m *RecoveryCodeModel) CountUnused() (int, error) {
+	var count int
+	err := m.DB.Get(&count, "SELECT COUNT(*) FROM recovery_codes WHERE used_at IS NULL")
+	return count, err
+}
+
+// DeleteAll forgets every recovery code.
+func (m *RecoveryCodeModel) DeleteAll() error {
+	_, err := m.DB.Exec("DELETE FROM recovery_codes")
+	return err
+}
@@ -0,0 +1,114 @@
+package db
+
+import "time"
+
+// Session is a login of the owner on one device. Only a hash of its token
+// is stored, so a leaked database does not hand out logins.
+type Session struct {
+	ID         int64     `db:"id" json:"id"`
+	TokenHash  string    `db:"token_hash" json:"-"`
+	UserAgent  string    `db:"user_agent" json:"user_agent"`
+	IP         string    `db:"ip" json:"ip"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	LastSeenAt time.Time `db:"last_seen_at" json:"last_seen_at"`
+	ExpiresAt  time.Time `db:"expires_at" json:"expires_at"`
+	// Pending is set while the session waits for the second factor. It
+	// does not count as logged in.
+	Pending bool `db:"pending" json:"-"`
+}
+
+type SessionModel struct {
+	DB *DB
+}
+
+func NewSessionModel(db *DB) *SessionModel {
+	return &SessionModel{DB: db}
+}
+
+const sessionColumns = "id, token_hash, user_agent, ip, created_at, last_seen_at, expires_at, pending"
+
+// Create stores a new session that expires after lifetime.
+func (m *SessionModel) Create(session *Session, lifetime time.Duration) error {
+	now := time.Now().UTC()
+	session.CreatedAt = now
+	session.LastSeenAt = now
+	session.ExpiresAt = now.Add(lifetime)
+
+	query := `
+		INSERT INTO sessions (token_hash, user_agent, ip, created_at, last_seen_at, expires_at, pending)
+		VALUES (:token_hash, :user_agent, :ip, :created_at, :last_seen_at, :expires_at, :pending)
+	`
+	result, err := m.DB.NamedExec(query, session)
+	if err != nil {
+		return err
+	}
+	session.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetByTokenHash returns the unexpired session with the given token hash.
+func (m *SessionModel) GetByTokenHash(tokenHash string) (*Session, error) {
+	var session Session
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE token_hash = ? AND expires_at > ?"
+	if err := m.DB.Get(&session, query, tokenHash, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Touch records that the session was just used and pushes its expiry
+// lifetime into the future.
+func (m *SessionModel) Touch(session *Session, lifetime time.Duration) error {
+	now := time.Now().UTC()
+	query := "UPDATE sessions SET last_seen_at = ?, expires_at = ? WHERE id = ?"
+	if _, err := m.DB.Exec(query, now, now.Add(lifetime), session.ID); err != nil {
+		return err
+	}
+	session.LastSeenAt = now
+	session.ExpiresAt = now.Add(lifetime)
+	return nil
+}
+
+// Complete marks a pending session as logged in and lets it last lifetime.
+func (m *SessionModel) Complete(session *Session, lifetime time.Duration) error {
+	now := time.Now().UTC()
+	query := "UPDATE sessions SET pending = 0, last_seen_at = ?, expires_at = ? WHERE id = ?"
+	if _, err := m.DB.Exec(query, now, now.Add(lifetime), session.ID); err != nil {
+		return err
+	}
+	session.Pending = false
+	session.LastSeenAt = now
+	session.ExpiresAt = now.Add(lifetime)
+	return nil
+}
+
+// ListActive returns the unexpired sessions that are logged in, most
+// recently used first.
+func (m *SessionModel) ListActive() ([]Session, error) {
+	sessions := []Session{}
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE expires_at > ? AND pending = 0 ORDER BY last_seen_at DESC"
+	err := m.DB.Select(&sessions, query, time.Now().UTC())
+	return sessions, err
+}
+
+// Delete revokes a session. It reports whether there was one.
+func (m *SessionModel) Delete(id int64) (bool, error) {
+	result, err := m.DB.Exec("DELETE FROM sessions WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteAll revokes every session, logging out all devices.
+func (m *SessionModel) DeleteAll() error {
+	_, err := m.DB.Exec("DELETE FROM sessions")
+	return err
+}
+
+// DeleteExpired forgets the sessions that have run out.
+func (m *SessionModel) DeleteExpired() error {
+	_, err := m.DB.Exec("DELETE FROM sessions WHERE expires_at <= ?", time.Now().UTC())
+	return err
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+// TagCount is a tag and the number of notes carrying it.
+type TagCount struct {
+	Name  string `db:"name" json:"name"`
+	Count int    `db:"count" json:"count"`
+}
+
+// SetTags replaces the tags of a note. Names are expected to be normalized
+// already.
+func (m *NoteModel) SetTags(noteID int64, names []string) error {
+	tx, err := m.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error
+
+	if _, err := tx.Exec("DELETE FROM note_tags WHERE note_id = ?", noteID); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO tags (name) VALUES (?)", name); err != nil {
+			return err
+		}
+		query := "INSERT OR IGNORE INTO note_tags (note_id, tag_id) SELECT ?, id FROM tags WHERE name = ?"
+		if _, err := tx.Exec(query, noteID, name); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// loadTags fills in the Tags of the given notes.
+func (m *NoteModel) loadTags(notes []Note) error {
+	if len(notes) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(notes))
+	for _, note := range notes {
+		ids = append(ids, note.ID)
+	}
+
+	query, args, err := sqlx.In(`
+		SELECT nt.note_id, t.name FROM note_tags nt
+		JOIN tags t ON t.id = nt.tag_id
+		WHERE nt.note_id IN (?)
+		ORDER BY t.name
+	`, ids)
+	if err != nil {
+		return err
+	}
+
+	var rows []struct {
+		NoteID int64  `db:"note_id"`
+		Name   string `db:"name"`
+	}
+	if err := m.DB.Select(&rows, query, args...); err != nil {
+		return err
+	}
+
+	byNote := make(map[int64][]string)
+	for _, row := range rows {
+		byNote[row.NoteID] = append(byNote[row.NoteID], row.Name)
+	}
+	for i := range notes {
+		notes[i].Tags = byNote[notes[i].ID]
+	}
+	return nil
+}
+
+// ListByTag returns the notes tagged name that viewer may see.
+func (m *NoteModel) ListByTag(name string, viewer NoteViewer, limit int, before, after int64) ([]Note, error) {
+	visible, args := viewer.visibleWhere()
+	where := "id IN (SELECT nt.note_id FROM note_tags nt JOIN tags t ON t.id = nt.tag_id WHERE t.name = ?) AND " + visible
+	return m.listPage(where, append([]interface{}{name}, args...), limit, before, after)
+}
+
+// CountMyPublicByTag returns the number of local public notes tagged name.
+func (m *NoteModel) CountMyPublicByTag(name string) (int, error) {
+	var count int
+	query := `
+		SELECT COUNT(*) FROM notes
+		JOIN note_tags nt ON nt.note_id = notes.id
+		JOIN tags t ON t.id = nt.tag_id
+		WHERE t.name = ? AND notes.author_uri = '' AND notes.public_range = ?
+	`
+	err := m.DB.Get(&count, query, name, NotePublicRangePublic)
+	return count, err
+}
+
+// ListMyPublicByTag returns local public notes tagged name, newest first.
+func (m *NoteModel) ListMyPublicByTag(name string, limit, offset int) ([]Note, error) {
+	notes := []Note{}
+	query := `
+		SELECT ` + qualifiedNoteColumns() + ` FROM notes
+		JOIN note_tags nt ON nt.note_id = notes.id
+		JOIN tags t ON t.id = nt.tag_id
+		WHERE t.name = ? AND notes.author_uri = '' AND notes.public_range = ?
+		ORDER BY notes.id DESC LIMIT ? OFFSET ?
+	`
+	if err := m.DB.Select(&notes, query, name, NotePublicRangePublic, limit, offset); err != nil {
+		return nil, err
+	}
+	err := m.loadDetails(notes)
+	return notes, err
+}
+
+// ListTags returns the tags of the notes viewer may see, most used first.
+func (m *NoteModel) ListTags(viewer NoteViewer) ([]TagCount, error) {
+	tags := []TagCount{}
+	visible, args := viewer.visibleWhere()
+	query := `
+		SELECT t.name, COUNT(*) AS count FROM tags t
+		JOIN note_tags nt ON nt.tag_id = t.id
+		WHERE nt.note_id IN (SELECT id FROM notes WHERE ` + visible + `)
+		GROUP BY t.id ORDER BY count DESC, t.name ASC
+	`
+	err := m.DB.Select(&tags, query, args...)
+	return tags, err
+}
@@ -0,0 +1,84 @@
+package db
+
+// maxThreadDepth is how many replies up or down a thread is followed.
+const maxThreadDepth = 64
+
+// maxThreadDescendants is the most replies returned for a thread.
+const maxThreadDescendants = 500
+
+// ListAncestors returns the notes note replies to that viewer may see,
+// starting from the top of the thread.
+func (m *NoteModel) ListAncestors(note *Note, viewer NoteViewer) ([]Note, error) {
+	notes := []Note{}
+	visible, args := viewer.visibleWhere()
+	query := `
+		WITH RECURSIVE ancestors(uri, in_reply_to, depth) AS (
+			SELECT uri, in_reply_to, 0 FROM notes WHERE id = ?
+			UNION ALL
+			SELECT n.uri, n.in_reply_to, a.depth + 1 FROM notes n
+			JOIN ancestors a ON n.uri = a.in_reply_to
+			WHERE a.in_reply_to != '' AND a.depth < ?
+		)
+		SELECT ` + qualifiedNoteColumns() + ` FROM ancestors a
+		JOIN notes ON notes.uri = a.uri
+		WHERE a.depth > 0 AND ` + visible + `
+		ORDER BY a.depth DESC
+	`
+	args = append([]interface{}{note.ID, maxThreadDepth}, args...)
+	if err := m.DB.Select(&notes, query, args...); err != nil {
+		return nil, err
+	}
+	err := m.loadDetails(notes)
+	return notes, err
+}
+
+// ListDescendants returns the replies to note, and the replies to those,
+// that viewer may see, oldest first.
+func (m *NoteModel) ListDescendants(note *Note, viewer NoteViewer) ([]Note, error) {
+	notes := []Note{}
+	visible, args := viewer.visibleWhere()
+	query := `
+		WITH RECURSIVE descendants(uri, depth) AS (
+			SELECT uri, 0 FROM notes WHERE id = ?
+			UNION
+			SELECT n.uri, d.depth + 1 FROM notes n
+			JOIN descendants d ON n.in_reply_to = d.uri
+			WHERE d.depth < ?
+		)
+		SELECT DISTINCT ` + qualifiedNoteColumns() + ` FROM descendants d
+		JOIN notes ON notes.uri = d.uri
+		WHERE d.depth > 0 AND ` + visible + `
+		ORDER BY notes.id ASC LIMIT ?
+	`
+	args = append([]interface{}{note.ID, maxThreadDepth}, args...)
+	args = append(args, maxThreadDescendants)
+	if err := m.DB.Select(&notes, query, args...); err != nil {
+		return nil, err
+	}
+	err := m.loadDetails(notes)
+	return notes, err
+}
+
+// CountReplies returns the number of direct replies to uri that viewer may
+// see.
+func (m *NoteModel) CountReplies(uri string, viewer NoteViewer) (int, error) {
+	var count int
+	visible, args := viewer.visibleWhere()
+	query := "SELECT COUNT(*) FROM notes WHERE in_reply_to = ? AND " + visible
+	err := m.DB.Get(&count, query, append([]interface{}{uri}, args...)...)
+	return count, err
+}
+
+// ListReplies returns the direct replies to uri that viewer may see, oldest
+// first.
+func (m *NoteModel) ListReplies(uri string, viewer NoteViewer, limit, offset int) ([]Note, error) {
+	notes := []Note{}
+	visible, args := viewer.visibleWhere()
+	query := "SELECT " + noteColumns + " FROM notes WHERE in_reply_to = ? AND " + visible + " ORDER BY id ASC LIMIT ? OFFSET ?"
+	args = append([]interface{}{uri}, args...)
+	if err := m.DB.Select(&notes, query, append(args, limit, offset)...); err != nil {
+		return nil, err
+	}
+	err := m.loadDetails(notes)
+	return notes, err
+}
@@ -0,0 +1,58 @@
+package db
+
+// NoteViewer is who notes are being shown to. The zero value is an
+// anonymous visitor.
+type NoteViewer struct {
+	// Owner is set for the logged-in owner of the instance.
+	Owner bool
+	// Follower is set for a remote actor that follows us and identified
+	// itself with a signed fetch.
+	Follower bool
+	// Actor is the remote actor that identified itself with a signed
+	// fetch, if any. It may see our notes that mention it.
+	Actor string
+}
+
+// IsLocal reports whether the note was written on this instance.
+func (n *Note) IsLocal() bool {
+	return n.AuthorURI == ""
+}
+
+// VisibleTo reports whether the note may be shown to viewer. Public and
+// unlisted notes are visible to everyone, followers-only notes of ours to
+// our followers, notes of ours to the actors they mention, and everything
+// to the owner. Mentions must be loaded.
+func (n *Note) VisibleTo(viewer NoteViewer) bool {
+	if viewer.Owner {
+		return true
+	}
+	if viewer.Actor != "" && n.IsLocal() && n.MentionsActor(viewer.Actor) {
+		return true
+	}
+	switch n.PublicRange {
+	case NotePublicRangePublic, NotePublicRangeUnlisted:
+		return true
+	case NotePublicRangeFollowers:
+		return viewer.Follower && n.IsLocal()
+	}
+	return false
+}
+
+// visibleWhere returns the SQL condition selecting the notes VisibleTo
+// viewer.
+func (viewer NoteViewer) visibleWhere() (string, []interface{}) {
+	if viewer.Owner {
+		return "1 = 1", nil
+	}
+	where := "public_range IN (?, ?)"
+	args := []interface{}{NotePublicRangePublic, NotePublicRangeUnlisted}
+	if viewer.Follower {
+		where += " OR (public_range = ? AND author_uri = '')"
+		args = append(args, NotePublicRangeFollowers)
+	}
+	if viewer.Actor != "" {
+		where += " OR (author_uri = '' AND id IN (SELECT note_id FROM note_mentions WHERE actor_uri = ?))"
+		args = append(args, viewer.Actor)
+	}
+	return "(" + where + ")", args
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNoteVisibility(t *testing.T) {
+	const mentioned = "https://remote.example/users/bob"
+
+	db := newTestDB(t)
+	m := NewNoteModel(db)
+
+	// Notes by name: local ones, remote ones and a direct message to bob.
+	notes := map[string]*Note{}
+	for name, note := range map[string]Note{
+		"public":           {PublicRange: NotePublicRangePublic},
+		"unlisted":         {PublicRange: NotePublicRangeUnlisted},
+		"followers":        {PublicRange: NotePublicRangeFollowers},
+		"private":          {PublicRange: NotePublicRangePrivate},
+		"direct":           {PublicRange: NotePublicRangePrivate},
+		"remote public":    {PublicRange: NotePublicRangePublic, AuthorURI: "https://remote.example/users/carol"},
+		"remote followers": {PublicRange: NotePublicRangeFollowers, AuthorURI: "https://remote.example/users/carol"},
+		"remote direct":    {PublicRange: NotePublicRangePrivate, AuthorURI: "https://remote.example/users/carol"},
+	} {
+		note.Content = name
+		note.Host = "example.com"
+		note.AuthorFinger = "alice"
+		if note.AuthorURI == "" {
+			if err := m.CreateLocalNote(&note, "https://example.com"); err != nil {
+				t.Fatalf("CreateLocalNote: %v", err)
+			}
+		} else {
+			note.URI = note.AuthorURI + "/" + name
+			if err := m.CreateFederatedNote(&note); err != nil {
+				t.Fatalf("CreateFederatedNote: %v", err)
+			}
+		}
+		notes[name] = &note
+	}
+	for _, name := range []string{"direct", "remote direct"} {
+		if err := m.SetMentions(notes[name].ID, []NoteMention{{ActorURI: mentioned}}); err != nil {
+			t.Fatalf("SetMentions: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		viewer NoteViewer
+		want   []string
+	}{
+		{"anonymous", NoteViewer{}, []string{"public", "remote public", "unlisted"}},
+		{"follower", NoteViewer{Follower: true}, []string{"followers", "public", "remote public", "unlisted"}},
+		{"mentioned actor", NoteViewer{Actor: mentioned}, []string{"direct", "public", "remote public", "unlisted"}},
+		{"other actor", NoteViewer{Actor: "https://remote.example/users/dave"}, []string{"public", "remote public", "unlisted"}},
+		{"owner", NoteViewer{Owner: true}, []string{"direct", "followers", "private", "public", "remote direct", "remote followers", "remote public", "unlisted"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args := tt.viewer.visibleWhere()
+			listed, err := m.listPage(where, args, 100, 0, 0)
+			if err != nil {
+				t.Fatalf("listPage: %v", err)
+			}
+			var got []string
+			for _, note := range listed {
+				got = append(got, note.Content)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("visibleWhere selects %v, want %v", got, tt.want)
+			}
+
+			// VisibleTo must agree with the SQL condition.
+			for name := range notes {
+				note, err := m.Get(notes[name].ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if visible := note.VisibleTo(tt.viewer); visible != slices.Contains(tt.want, name) {
+					t.Errorf("VisibleTo(%s) = %v, want %v", name, visible, !visible)
+				}
+			}
+		})
+	}
+}
@@ -8,29 +8,80 @@ document.addEventListener('DOMContentLoaded', () => {
         3: 'Public'
     };
 
-    fetchNotes();
+    const tabs = document.getElementById('timeline-tabs');
+    let currentTimeline = 'public';
 
-    async function fetchNotes() {
+    init();
+
+    async function init() {
+        if (await fetchLogined()) {
+            currentTimeline = 'home';
+            tabs.querySelector('[data-timeline="home"]').classList.remove('hidden');
+        }
+        selectTab(currentTimeline);
+        fetchNotes(null);
+    }
+
+    async function fetchLogined() {
+        try {
+            const resp = await fetch(`/api/auth/status`);
+            if (!resp.ok) {
+                return false;
+            }
+
+            const data = await resp.json();
+            return data.logged_in;
+        } catch(e) {
+            return false;
+        }
+    }
+
+    function selectTab(name) {
+        tabs.querySelectorAll('button').forEach(button => {
+            button.classList.toggle('active', button.dataset.timeline === name);
+        });
+    }
+
+    tabs.addEventListener('click', (e) => {
+        const name = e.target.dataset.timeline;
+        if (!name || name === currentTimeline) {
+            return;
+        }
+        currentTimeline = name;
+        selectTab(name);
+        fetchNotes(null);
+    });
+
+    const loadMoreButton = document.getElementById('load-more');
+    let nextPageURL = null;
+
+    loadMoreButton.addEventListener('click', () => fetchNotes(nextPageURL));
+
+    async function fetchNotes(url) {
         try {
-            const response = await fetch('/api/notes');
+            const response = await fetch(url || `/api/timeline/${currentTimeline}`);
             if (!response.ok) {
                 throw new Error('Could not fetch notes');
             }
             const notes = await response.json();
-            renderNotes(notes);
+            nextPageURL = NoteRenderer.getNextPageURL(response);
+            loadMoreButton.classList.toggle('hidden', !nextPageURL);
+            renderNotes(notes, !!url);
         } catch (error) {
             timeline.innerHTML = `<p class='error-message'>Error fetching timeline: ${error.message}</p>`;
             console.error('Failed to fetch notes:', error);
         }
     }
 
-    function renderNotes(notes) {
-        if (!notes || notes.length === 0) {
+    function renderNotes(notes, append) {
+        if (!append && (!notes || notes.length === 0)) {
             timeline.innerHTML = '<p>No notes yet.</p>';
             return;
         }
 
-        timeline.innerHTML = '';
+        if (!append) {
+            timeline.innerHTML = '';
+        }
         notes.forEach(note => {
             const noteElement = NoteRenderer.createNoteElement(note);
             timeline.appendChild(noteElement);
@@ -59,7 +110,7 @@ document.addEventListener('DOMContentLoaded', () => {
                 const errorData = await response.json();
                 throw new Error(errorData.description || 'Failed to delete note');
             }
-            fetchNotes();
+            fetchNotes(null);
         } catch (error) {
             alert(`Error deleting note: ${error.message}`);
             console.error('Failed to delete note:', error);
@@ -15,29 +15,38 @@ document.addEventListener('DOMContentLoaded', () => {
 
     categoryTitle.textContent = `Category: ${categoryName}`;
 
-    fetchCategoryNotes(categoryName);
+    const loadMoreButton = document.getElementById('load-more');
+    let nextPageURL = null;
 
-    async function fetchCategoryNotes(name) {
+    loadMoreButton.addEventListener('click', () => fetchCategoryNotes(categoryName, nextPageURL));
+
+    fetchCategoryNotes(categoryName, null);
+
+    async function fetchCategoryNotes(name, url) {
         try {
-            const response = await fetch(`/api/category/${encodeURIComponent(name)}`);
+            const response = await fetch(url || `/api/category/${encodeURIComponent(name)}`);
             if (!response.ok) {
                 throw new Error('Could not fetch notes for this category');
             }
             const notes = await response.json();
-            renderNotes(notes);
+            nextPageURL = NoteRenderer.getNextPageURL(response);
+            loadMoreButton.classList.toggle('hidden', !nextPageURL);
+            renderNotes(notes, !!url);
         } catch (error) {
             timeline.innerHTML = `<p class='error-message'>Error fetching timeline: ${error.message}</p>`;
             console.error('Failed to fetch notes:', error);
         }
     }
 
-    function renderNotes(notes) {
-        if (!notes || notes.length === 0) {
+    function renderNotes(notes, append) {
+        if (!append && (!notes || notes.length === 0)) {
             timeline.innerHTML = '<p>No notes found in this category.</p>';
             return;
         }
 
-        timeline.innerHTML = '';
+        if (!append) {
+            timeline.innerHTML = '';
+        }
         notes.forEach(note => {
             const noteElement = NoteRenderer.createNoteElement(note);
             timeline.appendChild(noteElement);
@@ -0,0 +1,29 @@
+// csrf.js
+//
+// Sends the CSRF token with every request that changes something. The
+// server sets it in the csrf_token cookie and expects it back in the
+// X-CSRF-Token header. Load this before any script that calls fetch.
+
+(function () {
+    const safeMethods = ['GET', 'HEAD', 'OPTIONS'];
+
+    function csrfToken() {
+        const match = document.cookie.split(';')
+            .map(part => part.trim())
+            .find(part => part.startsWith('csrf_token='));
+        return match ? decodeURIComponent(match.substring('csrf_token='.length)) : '';
+    }
+
+    const originalFetch = window.fetch.bind(window);
+    window.fetch = (input, init = {}) => {
+        const method = (init.method || (input instanceof Request ? input.method : 'GET')).toUpperCase();
+        const url = new URL(input instanceof Request ? input.url : input, window.location.href);
+        const token = csrfToken();
+        if (!safeMethods.includes(method) && url.origin === window.location.origin && token) {
+            const headers = new Headers(init.headers || (input instanceof Request ? input.headers : undefined));
+            headers.set('X-CSRF-Token', token);
+            init = { ...init, headers };
+        }
+        return originalFetch(input, init);
+    };
+})();
@@ -1,5 +1,6 @@
 document.addEventListener("DOMContentLoaded", () => {
     const loginForm = document.getElementById("login-form");
+    const totpForm = document.getElementById("totp-form");
     const logoutButton = document.getElementById("logout-button");
 
     // Check login status
@@ -33,6 +34,35 @@ document.addEventListener("DOMContentLoaded", () => {
                 if (!response.ok) throw new Error("Login failed");
                 return response.json();
             })
+            .then((data) => {
+                // With two-factor authentication on, ask for the code next.
+                if (data.totp_required) {
+                    loginForm.style.display = "none";
+                    totpForm.style.display = "block";
+                    document.getElementById("totp-code").focus();
+                    return;
+                }
+                alert("Login successful!");
+                window.location.href = "/";
+            })
+            .catch((error) => alert(error.message));
+    });
+
+    // Handle the second login step
+    totpForm.addEventListener("submit", (e) => {
+        e.preventDefault();
+        const code = document.getElementById("totp-code").value;
+
+        fetch("/api/login/totp", {
+            method: "POST",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify({ code }),
+            credentials: "include",
+        })
+            .then((response) => {
+                if (!response.ok) throw new Error("Invalid authentication code");
+                return response.json();
+            })
             .then(() => {
                 alert("Login successful!");
                 window.location.href = "/";
@@ -8,6 +8,115 @@ document.addEventListener("DOMContentLoaded", () => {
 
     let currentDraftId = null;
 
+    // Uploaded media to attach to the note, each with its alt text.
+    const mediaField = document.getElementById("media-file");
+    const attachmentList = document.getElementById("attachment-list");
+    let attachments = [];
+
+    const renderAttachments = () => {
+        attachmentList.innerHTML = "";
+        attachments.forEach((media, index) => {
+            const item = document.createElement("div");
+            item.className = "attachment-item";
+
+            const preview = document.createElement("img");
+            preview.src = media.thumbnail_url;
+            preview.alt = "";
+
+            const altField = document.createElement("input");
+            altField.type = "text";
+            altField.placeholder = "Describe this image";
+            altField.value = media.description || "";
+            altField.addEventListener("input", () => {
+                media.description = altField.value;
+            });
+
+            const removeButton = document.createElement("button");
+            removeButton.type = "button";
+            removeButton.textContent = "Remove";
+            removeButton.addEventListener("click", () => {
+                attachments.splice(index, 1);
+                renderAttachments();
+            });
+
+            item.append(preview, altField, removeButton);
+            attachmentList.appendChild(item);
+        });
+    };
+
+    mediaField.addEventListener("change", async () => {
+        const file = mediaField.files[0];
+        if (!file) return;
+
+        const formData = new FormData();
+        formData.append("file", file);
+
+        try {
+            const response = await fetch("/api/media", {
+                method: "POST",
+                body: formData,
+            });
+            if (!response.ok) {
+                const error = await response.json();
+                throw new Error(error.description || "Failed to upload image.");
+            }
+            attachments.push(await response.json());
+            renderAttachments();
+        } catch (err) {
+            formError.textContent = err.message;
+            formError.style.color = "red";
+            console.error("Failed to upload media:", err);
+        } finally {
+            mediaField.value = "";
+        }
+    });
+
+    // When editing a published note, the form is filled from its markdown source.
+    const editId = new URLSearchParams(window.location.search).get("edit");
+    // When replying, the note replied to is shown above the form.
+    const replyToId = new URLSearchParams(window.location.search).get("reply_to");
+
+    const loadReplyTarget = async (id) => {
+        try {
+            const response = await fetch(`/api/notes/${id}`);
+            if (!response.ok) {
+                throw new Error("Failed to load the note you are replying to.");
+            }
+            const note = await response.json();
+            const replyTarget = document.getElementById("reply-target");
+            replyTarget.appendChild(NoteRenderer.createNoteElement(note));
+            replyTarget.classList.remove("hidden");
+            if (note.author_finger.includes("@") && !contentField.value) {
+                contentField.value = `@${note.author_finger} `;
+            }
+            visibilityField.value = note.public_range || "3";
+        } catch (err) {
+            formError.textContent = err.message;
+            formError.style.color = "red";
+            console.error("Failed to load reply target:", err);
+        }
+    };
+
+    const loadNote = async (id) => {
+        try {
+            const response = await fetch(`/api/notes/${id}`);
+            if (!response.ok) {
+                throw new Error("Failed to load note.");
+            }
+            const note = await response.json();
+            contentField.value = note.source || "";
+            cwField.value = note.cw || "";
+            if (note.category) categoryField.value = note.category;
+            visibilityField.value = note.public_range || "3";
+            attachments = note.attachments || [];
+            renderAttachments();
+        } catch (err) {
+            formError.textContent = err.message;
+            formError.style.color = "red";
+            console.error("Failed to load note:", err);
+        }
+    };
+
     // Load draft from the server
     const loadDraft = async () => {
         try {
@@ -95,22 +204,33 @@ document.addEventListener("DOMContentLoaded", () => {
             cw: cwField.value,
             category: categoryField.value,
             public_range: visibilityField.value,
+            attachments: attachments.map(media => ({ id: media.id, description: media.description || "" })),
         };
+        if (replyToId) {
+            noteData.in_reply_to_id = parseInt(replyToId, 10);
+        }
 
         try {
-            const response = await fetch("/api/notes", {
-                method: "POST",
+            const response = await fetch(editId ? `/api/notes/${editId}` : "/api/notes", {
+                method: editId ? "PUT" : "POST",
                 headers: {
                     "Content-Type": "application/json",
                 },
                 body: JSON.stringify(noteData),
             });
 
+            if (response.ok && (editId || replyToId)) {
+                window.location.href = `/notes/${editId || replyToId}`;
+                return;
+            }
+
             if (response.ok) {
                 await clearDraft();
                 formError.textContent = "Note posted successfully!";
                 formError.style.color = "green";
                 noteForm.reset();
+                attachments = [];
+                renderAttachments();
             } else {
                 const error = await response.json();
                 formError.textContent = error.message || "Failed to post note.";
@@ -123,6 +243,21 @@ document.addEventListener("DOMContentLoaded", () => {
         }
     });
 
+    if (editId) {
+        document.querySelector(".page-title h1").textContent = "Edit Post";
+        noteForm.querySelector("button[type=submit]").textContent = "Update";
+        saveDraftButton.style.display = "none";
+        loadNote(editId);
+        return;
+    }
+
+    if (replyToId) {
+        document.querySelector(".page-title h1").textContent = "Reply";
+        saveDraftButton.style.display = "none";
+        loadReplyTarget(replyToId);
+        return;
+    }
+
     // Attach event listener to save draft button
     saveDraftButton.addEventListener("click", saveDraft);
 
@@ -35,12 +35,35 @@ function toggleCW(button) {
 window.toggleCW = toggleCW;
 
 function createNoteElement(note) {
+    // A boost shows the boosted note under a line naming who boosted it.
+    if (note.boost) {
+        const boostedElement = createNoteElement(note.boost);
+        const boostHeader = document.createElement('div');
+        boostHeader.className = 'boost-header';
+        boostHeader.textContent = `Boosted by ${note.author_name}`;
+        boostedElement.prepend(boostHeader);
+        return boostedElement;
+    }
+
     const noteElement = document.createElement('div');
     noteElement.className = 'note';
     noteElement.dataset.noteId = note.id;
 
     const createTime = new Date(note.create_time).toLocaleString();
 
+    let attachmentsHTML = '';
+    if (note.attachments && note.attachments.length > 0) {
+        attachmentsHTML = `
+            <div class="note-attachments">
+                ${note.attachments.map(media => `
+                    <a href="${escapeHTML(media.url)}" target="_blank" rel="noopener">
+                        <img src="${escapeHTML(media.thumbnail_url)}" alt="${escapeHTML(media.description)}" title="${escapeHTML(media.description)}" loading="lazy">
+                    </a>
+                `).join('')}
+            </div>
+        `;
+    }
+
     let contentHTML = '';
     if (note.cw) {
         contentHTML = `
@@ -51,11 +74,12 @@ function createNoteElement(note) {
                 </div>
                 <div class="cw-content hidden">
                     <div class="note-content-inner"></div>
+                    ${attachmentsHTML}
                 </div>
             </div>
         `;
     } else {
-        contentHTML = `<div class="note-content-inner"></div>`;
+        contentHTML = `<div class="note-content-inner"></div>${attachmentsHTML}`;
     }
 
     noteElement.innerHTML = `
@@ -71,6 +95,7 @@ function createNoteElement(note) {
         </div>
         <div class='note-meta'>
             <a href='/notes/${note.id}' class='note-link-time'>Posted on ${createTime}</a>
+            ${note.update_time ? `<span class='edited'>(edited)</span>` : ''}
             ${note.category ? `<span> | Category: <a href="/category/${encodeURIComponent(note.category)}">${escapeHTML(note.category)}</a></span>` : ''}
             <br />
             <span class='public-range'>${publicRanges[note.public_range] || 'Unknown'}</span>
@@ -95,8 +120,23 @@ function createNoteElement(note) {
     return noteElement;
 }
 
+// Returns the URL of the next (older) page from a paginated API response,
+// or null when there are no more pages.
+function getNextPageURL(response) {
+    const link = response.headers.get('Link');
+    if (!link) {
+        return null;
+    }
+    const match = link.split(',').map(part => part.trim()).find(part => part.endsWith('rel="next"'));
+    if (!match) {
+        return null;
+    }
+    return match.substring(match.indexOf('<') + 1, match.indexOf('>'));
+}
+
 // Export functions if using modules, but for simple script tags:
 window.NoteRenderer = {
     createNoteElement,
-    escapeHTML
+    escapeHTML,
+    getNextPageURL
 };
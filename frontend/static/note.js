@@ -30,12 +30,35 @@ document.addEventListener('DOMContentLoaded', () => {
             })
             .then(note => {
                 renderNote(note);
+                fetchThread();
             })
             .catch(error => {
                 noteContainer.innerHTML = `<p class="error-message">${error.message}</p>`;
             });
     }
 
+    // Show the notes this one replies to above it and the replies below.
+    async function fetchThread() {
+        try {
+            const response = await fetch(`/api/notes/${noteId}/context`);
+            if (!response.ok) {
+                throw new Error('Failed to fetch thread. Status: ' + response.status);
+            }
+            const thread = await response.json();
+            renderThread(document.getElementById('thread-ancestors'), thread.ancestors);
+            renderThread(document.getElementById('thread-descendants'), thread.descendants);
+        } catch (error) {
+            console.error('Failed to fetch thread:', error);
+        }
+    }
+
+    function renderThread(container, notes) {
+        container.innerHTML = '';
+        (notes || []).forEach(note => {
+            container.appendChild(NoteRenderer.createNoteElement(note));
+        });
+    }
+
     async function fetchLogined() { 
         try {
             const resp = await fetch(`/api/auth/status`);
@@ -52,14 +75,21 @@ document.addEventListener('DOMContentLoaded', () => {
 
     async function renderNote(note) {
         const noteElement = NoteRenderer.createNoteElement(note);
+        // Likes and boosts of a boost apply to the note it boosts.
+        const target = note.boost || note;
+        const canBoost = target.public_range === '2' || target.public_range === '3';
         
         // Add action buttons specifically for the single note view
         const actionsDiv = noteElement.querySelector('.note-actions');
         const isLoggedIn = await fetchLogined();
         if (actionsDiv && isLoggedIn) {
             actionsDiv.innerHTML = `
+                <a class='reply-button' href='/new-note?reply_to=${target.id}'>Reply</a>
+                <button class='like-button' data-note-id='${target.id}' data-liked='${target.liked ? 1 : 0}'>${target.liked ? 'Unlike' : 'Like'}</button>
+                ${canBoost ? `<button class='boost-button' data-note-id='${target.id}' data-boosted='${target.boosted ? 1 : 0}'>${target.boosted ? 'Unboost' : 'Boost'}</button>` : ''}
                 <button class='bookmark-button' data-note-id='${note.id}'>Bookmark</button>
-                <button class='delete-button'>Delete</button>
+                ${note.source ? `<a class='edit-button' href='/new-note?edit=${note.id}'>Edit</a>` : ''}
+                ${note.boost ? '' : `<button class='delete-button'>Delete</button>`}
             `;
         }
 
@@ -76,8 +106,35 @@ document.addEventListener('DOMContentLoaded', () => {
         if (e.target.classList.contains('bookmark-button')) {
             bookmarkNote(noteId);
         }
+        if (e.target.classList.contains('like-button')) {
+            react('likes', e.target.dataset.noteId, e.target.dataset.liked === '1');
+        }
+        if (e.target.classList.contains('boost-button')) {
+            react('boosts', e.target.dataset.noteId, e.target.dataset.boosted === '1');
+        }
     });
 
+    // Likes or boosts a note, or undoes it, then shows the note again.
+    async function react(kind, id, undo) {
+        try {
+            const response = undo
+                ? await fetch(`/api/${kind}?note_id=${encodeURIComponent(id)}`, { method: 'DELETE' })
+                : await fetch(`/api/${kind}`, {
+                      method: 'POST',
+                      headers: { 'Content-Type': 'application/json' },
+                      body: JSON.stringify({ note_id: parseInt(id, 10) })
+                  });
+            if (!response.ok) {
+                const errorData = await response.json();
+                throw new Error(errorData.description || `Failed to update ${kind}`);
+            }
+            fetchNote();
+        } catch (error) {
+            alert(`Error: ${error.message}`);
+            console.error(`Failed to update ${kind}:`, error);
+        }
+    }
+
     async function deleteNote(id) {
         try {
             const response = await fetch(`/api/notes/${id}`, { method: 'DELETE' });
@@ -3,6 +3,7 @@ document.addEventListener('DOMContentLoaded', () => {
     const formMessage = document.getElementById('form-message');
     const nameInput = document.getElementById('name');
     const bioTextarea = document.getElementById('bio');
+    const hideNetworkCheckbox = document.getElementById('hide_network');
 
     // Fetch current profile data to pre-fill the form
     async function loadProfileForEdit() {
@@ -20,6 +21,7 @@ document.addEventListener('DOMContentLoaded', () => {
             const profile = await response.json();
             nameInput.value = profile.display_name || '';
             bioTextarea.value = profile.bio || '';
+            hideNetworkCheckbox.checked = !!profile.hide_network;
         } catch (error) {
             formMessage.textContent = `Error loading profile: ${error.message}`;
             console.error('Failed to load profile for edit:', error);
@@ -42,6 +44,7 @@ document.addEventListener('DOMContentLoaded', () => {
         const profileData = {
             display_name: name,
             bio: bio,
+            hide_network: hideNetworkCheckbox.checked,
         };
 
         try {
@@ -81,5 +84,276 @@ document.addEventListener('DOMContentLoaded', () => {
         }
     });
 
+    const followForm = document.getElementById('follow-form');
+    const followAccountInput = document.getElementById('follow-account');
+    const followMessage = document.getElementById('follow-message');
+    const followingList = document.getElementById('following-list');
+
+    async function loadFollowing() {
+        try {
+            const response = await fetch('/api/following');
+            if (!response.ok) {
+                throw new Error('Could not fetch following list');
+            }
+            const following = await response.json();
+            renderFollowing(following);
+        } catch (error) {
+            followMessage.textContent = `Error loading following list: ${error.message}`;
+            console.error('Failed to load following list:', error);
+        }
+    }
+
+    function renderFollowing(following) {
+        followingList.innerHTML = '';
+        if (!following || following.length === 0) {
+            followingList.innerHTML = '<li>You are not following anyone yet.</li>';
+            return;
+        }
+
+        following.forEach(f => {
+            const item = document.createElement('li');
+            const label = document.createElement('span');
+            label.textContent = `@${f.acct} (${f.state})`;
+            const unfollowButton = document.createElement('button');
+            unfollowButton.textContent = 'Unfollow';
+            unfollowButton.onclick = () => unfollow(f.actor_uri);
+            item.appendChild(label);
+            item.appendChild(unfollowButton);
+            followingList.appendChild(item);
+        });
+    }
+
+    async function unfollow(actorURI) {
+        if (!confirm('Are you sure you want to unfollow this account?')) {
+            return;
+        }
+        try {
+            const response = await fetch(`/api/following?actor=${encodeURIComponent(actorURI)}`, { method: 'DELETE' });
+            if (!response.ok) {
+                const errorData = await response.json();
+                throw new Error(errorData.description || 'Failed to unfollow');
+            }
+            loadFollowing();
+        } catch (error) {
+            alert(`Error unfollowing: ${error.message}`);
+        }
+    }
+
+    followForm.addEventListener('submit', async (e) => {
+        e.preventDefault();
+        followMessage.textContent = '';
+
+        try {
+            const response = await fetch('/api/following', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ account: followAccountInput.value.trim() }),
+            });
+            if (!response.ok) {
+                const errorData = await response.json();
+                throw new Error(errorData.description || 'Failed to follow');
+            }
+            followMessage.style.color = 'green';
+            followMessage.textContent = 'Follow request sent.';
+            followForm.reset();
+            loadFollowing();
+        } catch (error) {
+            followMessage.style.color = 'red';
+            followMessage.textContent = `Error: ${error.message}`;
+        }
+    });
+
+    const passwordForm = document.getElementById('password-form');
+    const passwordMessage = document.getElementById('password-message');
+
+    passwordForm.addEventListener('submit', async (e) => {
+        e.preventDefault();
+        passwordMessage.textContent = '';
+
+        try {
+            const response = await fetch('/api/auth/password', {
+                method: 'PUT',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({
+                    current_password: document.getElementById('current-password').value,
+                    new_password: document.getElementById('new-password').value,
+                }),
+            });
+            if (!response.ok) {
+                const errorData = await response.json();
+                throw new Error(errorData.description || 'Failed to change password');
+            }
+            passwordMessage.style.color = 'green';
+            passwordMessage.textContent = 'Password changed. Other devices have been logged out.';
+            passwordForm.reset();
+            loadSessions();
+        } catch (error) {
+            passwordMessage.style.color = 'red';
+            passwordMessage.textContent = `Error: ${error.message}`;
+        }
+    });
+
+    const totpStatus = document.getElementById('totp-status');
+    const totpSetupButton = document.getElementById('totp-setup-button');
+    const totpConfirmForm = document.getElementById('totp-confirm-form');
+    const totpManageForm = document.getElementById('totp-manage-form');
+    const totpRecoveryCodes = document.getElementById('totp-recovery-codes');
+    const totpMessage = document.getElementById('totp-message');
+
+    async function loadTOTP() {
+        try {
+            const response = await fetch('/api/auth/totp');
+            if (!response.ok) {
+                throw new Error('Could not fetch two-factor authentication status');
+            }
+            const status = await response.json();
+            totpStatus.textContent = status.enabled
+                ? `Enabled. ${status.recovery_codes_left} recovery codes left.`
+                : 'Not enabled.';
+            totpSetupButton.classList.toggle('hidden', status.enabled);
+            totpManageForm.classList.toggle('hidden', !status.enabled);
+            totpConfirmForm.classList.add('hidden');
+        } catch (error) {
+            totpMessage.textContent = `Error: ${error.message}`;
+        }
+    }
+
+    function showRecoveryCodes(codes) {
+        const list = document.getElementById('totp-recovery-list');
+        list.innerHTML = '';
+        codes.forEach(code => {
+            const item = document.createElement('li');
+            item.textContent = code;
+            list.appendChild(item);
+        });
+        totpRecoveryCodes.classList.remove('hidden');
+    }
+
+    // Sends a two-factor authentication request and returns its JSON body.
+    async function totpRequest(url, method, body) {
+        const response = await fetch(url, {
+            method,
+            headers: { 'Content-Type': 'application/json' },
+            body: body ? JSON.stringify(body) : undefined,
+        });
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.description || 'Request failed');
+        }
+        return data;
+    }
+
+    totpSetupButton.addEventListener('click', async () => {
+        totpMessage.textContent = '';
+        try {
+            const setup = await totpRequest('/api/auth/totp', 'POST');
+            document.getElementById('totp-uri').href = setup.uri;
+            document.getElementById('totp-secret').textContent = setup.secret;
+            totpSetupButton.classList.add('hidden');
+            totpConfirmForm.classList.remove('hidden');
+        } catch (error) {
+            totpMessage.style.color = 'red';
+            totpMessage.textContent = `Error: ${error.message}`;
+        }
+    });
+
+    totpConfirmForm.addEventListener('submit', async (e) => {
+        e.preventDefault();
+        totpMessage.textContent = '';
+        try {
+            const result = await totpRequest('/api/auth/totp/confirm', 'POST', {
+                code: document.getElementById('totp-confirm-code').value,
+            });
+            totpConfirmForm.reset();
+            showRecoveryCodes(result.recovery_codes);
+            loadTOTP();
+        } catch (error) {
+            totpMessage.style.color = 'red';
+            totpMessage.textContent = `Error: ${error.message}`;
+        }
+    });
+
+    totpManageForm.addEventListener('submit', async (e) => {
+        e.preventDefault();
+        totpMessage.textContent = '';
+        const password = document.getElementById('totp-password').value;
+        try {
+            if (e.submitter && e.submitter.id === 'totp-disable-button') {
+                if (!confirm('Disable two-factor authentication?')) {
+                    return;
+                }
+                await totpRequest('/api/auth/totp', 'DELETE', { password });
+                totpRecoveryCodes.classList.add('hidden');
+            } else {
+                const result = await totpRequest('/api/auth/totp/recovery-codes', 'POST', { password });
+                showRecoveryCodes(result.recovery_codes);
+            }
+            totpManageForm.reset();
+            loadTOTP();
+        } catch (error) {
+            totpMessage.style.color = 'red';
+            totpMessage.textContent = `Error: ${error.message}`;
+        }
+    });
+
+    const sessionsMessage = document.getElementById('sessions-message');
+    const sessionsList = document.getElementById('sessions-list');
+
+    async function loadSessions() {
+        try {
+            const response = await fetch('/api/sessions');
+            if (!response.ok) {
+                throw new Error('Could not fetch sessions');
+            }
+            const sessions = await response.json();
+            renderSessions(sessions);
+        } catch (error) {
+            sessionsMessage.textContent = `Error loading sessions: ${error.message}`;
+            console.error('Failed to load sessions:', error);
+        }
+    }
+
+    function renderSessions(sessions) {
+        sessionsList.innerHTML = '';
+        sessions.forEach(s => {
+            const item = document.createElement('li');
+            const label = document.createElement('span');
+            const lastSeen = new Date(s.last_seen_at).toLocaleString();
+            label.textContent = `${s.user_agent || 'Unknown device'} (${s.ip}), last seen ${lastSeen}${s.current ? ' - this device' : ''}`;
+            const revokeButton = document.createElement('button');
+            revokeButton.textContent = 'Revoke';
+            revokeButton.onclick = () => revokeSession(s);
+            item.appendChild(label);
+            item.appendChild(revokeButton);
+            sessionsList.appendChild(item);
+        });
+    }
+
+    async function revokeSession(session) {
+        const question = session.current
+            ? 'This will log you out on this device. Continue?'
+            : 'Are you sure you want to revoke this session?';
+        if (!confirm(question)) {
+            return;
+        }
+        try {
+            const response = await fetch(`/api/sessions/${session.id}`, { method: 'DELETE' });
+            if (!response.ok) {
+                const errorData = await response.json();
+                throw new Error(errorData.description || 'Failed to revoke session');
+            }
+            if (session.current) {
+                window.location.href = '/login';
+                return;
+            }
+            loadSessions();
+        } catch (error) {
+            alert(`Error revoking session: ${error.message}`);
+        }
+    }
+
     loadProfileForEdit();
+    loadFollowing();
+    loadTOTP();
+    loadSessions();
 });
@@ -43,27 +43,36 @@ document.addEventListener('DOMContentLoaded', () => {
         document.getElementById('profile-bio').textContent = profile.bio || 'No bio provided.';
     }
 
-    async function fetchNotes() {
+    const loadMoreButton = document.getElementById('load-more');
+    let nextPageURL = null;
+
+    loadMoreButton.addEventListener('click', () => fetchNotes(nextPageURL));
+
+    async function fetchNotes(url) {
         try {
-            const response = await fetch('/api/profile/recent');
+            const response = await fetch(url || '/api/profile/recent');
             if (!response.ok) {
                 throw new Error('Could not fetch notes');
             }
             const notes = await response.json();
-            renderNotes(notes);
+            nextPageURL = NoteRenderer.getNextPageURL(response);
+            loadMoreButton.classList.toggle('hidden', !nextPageURL);
+            renderNotes(notes, !!url);
         } catch (error) {
             recentPostsContainer.innerHTML = `<p class='error-message'>Error fetching timeline: ${error.message}</p>`;
             console.error('Failed to fetch notes:', error);
         }
     }
 
-    async function renderNotes(notes) {
-        if (!notes || notes.length === 0) {
+    async function renderNotes(notes, append) {
+        if (!append && (!notes || notes.length === 0)) {
             recentPostsContainer.innerHTML = '<p>No notes yet.</p>';
             return;
         }
 
-        recentPostsContainer.innerHTML = '';
+        if (!append) {
+            recentPostsContainer.innerHTML = '';
+        }
         const isLoggedIn = await fetchLogined();
         
         for (const note of notes) {
@@ -104,7 +113,7 @@ document.addEventListener('DOMContentLoaded', () => {
                 const errorData = await response.json();
                 throw new Error(errorData.description || 'Failed to delete note');
             }
-            fetchNotes();
+            fetchNotes(null);
         } catch (error) {
             alert(`Error deleting note: ${error.message}`);
             console.error('Failed to delete note:', error);
@@ -142,5 +151,5 @@ document.addEventListener('DOMContentLoaded', () => {
     }
 
     fetchProfile();
-    fetchNotes();
+    fetchNotes(null);
 });
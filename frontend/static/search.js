@@ -0,0 +1,67 @@
+document.addEventListener('DOMContentLoaded', () => {
+    const form = document.getElementById('search-form');
+    const queryField = document.getElementById('search-query');
+    const visibilityField = document.getElementById('search-visibility');
+    const timeline = document.getElementById('timeline');
+    const loadMoreButton = document.getElementById('load-more');
+    let nextPageURL = null;
+
+    // Fill the form from the URL so that searches can be linked to.
+    const params = new URLSearchParams(window.location.search);
+    queryField.value = params.get('q') || '';
+    visibilityField.value = params.get('visibility') || '';
+
+    form.addEventListener('submit', (event) => {
+        event.preventDefault();
+        const query = new URLSearchParams();
+        query.set('q', queryField.value);
+        if (visibilityField.value) {
+            query.set('visibility', visibilityField.value);
+        }
+        history.replaceState(null, '', `/search?${query}`);
+        fetchResults(`/api/search?${query}`, false);
+    });
+
+    loadMoreButton.addEventListener('click', () => fetchResults(nextPageURL, true));
+
+    if (queryField.value) {
+        form.requestSubmit();
+    }
+
+    async function fetchResults(url, append) {
+        try {
+            const response = await fetch(url);
+            if (!response.ok) {
+                const error = await response.json().catch(() => ({}));
+                throw new Error(error.description || 'Search failed');
+            }
+            const results = await response.json();
+            nextPageURL = NoteRenderer.getNextPageURL(response);
+            loadMoreButton.classList.toggle('hidden', !nextPageURL);
+            renderResults(results, append);
+        } catch (error) {
+            timeline.innerHTML = `<p class='error-message'>${NoteRenderer.escapeHTML(error.message)}</p>`;
+            loadMoreButton.classList.add('hidden');
+        }
+    }
+
+    function renderResults(results, append) {
+        if (!append) {
+            timeline.innerHTML = '';
+            if (results.length === 0) {
+                timeline.innerHTML = '<p>No notes found.</p>';
+                return;
+            }
+        }
+
+        results.forEach(result => {
+            const noteElement = NoteRenderer.createNoteElement(result);
+            const snippet = document.createElement('p');
+            snippet.className = 'search-snippet';
+            // The snippet is escaped by the server apart from <mark>.
+            snippet.innerHTML = result.snippet;
+            noteElement.insertBefore(snippet, noteElement.querySelector('.note-content'));
+            timeline.appendChild(noteElement);
+        });
+    }
+});
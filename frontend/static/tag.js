@@ -0,0 +1,54 @@
+document.addEventListener('DOMContentLoaded', () => {
+    const timeline = document.getElementById('timeline');
+    const tagTitle = document.getElementById('tag-title');
+
+    // Extract the tag name from URL path /tags/{name}
+    const pathParts = window.location.pathname.split('/');
+    const tagName = decodeURIComponent(pathParts[2] || '');
+
+    if (!tagName) {
+        tagTitle.textContent = "Tag not found";
+        timeline.innerHTML = '<p>No tag specified.</p>';
+        return;
+    }
+
+    tagTitle.textContent = `#${tagName}`;
+
+    const loadMoreButton = document.getElementById('load-more');
+    let nextPageURL = null;
+
+    loadMoreButton.addEventListener('click', () => fetchTagNotes(tagName, nextPageURL));
+
+    fetchTagNotes(tagName, null);
+
+    async function fetchTagNotes(name, url) {
+        try {
+            const response = await fetch(url || `/api/tags/${encodeURIComponent(name)}`);
+            if (!response.ok) {
+                throw new Error('Could not fetch notes for this tag');
+            }
+            const notes = await response.json();
+            nextPageURL = NoteRenderer.getNextPageURL(response);
+            loadMoreButton.classList.toggle('hidden', !nextPageURL);
+            renderNotes(notes, !!url);
+        } catch (error) {
+            timeline.innerHTML = `<p class='error-message'>Error fetching timeline: ${error.message}</p>`;
+            console.error('Failed to fetch notes:', error);
+        }
+    }
+
+    function renderNotes(notes, append) {
+        if (!append && (!notes || notes.length === 0)) {
+            timeline.innerHTML = '<p>No notes found with this tag.</p>';
+            return;
+        }
+
+        if (!append) {
+            timeline.innerHTML = '';
+        }
+        notes.forEach(note => {
+            const noteElement = NoteRenderer.createNoteElement(note);
+            timeline.appendChild(noteElement);
+        });
+    }
+});
@@ -3,16 +3,19 @@ module knife
 go 1.25.5
 
 require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/buckket/go-blurhash v1.1.0
 	github.com/go-ap/activitypub v0.0.0-20251217103921-9808e9a35f7b
 	github.com/jmoiron/sqlx v1.4.0
 	github.com/mattn/go-sqlite3 v1.14.32
+	github.com/microcosm-cc/bluemonday v1.0.27
 	golang.org/x/crypto v0.46.0
+	golang.org/x/image v0.34.0
 )
 
 require (
 	github.com/aymerick/douceur v0.2.0 // indirect
 	github.com/gorilla/css v1.0.1 // indirect
-	github.com/microcosm-cc/bluemonday v1.0.27 // indirect
 	golang.org/x/sys v0.39.0 // indirect
 )
 
@@ -22,7 +25,7 @@ require (
 	github.com/go-ap/jsonld v0.0.0-20251216162253-e38fa664ea77 // indirect
 	github.com/go-fed/httpsig v1.1.0
 	github.com/gomarkdown/markdown v0.0.0-20250810172220-2e2c11897d1a
-	github.com/valyala/fastjson v1.6.7 // indirect
+	github.com/valyala/fastjson v1.6.7
 	golang.org/x/net v0.48.0
 	golang.org/x/text v0.32.0 // indirect
 )
@@ -1,37 +1,81 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"io/fs"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"knife/ap"
 	"knife/api"
 	"knife/base"
+	"knife/config"
 	"knife/db"
 	"knife/etc"
 )
 
+// shutdownTimeout is how long in-flight requests and deliveries are given
+// to finish after SIGINT or SIGTERM.
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	fmt.Println("Knife version ", etc.Version)
-	if len(os.Args) > 1 && os.Args[1] == "setup" {
-		initializes()
+
+	// The command, if any, comes first: knife [command] [flags]
+	command := ""
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	// migrate takes a subcommand: knife migrate status|up|down [flags]
+	subcommand := ""
+	if command == "migrate" && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		subcommand, args = args[0], args[1:]
+	}
+
+	// passwd has a flag of its own, taken out before the config flags.
+	disable2FA := false
+	if command == "passwd" {
+		disable2FA, args = takeFlag(args, "disable-2fa")
+	}
+
+	cfg, _, err := config.Load(args)
+	if err != nil {
+		log.Fatalf("could not load config: %v", err)
+	}
+
+	if command == "setup" {
+		initializes(cfg)
+		return
+	}
+
+	if command == "passwd" {
+		runPasswd(cfg, disable2FA)
+		return
+	}
+
+	if command == "migrate" {
+		runMigrate(cfg, subcommand)
 		return
 	}
 
 	// --- 초기화 ---
-	dbconn := initializeDatabase("knife.db")
+	dbconn := initializeDatabase(cfg.DatabasePath)
 	defer dbconn.Close()
 	log.Println("Database connected.")
 
-	if len(os.Args) > 1 && os.Args[1] == "initkey" {
-		getOrCreateSecretKey("secret.key")
+	if command == "initkey" {
+		getOrCreateSecretKey(cfg.SecretKeyPath)
 
 		httpsigModel := db.NewHTTPSigModel(dbconn)
 		profileModel := db.NewProfileModel(dbconn)
@@ -47,38 +91,86 @@ func main() {
 		return
 	}
 
-	secretKey := initializeSecretKey("secret.key")
-	jobQueue := initializeJobQueue()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
+	initializeLogger(cfg)
+
+	secretKey := initializeSecretKey(cfg.SecretKeyPath)
+	proxies := initializeTrustedProxies(cfg)
+	jobQueue := initializeJobQueue(cfg)
 	log.Println("Job queue started.")
+	initializeMediaDir(cfg)
 
 	// --- 모델 및 API 초기화 ---
 	profileModel := db.NewProfileModel(dbconn)
 	noteModel := db.NewNoteModel(dbconn)
 	followerModel := db.NewFollowerModel(dbconn)
+	followingModel := db.NewFollowingModel(dbconn)
 	bookmarkModel := db.NewBookmarkModel(dbconn)
 	httpsigModel := db.NewHTTPSigModel(dbconn)
 	draftModel := db.NewDraftModel(dbconn)
+	mediaModel := db.NewMediaModel(dbconn)
+	deliveryModel := db.NewDeliveryModel(dbconn)
+	sessionModel := db.NewSessionModel(dbconn)
+	recoveryCodeModel := db.NewRecoveryCodeModel(dbconn)
 	log.Println("Models initialized.")
 
-	activityDispatcher := ap.NewActivityDispatcher(followerModel, httpsigModel, jobQueue)
+	fetcher := ap.NewFetcher(cfg)
+	activityDispatcher := ap.NewActivityDispatcher(cfg, fetcher, followerModel, followingModel, httpsigModel, deliveryModel, jobQueue)
+	activityDispatcher.StartDeliveries()
+	log.Println("Delivery loop started.")
 
-	authAPI := api.NewAuthAPI(profileModel, secretKey)
-	profileAPI := api.NewProfileAPI(profileModel, noteModel)
-	noteAPI := api.NewNoteAPI(noteModel, profileModel, followerModel, activityDispatcher)
+	authAPI := api.NewAuthAPI(cfg, profileModel, sessionModel, recoveryCodeModel, secretKey, proxies)
+	profileAPI := api.NewProfileAPI(cfg, profileModel, noteModel, authAPI)
+	noteAPI := api.NewNoteAPI(cfg, authAPI, noteModel, profileModel, followerModel, mediaModel, activityDispatcher)
 	bookmarkAPI := api.NewBookmarkAPI(bookmarkModel, noteModel)
 	draftAPI := api.NewDraftAPI(draftModel)
-	categoryAPI := api.NewCategoryAPI(noteModel)
-	activityPubAPI := ap.NewActivityPubAPI(noteModel, profileModel, followerModel, httpsigModel)
+	categoryAPI := api.NewCategoryAPI(noteModel, authAPI)
+	followingAPI := api.NewFollowingAPI(followingModel, activityDispatcher)
+	timelineAPI := api.NewTimelineAPI(noteModel)
+	mediaAPI := api.NewMediaAPI(cfg, mediaModel)
+	searchAPI := api.NewSearchAPI(noteModel, authAPI)
+	tagAPI := api.NewTagAPI(noteModel, authAPI)
+	reactionAPI := api.NewReactionAPI(cfg, noteModel, profileModel, activityDispatcher)
+	adminAPI := api.NewAdminAPI(deliveryModel, activityDispatcher)
+	activityPubAPI := ap.NewActivityPubAPI(cfg, fetcher, activityDispatcher, noteModel, profileModel, followerModel, followingModel, httpsigModel)
 	log.Println("APIs initialized.")
 
 	// --- 라우터 설정 ---
-	apiRouter := setupAPIRouter(authAPI, profileAPI, noteAPI, bookmarkAPI, draftAPI, categoryAPI)
-	mainMux := setupMainRouter(apiRouter, activityPubAPI)
+	limits := cfg.RateLimit
+	loginLimiter := base.NewRateLimiter("LoginRateLimit", limits.Login.PerMinute, limits.Login.Burst, proxies)
+	apiLimiter := base.NewRateLimiter("APIRateLimit", limits.API.PerMinute, limits.API.Burst, proxies)
+	inboxLimiter := base.NewRateLimiter("InboxRateLimit", limits.Inbox.PerMinute, limits.Inbox.Burst, proxies)
+
+	csrfProtection, err := base.NewCSRFProtection(cfg.BaseURL)
+	if err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
+
+	apiRouter := setupAPIRouter(csrfProtection, loginLimiter, authAPI, profileAPI, noteAPI, bookmarkAPI, draftAPI, categoryAPI, followingAPI, timelineAPI, mediaAPI, searchAPI, tagAPI, reactionAPI, adminAPI)
+	mainMux := setupMainRouter(cfg, apiRouter, apiLimiter, inboxLimiter, activityPubAPI)
 	log.Println("Router setup complete.")
 
 	log.Println("Boot complete.")
 	// --- 서버 시작 ---
-	startServer(mainMux)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server := startServer(cfg, mainMux)
+	<-ctx.Done()
+	stop()
+
+	// --- 종료 ---
+	log.Println("Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("could not stop server cleanly: %v", err)
+	}
+	if err := activityDispatcher.StopDeliveries(shutdownCtx); err != nil {
+		log.Printf("could not stop deliveries cleanly: %v", err)
+	}
+	log.Println("Shutdown complete.")
 }
 
 func serveFile(path string) http.HandlerFunc {
@@ -133,31 +225,63 @@ func initializeSecretKey(filename string) string {
 	return getOrCreateSecretKey(filename)
 }
 
-func initializeJobQueue() *base.JobQueue {
-	jobQueue := base.NewJobQueue(100)
-	jobQueue.Start()
-	return jobQueue
+func initializeTrustedProxies(cfg *config.Config) base.TrustedProxies {
+	prefixes, err := cfg.RateLimit.ProxyPrefixes()
+	if err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
+	return prefixes
+}
+
+// initializeLogger sets the default slog logger to the configured level.
+// Messages from the log package are written at the info level.
+func initializeLogger(cfg *config.Config) {
+	level, _ := cfg.SlogLevel()
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+}
+
+// initializeMediaDir creates the directory uploads are stored in.
+func initializeMediaDir(cfg *config.Config) {
+	if err := os.MkdirAll(cfg.MediaDir, 0755); err != nil {
+		log.Fatalf("could not create media directory: %v", err)
+	}
+}
+
+func initializeJobQueue(cfg *config.Config) *base.JobQueue {
+	queue := cfg.Queue
+	return base.NewJobQueue(queue.Workers, queue.Size, queue.HostConcurrency, queue.RatePerMinute)
 }
 
 // --- 라우터 설정 함수 ---
-func setupAPIRouter(authAPI *api.AuthAPI, profileAPI *api.ProfileAPI, noteAPI *api.NoteAPI, bookmarkAPI *api.BookmarkAPI, draftAPI *api.DraftAPI, categoryAPI *api.CategoryAPI) base.APIRouter {
+func setupAPIRouter(csrfProtection *base.CSRFProtection, loginLimiter *base.RateLimiter, authAPI *api.AuthAPI, profileAPI *api.ProfileAPI, noteAPI *api.NoteAPI, bookmarkAPI *api.BookmarkAPI, draftAPI *api.DraftAPI, categoryAPI *api.CategoryAPI, followingAPI *api.FollowingAPI, timelineAPI *api.TimelineAPI, mediaAPI *api.MediaAPI, searchAPI *api.SearchAPI, tagAPI *api.TagAPI, reactionAPI *api.ReactionAPI, adminAPI *api.AdminAPI) *base.APIRouter {
 	apiRouter := base.NewAPIRouter()
+	// Every route is protected against cross-site requests
+	apiRouter.RegisterGlobalMiddleware(csrfProtection)
 	authAPI.RegisterHandlers(&apiRouter)
 	profileAPI.RegisterHandlers(&apiRouter)
 	noteAPI.RegisterHandlers(&apiRouter)
 	bookmarkAPI.RegisterHandlers(&apiRouter)
 	draftAPI.RegisterHandlers(&apiRouter)
 	categoryAPI.RegisterHandlers(&apiRouter)
-
-	// Apply authentication middleware to protected routes
+	followingAPI.RegisterHandlers(&apiRouter)
+	timelineAPI.RegisterHandlers(&apiRouter)
+	mediaAPI.RegisterHandlers(&apiRouter)
+	searchAPI.RegisterHandlers(&apiRouter)
+	tagAPI.RegisterHandlers(&apiRouter)
+	reactionAPI.RegisterHandlers(&apiRouter)
+	adminAPI.RegisterHandlers(&apiRouter)
+
+	// Limit the routes that name it, then apply authentication middleware
+	// to protected routes
+	apiRouter.RegisterMidddleware(loginLimiter)
 	apiRouter.RegisterMidddleware(api.NewAuthMiddleware(authAPI))
 
-	return apiRouter
+	return &apiRouter
 }
 
-func setupMainRouter(apiRouter base.APIRouter, activityPubAPI *ap.ActivityPubAPI) *http.ServeMux {
+func setupMainRouter(cfg *config.Config, apiRouter *base.APIRouter, apiLimiter, inboxLimiter *base.RateLimiter, activityPubAPI *ap.ActivityPubAPI) *http.ServeMux {
 	mainMux := http.NewServeMux()
-	mainMux.Handle("/api/", http.StripPrefix("/api", apiRouter.GetMUX()))
+	mainMux.Handle("/api/", apiLimiter.Wrap(http.StripPrefix("/api", apiRouter.GetMUX())))
 
 	// --- WebFinger ---
 	mainMux.HandleFunc("/.well-known/webfinger", activityPubAPI.Webfinger)
@@ -171,7 +295,10 @@ func setupMainRouter(apiRouter base.APIRouter, activityPubAPI *ap.ActivityPubAPI
 			serveFile("frontend/profile.html")(w, r)
 		}
 	})
-	mainMux.HandleFunc("/inbox", activityPubAPI.Inbox)
+	mainMux.Handle("/inbox", inboxLimiter.Wrap(http.HandlerFunc(activityPubAPI.Inbox)))
+	mainMux.HandleFunc("/outbox", activityPubAPI.Outbox)
+	mainMux.HandleFunc("/followers", activityPubAPI.Followers)
+	mainMux.HandleFunc("/following", activityPubAPI.Following)
 	mainMux.HandleFunc("/notes/", func(w http.ResponseWriter, r *http.Request) {
 		acceptHeader := r.Header.Get("Accept")
 		if strings.Contains(acceptHeader, "application/activity+json") {
@@ -180,6 +307,14 @@ func setupMainRouter(apiRouter base.APIRouter, activityPubAPI *ap.ActivityPubAPI
 			serveFile("frontend/note.html")(w, r)
 		}
 	})
+	mainMux.HandleFunc("/tags/", func(w http.ResponseWriter, r *http.Request) {
+		acceptHeader := r.Header.Get("Accept")
+		if strings.Contains(acceptHeader, "application/activity+json") {
+			activityPubAPI.Tag(w, r)
+		} else {
+			serveFile("frontend/tag.html")(w, r)
+		}
+	})
 
 	// Static file handling
 	staticFS, err := fs.Sub(Content, "frontend/static")
@@ -188,9 +323,21 @@ func setupMainRouter(apiRouter base.APIRouter, activityPubAPI *ap.ActivityPubAPI
 	}
 	mainMux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(staticFS))))
 
+	// Uploaded media. Directory listings are not served.
+	mediaServer := http.StripPrefix("/media/", http.FileServer(http.Dir(cfg.MediaDir)))
+	mainMux.HandleFunc("/media/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		mediaServer.ServeHTTP(w, r)
+	})
+
 	// Serve HTML files
 	mainMux.HandleFunc("/", serveFile("frontend/index.html"))
 	mainMux.HandleFunc("/categories", serveFile("frontend/categories.html"))
+	mainMux.HandleFunc("/search", serveFile("frontend/search.html"))
 	mainMux.HandleFunc("/category/", serveFile("frontend/category.html"))
 	mainMux.HandleFunc("/new-note", serveFile("frontend/new-note.html"))
 	mainMux.HandleFunc("/profile-settings", serveFile("frontend/profile-settings.html"))
@@ -201,10 +348,16 @@ func setupMainRouter(apiRouter base.APIRouter, activityPubAPI *ap.ActivityPubAPI
 }
 
 // --- 서버 시작 함수 ---
-func startServer(mux *http.ServeMux) {
-	log.Println("Server starting on :8080")
-	log.Println("Access the frontend at http://localhost:8080")
-	if err := http.ListenAndServe(":8080", mux); err != nil {
-		log.Fatalf("could not start server: %v", err)
-	}
+// startServer starts serving mux in the background and returns the server
+// so that it can be shut down.
+func startServer(cfg *config.Config, mux *http.ServeMux) *http.Server {
+	server := &http.Server{Addr: cfg.Listen, Handler: mux}
+	log.Println("Server starting on", cfg.Listen)
+	log.Println("Access the frontend at", cfg.BaseURL)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("could not start server: %v", err)
+		}
+	}()
+	return server
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"knife/config"
+	"knife/db"
+)
+
+// runMigrate implements knife migrate status|up|down.
+func runMigrate(cfg *config.Config, subcommand string) {
+	dbconn, err := db.Open(cfg.DatabasePath)
+	if err != nil {
+		log.Fatalf("could not connect to database: %v", err)
+	}
+	defer dbconn.Close()
+
+	switch subcommand {
+	case "", "status":
+		statuses, err := dbconn.MigrationStatus()
+		if err != nil {
+			log.Fatalf("could not read migrations: %v", err)
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.Requires != "" && status.AppliedAt == nil {
+				if ok, err := dbconn.HasModule(status.Requires); err == nil && !ok {
+					applied = "skipped (SQLite was built without " + status.Requires + ")"
+				}
+			}
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%4d  %-40s %s\n", status.Version, status.Name, applied)
+		}
+
+	case "up":
+		done, err := dbconn.MigrateUp()
+		for _, m := range done {
+			fmt.Printf("applied %d (%s)\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if len(done) == 0 {
+			fmt.Println("database is up to date")
+		}
+
+	case "down":
+		m, err := dbconn.MigrateDown()
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if m == nil {
+			fmt.Println("no migration to revert")
+			return
+		}
+		fmt.Printf("reverted %d (%s)\n", m.Version, m.Name)
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate command %q, expected status, up or down\n", subcommand)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+
+	"knife/config"
+	"knife/db"
+)
+
+// runPasswd implements knife passwd, which sets a new password without the
+// current one, for when the owner is locked out. Every session is logged
+// out. With disable2FA, two-factor authentication is turned off and the
+// recovery codes are deleted as well, for an owner who lost both.
+func runPasswd(cfg *config.Config, disable2FA bool) {
+	dbconn, err := db.InitDB(cfg.DatabasePath)
+	if err != nil {
+		log.Fatalf("could not connect to database: %v", err)
+	}
+	defer dbconn.Close()
+
+	profileModel := db.NewProfileModel(dbconn)
+	profile, err := profileModel.Get()
+	if err != nil {
+		log.Fatalf("could not get profile (run knife setup first): %v", err)
+	}
+
+	fmt.Printf("Changing the password of %s.\n", profile.Finger)
+	hash := promptPassword(bufio.NewReader(os.Stdin), "Enter a new password: ")
+
+	if err := profileModel.UpdatePassword(profile.Finger, hash); err != nil {
+		log.Fatalf("could not update password: %v", err)
+	}
+	if disable2FA {
+		if err := profileModel.DisableTOTP(profile.Finger); err != nil {
+			log.Fatalf("could not disable two-factor authentication: %v", err)
+		}
+		if err := db.NewRecoveryCodeModel(dbconn).DeleteAll(); err != nil {
+			log.Fatalf("could not delete recovery codes: %v", err)
+		}
+	}
+	if err := db.NewSessionModel(dbconn).DeleteAll(); err != nil {
+		log.Fatalf("could not log out sessions: %v", err)
+	}
+
+	if disable2FA {
+		fmt.Println("Password changed and two-factor authentication disabled. All sessions have been logged out.")
+	} else {
+		fmt.Println("Password changed. All sessions have been logged out.")
+	}
+}
+
+// takeFlag removes the boolean flag name, given as -name or --name, from
+// args and reports whether it was there.
+func takeFlag(args []string, name string) (bool, []string) {
+	found := false
+	rest := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == "-"+name || arg == "--"+name {
+			found = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return found, rest
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTakeFlag(t *testing.T) {
+	tests := []struct {
+		args      []string
+		wantFound bool
+		wantRest  []string
+	}{
+		{[]string{}, false, []string{}},
+		{[]string{"-db", "knife.db"}, false, []string{"-db", "knife.db"}},
+		{[]string{"-disable-2fa"}, true, []string{}},
+		{[]string{"--disable-2fa", "-db", "knife.db"}, true, []string{"-db", "knife.db"}},
+		{[]string{"-db", "knife.db", "-disable-2fa"}, true, []string{"-db", "knife.db"}},
+	}
+	for _, tt := range tests {
+		found, rest := takeFlag(tt.args, "disable-2fa")
+		if found != tt.wantFound || !slices.Equal(rest, tt.wantRest) {
+			t.Errorf("takeFlag(%q) = %v, %q; want %v, %q", tt.args, found, rest, tt.wantFound, tt.wantRest)
+		}
+	}
+}
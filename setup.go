@@ -3,16 +3,16 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"knife/api"
+	"knife/config"
 	"knife/db"
 	"log"
 	"os"
 	"strings"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
-func initializes() {
-	dbconn, err := db.InitDB("knife.db")
+func initializes(cfg *config.Config) {
+	dbconn, err := db.InitDB(cfg.DatabasePath)
 	if err != nil {
 		log.Fatalf("could not connect to database: %v", err)
 	}
@@ -37,28 +37,7 @@ func initializes() {
 	bio, _ = reader.ReadString('\n')
 	bio = strings.TrimSpace(bio)
 
-	// Prompt for a password
-	var password string
-	for {
-		fmt.Print("Enter a password for the application: ")
-		input, err := reader.ReadString('\n')
-		if err != nil {
-			log.Fatalf("Error reading input: %v", err)
-		}
-		password = strings.TrimSpace(input)
-
-		if len(password) < 8 {
-			fmt.Println("Password must be at least 8 characters long. Please try again.")
-			continue
-		}
-		break
-	}
-
-	// Hash the password
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		log.Fatalf("Could not hash password: %v", err)
-	}
+	hash := promptPassword(reader, "Enter a password for the application: ")
 
 	profileModel := db.NewProfileModel(dbconn)
 
@@ -67,7 +46,7 @@ func initializes() {
 	profile.DisplayName = display_name
 	profile.AvatarURL = avatar_url
 	profile.Bio = bio
-	profile.PasswordHash = string(hash)
+	profile.PasswordHash = hash
 
 	if err := profileModel.Create(&profile); err != nil {
 		log.Fatalf("could not create profile: %v", err)
@@ -75,3 +54,24 @@ func initializes() {
 
 	fmt.Println("Profile created successfully!")
 }
+
+// promptPassword asks for a password until one long enough is given and
+// returns its hash.
+func promptPassword(reader *bufio.Reader, prompt string) string {
+	for {
+		fmt.Print(prompt)
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			log.Fatalf("Error reading input: %v", err)
+		}
+
+		hash, err := api.HashPassword(strings.TrimSpace(input))
+		if err == api.ErrPasswordTooShort {
+			fmt.Printf("Password must be at least %d characters long. Please try again.\n", api.MinPasswordLength)
+			continue
+		} else if err != nil {
+			log.Fatalf("Could not hash password: %v", err)
+		}
+		return hash
+	}
+}